@@ -0,0 +1,210 @@
+package electrum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidAddress is returned when an address can't be decoded for the selected network
+var ErrInvalidAddress = errors.New("INVALID_ADDRESS")
+
+// NetworkParams define the address encoding parameters of a network
+type NetworkParams struct {
+	// Version byte of base58 pay-to-pubkey-hash addresses
+	PubKeyHashAddrID byte
+
+	// Version byte of base58 pay-to-script-hash addresses
+	ScriptHashAddrID byte
+
+	// Human-readable part of bech32 segwit addresses
+	Bech32HRP string
+}
+
+// Parameters of the supported networks
+var (
+	MainNetParams = &NetworkParams{PubKeyHashAddrID: 0x00, ScriptHashAddrID: 0x05, Bech32HRP: "bc"}
+	TestNetParams = &NetworkParams{PubKeyHashAddrID: 0x6f, ScriptHashAddrID: 0xc4, Bech32HRP: "tb"}
+	RegTestParams = &NetworkParams{PubKeyHashAddrID: 0x6f, ScriptHashAddrID: 0xc4, Bech32HRP: "bcrt"}
+)
+
+// ScriptHashFromAddress returns the script hash used by the protocol to identify the output
+// script of an address; P2PKH, P2SH and segwit (P2WPKH, P2WSH and taproot) addresses are
+// supported. If no network parameters are provided mainnet is used
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-basics.html#script-hashes
+func ScriptHashFromAddress(address string, params *NetworkParams) (string, error) {
+	script, err := AddressScript(address, params)
+	if err != nil {
+		return "", err
+	}
+	return ScriptHashFromScript(script), nil
+}
+
+// ScriptHashFromScript returns the script hash used by the protocol to identify an output
+// script: the SHA-256 digest of the script, hex-encoded in reverse byte order
+func ScriptHashFromScript(script []byte) string {
+	h := sha256.Sum256(script)
+	return reverseHex(h[:])
+}
+
+// AddressScript returns the output script paying to an address
+func AddressScript(address string, params *NetworkParams) ([]byte, error) {
+	if params == nil {
+		params = MainNetParams
+	}
+
+	// Segwit addresses
+	if i := strings.LastIndexByte(address, '1'); i > 0 && strings.EqualFold(address[:i], params.Bech32HRP) {
+		version, program, err := decodeSegwitAddress(address, params.Bech32HRP)
+		if err != nil {
+			return nil, err
+		}
+		op := byte(0x00)
+		if version > 0 {
+			op = 0x50 + version
+		}
+		return append([]byte{op, byte(len(program))}, program...), nil
+	}
+
+	// Base58 addresses
+	payload, err := base58CheckDecode(address)
+	if err != nil || len(payload) != 21 {
+		return nil, ErrInvalidAddress
+	}
+	switch payload[0] {
+	case params.PubKeyHashAddrID:
+		script := append([]byte{0x76, 0xa9, 0x14}, payload[1:]...)
+		return append(script, 0x88, 0xac), nil
+	case params.ScriptHashAddrID:
+		script := append([]byte{0xa9, 0x14}, payload[1:]...)
+		return append(script, 0x87), nil
+	default:
+		return nil, ErrInvalidAddress
+	}
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Decode a base58 string and verify its trailing 4 bytes checksum
+func base58CheckDecode(s string) ([]byte, error) {
+	if s == "" {
+		return nil, ErrInvalidAddress
+	}
+	var out []byte
+	for _, r := range s {
+		carry := strings.IndexRune(base58Alphabet, r)
+		if carry < 0 {
+			return nil, ErrInvalidAddress
+		}
+		for i := len(out) - 1; i >= 0; i-- {
+			carry += int(out[i]) * 58
+			out[i] = byte(carry)
+			carry >>= 8
+		}
+		for ; carry > 0; carry >>= 8 {
+			out = append([]byte{byte(carry)}, out...)
+		}
+	}
+
+	// Leading '1' characters encode leading zero bytes
+	for i := 0; i < len(s) && s[i] == '1'; i++ {
+		out = append([]byte{0}, out...)
+	}
+	if len(out) < 5 {
+		return nil, ErrInvalidAddress
+	}
+	payload, checksum := out[:len(out)-4], out[len(out)-4:]
+	if !bytes.Equal(doubleSHA256(payload)[:4], checksum) {
+		return nil, ErrInvalidAddress
+	}
+	return payload, nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Checksum constants for bech32 (witness version 0) and bech32m (version 1 and later)
+// https://github.com/bitcoin/bips/blob/master/bip-0350.mediawiki
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (b>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+// Decode a segwit address, returning its witness version and program
+func decodeSegwitAddress(address, hrp string) (byte, []byte, error) {
+	if len(address) > 90 || (strings.ToLower(address) != address && strings.ToUpper(address) != address) {
+		return 0, nil, ErrInvalidAddress
+	}
+	address = strings.ToLower(address)
+	sep := strings.LastIndexByte(address, '1')
+	if sep < 1 || sep+7 > len(address) || address[:sep] != strings.ToLower(hrp) {
+		return 0, nil, ErrInvalidAddress
+	}
+
+	// Expanded human-readable part followed by the data values
+	var values []byte
+	for i := 0; i < sep; i++ {
+		values = append(values, address[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < sep; i++ {
+		values = append(values, address[i]&31)
+	}
+	data := make([]byte, 0, len(address)-sep-1)
+	for _, r := range address[sep+1:] {
+		v := strings.IndexRune(bech32Charset, r)
+		if v < 0 {
+			return 0, nil, ErrInvalidAddress
+		}
+		data = append(data, byte(v))
+	}
+	values = append(values, data...)
+
+	data = data[:len(data)-6]
+	if len(data) == 0 || data[0] > 16 {
+		return 0, nil, ErrInvalidAddress
+	}
+	version := data[0]
+	expected := uint32(bech32Const)
+	if version > 0 {
+		expected = bech32mConst
+	}
+	if bech32Polymod(values) != expected {
+		return 0, nil, ErrInvalidAddress
+	}
+
+	// Regroup the 5-bit values into bytes
+	var program []byte
+	acc, bits := 0, 0
+	for _, v := range data[1:] {
+		acc = (acc<<5 | int(v)) & 0xfff
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			program = append(program, byte(acc>>uint(bits)))
+		}
+	}
+	if bits >= 5 || acc&(1<<uint(bits)-1) != 0 {
+		return 0, nil, ErrInvalidAddress
+	}
+	if len(program) < 2 || len(program) > 40 || (version == 0 && len(program) != 20 && len(program) != 32) {
+		return 0, nil, ErrInvalidAddress
+	}
+	return version, program, nil
+}
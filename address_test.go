@@ -0,0 +1,58 @@
+package electrum
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestScriptHashFromAddress(t *testing.T) {
+	cases := []struct {
+		address string
+		params  *NetworkParams
+		script  string
+	}{
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", nil, "76a91462e907b15cbf27d5425399ebf6f0fb50ebb88f1888ac"},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", MainNetParams, "a914b472a266d0bd89c13706a4132ccfb16f7c3b9fcb87"},
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", MainNetParams, "0014751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3", MainNetParams, "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", MainNetParams, "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", TestNetParams, "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+	}
+	for _, c := range cases {
+		script, err := AddressScript(c.address, c.params)
+		if err != nil {
+			t.Errorf("%s: %v", c.address, err)
+			continue
+		}
+		if hex.EncodeToString(script) != c.script {
+			t.Errorf("%s: unexpected script %x", c.address, script)
+		}
+	}
+
+	// Reference value from the protocol documentation
+	sh, err := ScriptHashFromAddress("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sh != "8b01df4e368ea28f8dc0423bcf7a4923e3a12d307c875e47a0cfbf90b5c39161" {
+		t.Errorf("unexpected script hash: %s", sh)
+	}
+
+	invalid := []struct {
+		address string
+		params  *NetworkParams
+	}{
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", nil},                             // bad checksum
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", TestNetParams},                   // wrong network
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", nil},                     // bad checksum
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3t4", nil},                     // mixed case
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvqyzf3du", nil},                          // bech32 checksum for v2
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", nil}, // wrong network
+		{"0OIl", nil}, // invalid characters
+	}
+	for _, c := range invalid {
+		if _, err := ScriptHashFromAddress(c.address, c.params); err != ErrInvalidAddress {
+			t.Errorf("%s: unexpected error %v", c.address, err)
+		}
+	}
+}
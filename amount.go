@@ -0,0 +1,76 @@
+package electrum
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SatoshisPerBTC is the number of base units in one bitcoin
+const SatoshisPerBTC = 100000000
+
+// ErrInvalidAmount is returned when parsing malformed or out of range amounts
+var ErrInvalidAmount = errors.New("INVALID_AMOUNT")
+
+// Amount represents a quantity of bitcoin in satoshis, avoiding the rounding issues of
+// floating point values
+type Amount int64
+
+// AmountFromBTC converts a floating point bitcoin value, as returned by some protocol
+// methods, into the nearest amount
+func AmountFromBTC(btc float64) Amount {
+	return Amount(math.Round(btc * SatoshisPerBTC))
+}
+
+// ParseBTC parses a decimal bitcoin value, e.g. "0.015", with up to 8 decimal places
+func ParseBTC(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	parts := strings.SplitN(s, ".", 2)
+	if parts[0] == "" && (len(parts) == 1 || parts[1] == "") {
+		return 0, ErrInvalidAmount
+	}
+	frac := ""
+	if len(parts) == 2 {
+		frac = parts[1]
+	}
+	if len(frac) > 8 {
+		return 0, ErrInvalidAmount
+	}
+	digits := parts[0] + frac + strings.Repeat("0", 8-len(frac))
+	for _, d := range digits {
+		if d < '0' || d > '9' {
+			return 0, ErrInvalidAmount
+		}
+	}
+	v, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	if neg {
+		v = -v
+	}
+	return Amount(v), nil
+}
+
+// BTC returns the amount as a floating point bitcoin value, for display purposes only
+func (a Amount) BTC() float64 {
+	return float64(a) / SatoshisPerBTC
+}
+
+// String returns the amount formatted as a decimal bitcoin value with 8 decimal places
+func (a Amount) String() string {
+	v := int64(a)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+	}
+	u := uint64(v)
+	if v < 0 {
+		u = uint64(-v)
+	}
+	frac := strconv.FormatUint(u%SatoshisPerBTC, 10)
+	return sign + strconv.FormatUint(u/SatoshisPerBTC, 10) + "." + strings.Repeat("0", 8-len(frac)) + frac
+}
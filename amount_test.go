@@ -0,0 +1,47 @@
+package electrum
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAmount(t *testing.T) {
+	cases := []struct {
+		s string
+		a Amount
+	}{
+		{"0.00000000", 0},
+		{"0.00000001", 1},
+		{"1.00000000", SatoshisPerBTC},
+		{"0.10000000", 10000000},
+		{"-2.50000000", -250000000},
+		{"21000000.00000000", 21000000 * SatoshisPerBTC},
+	}
+	for _, c := range cases {
+		if s := c.a.String(); s != c.s {
+			t.Errorf("%d: unexpected format %s", c.a, s)
+		}
+		if a, err := ParseBTC(c.s); err != nil || a != c.a {
+			t.Errorf("%s: unexpected parse result %d, %v", c.s, a, err)
+		}
+	}
+	for _, s := range []string{"", ".", "1.123456789", "abc", "1.2.3", "1e8"} {
+		if _, err := ParseBTC(s); err != ErrInvalidAmount {
+			t.Errorf("%s: unexpected error %v", s, err)
+		}
+	}
+	if a, _ := ParseBTC(".5"); a != 50000000 {
+		t.Errorf("unexpected amount: %d", a)
+	}
+	if a := AmountFromBTC(0.1 + 0.2); a != 30000000 {
+		t.Errorf("unexpected amount: %d", a)
+	}
+
+	b := &Balance{}
+	if err := json.Unmarshal([]byte(`{"confirmed":103873966,"unconfirmed":-23684}`), b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Confirmed.String() != "1.03873966" || b.Unconfirmed.String() != "-0.00023684" {
+		t.Errorf("unexpected balance: %s, %s", b.Confirmed, b.Unconfirmed)
+	}
+}
@@ -0,0 +1,64 @@
+package electrum
+
+import (
+	"math/rand"
+	"time"
+)
+
+// BackoffStrategy determines the delay before a given attempt of an operation being
+// retried, starting at 1; used for both connection recovery and request retries
+type BackoffStrategy interface {
+	NextDelay(attempt int) time.Duration
+}
+
+// BackoffFunc is an adapter to allow the use of ordinary functions as backoff strategies
+type BackoffFunc func(attempt int) time.Duration
+
+// NextDelay returns f(attempt)
+func (f BackoffFunc) NextDelay(attempt int) time.Duration {
+	return f(attempt)
+}
+
+// ExponentialBackoff is a backoff strategy where the delay starts at 'Initial' and is
+// multiplied on every attempt up to 'Max', optionally adding a random jitter
+type ExponentialBackoff struct {
+	// Delay before the first attempt, defaults to 1 second
+	Initial time.Duration
+
+	// Max delay between attempts, defaults to 1 minute
+	Max time.Duration
+
+	// Factor applied to the delay after every attempt, defaults to 2
+	Multiplier float64
+
+	// If provided, every delay is increased by a random amount of time within
+	// the window
+	Jitter time.Duration
+}
+
+// NextDelay returns the delay before a given attempt
+func (b *ExponentialBackoff) NextDelay(attempt int) time.Duration {
+	d := float64(b.Initial)
+	if d <= 0 {
+		d = float64(time.Second)
+	}
+	max := float64(b.Max)
+	if max <= 0 {
+		max = float64(time.Minute)
+	}
+	m := b.Multiplier
+	if m <= 0 {
+		m = 2
+	}
+	for i := 1; i < attempt && d < max; i++ {
+		d *= m
+	}
+	if d > max {
+		d = max
+	}
+	if b.Jitter > 0 {
+		/* #nosec */
+		d += float64(rand.Int63n(int64(b.Jitter)))
+	}
+	return time.Duration(d)
+}
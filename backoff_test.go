@@ -0,0 +1,29 @@
+package electrum
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &ExponentialBackoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 3}
+	for attempt, d := range map[int]time.Duration{1: time.Second, 2: 3 * time.Second, 3: 9 * time.Second, 4: 10 * time.Second} {
+		if got := b.NextDelay(attempt); got != d {
+			t.Errorf("attempt %d: unexpected delay %s", attempt, got)
+		}
+	}
+	b.Jitter = time.Second
+	if d := b.NextDelay(1); d < time.Second || d >= 2*time.Second {
+		t.Errorf("delay out of jitter window: %s", d)
+	}
+}
+
+func TestCustomBackoff(t *testing.T) {
+	constant := BackoffFunc(func(int) time.Duration { return time.Millisecond })
+	if d := (&RetryPolicy{Strategy: constant}).delay(5); d != time.Millisecond {
+		t.Errorf("unexpected retry delay: %s", d)
+	}
+	if d := (&ReconnectOptions{Backoff: constant}).delay(5); d != time.Millisecond {
+		t.Errorf("unexpected reconnect delay: %s", d)
+	}
+}
@@ -0,0 +1,117 @@
+package electrum
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Prefix used for ban entries on the store
+const banPrefix = "ban/"
+
+// ErrBannedServer is returned when trying to connect to a server currently banned
+var ErrBannedServer = errors.New("BANNED_SERVER")
+
+// Ban records the decision to avoid a given server for some time
+type Ban struct {
+	// Address of the banned server
+	Server string `json:"server"`
+
+	// Reason for the ban
+	Reason string `json:"reason"`
+
+	// Time when the ban expires
+	Expiry time.Time `json:"expiry"`
+}
+
+// BanList keeps track of banned servers, persisting the entries on a store so the
+// decisions survive process restarts
+type BanList struct {
+	store Store
+}
+
+// NewBanList returns a ban list using the provided store, defaults to a memory store
+func NewBanList(store Store) *BanList {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &BanList{store: store}
+}
+
+// Ban will register the server as banned for the given duration, replacing any
+// existing ban entry for it. Servers are identified by their 'host:port' address,
+// regardless of the scheme or path used to reach them
+func (bl *BanList) Ban(server, reason string, d time.Duration) error {
+	server = banAddress(server)
+	b, err := json.Marshal(&Ban{Server: server, Reason: reason, Expiry: time.Now().Add(d)})
+	if err != nil {
+		return err
+	}
+	return bl.store.Put(banPrefix+server, b)
+}
+
+// Unban removes the ban entry for the server, if any
+func (bl *BanList) Unban(server string) error {
+	return bl.store.Delete(banPrefix + banAddress(server))
+}
+
+// Get returns the active ban entry for the server, nil if not banned; expired
+// entries are removed from the store
+func (bl *BanList) Get(server string) (*Ban, error) {
+	server = banAddress(server)
+	v, err := bl.store.Get(banPrefix + server)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := &Ban{}
+	if err := json.Unmarshal(v, b); err != nil {
+		return nil, err
+	}
+	if time.Now().After(b.Expiry) {
+		return nil, bl.Unban(server)
+	}
+	return b, nil
+}
+
+// IsBanned returns true if the server has an active ban entry; failures to read the
+// store are reported as not banned, use Get to detect them
+func (bl *BanList) IsBanned(server string) bool {
+	b, err := bl.Get(server)
+	return err == nil && b != nil
+}
+
+// List returns all active ban entries
+func (bl *BanList) List() ([]*Ban, error) {
+	keys, err := bl.store.Keys(banPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Ban
+	for _, k := range keys {
+		b, err := bl.Get(k[len(banPrefix):])
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			list = append(list, b)
+		}
+	}
+	return list, nil
+}
+
+// Normalize a server address to the 'host:port' form used to identify ban entries, e.g.
+// 'ssl://Example.com:50002' and 'example.com:50002' refer to the same server
+func banAddress(server string) string {
+	if opts, err := parseAddress(server, nil); err == nil {
+		server = opts.address
+	}
+	if host, port, err := net.SplitHostPort(server); err == nil {
+		return net.JoinHostPort(strings.ToLower(host), port)
+	}
+	return server
+}
@@ -0,0 +1,72 @@
+package electrum
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBanList(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bl := NewBanList(store)
+	if err := bl.Ban("bad.example.com:50002", "invalid headers", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.Ban("old.example.com:50002", "timeouts", -time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries survive on a new list using the same store
+	bl = NewBanList(store)
+	if !bl.IsBanned("bad.example.com:50002") {
+		t.Error("server not banned")
+	}
+	if bl.IsBanned("old.example.com:50002") {
+		t.Error("expired ban still active")
+	}
+	list, err := bl.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Reason != "invalid headers" {
+		t.Errorf("unexpected ban list: %+v", list)
+	}
+
+	if _, err := New(&Options{Address: "bad.example.com:50002", BanList: bl}); err != ErrBannedServer {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Servers are matched regardless of the scheme used to reach them
+	if err := bl.Ban("ssl://Other.example.com:50002", "invalid headers", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if !bl.IsBanned("other.example.com:50002") || !bl.IsBanned("wss://other.example.com:50002/electrum") {
+		t.Error("server not banned")
+	}
+	if _, err := New(&Options{Address: "tcp://bad.example.com:50002", BanList: bl}); err != ErrBannedServer {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := bl.Unban("tcp://other.example.com:50002"); err != nil || bl.IsBanned("other.example.com:50002") {
+		t.Errorf("ban not removed: %v", err)
+	}
+
+	// Failures to check the ban list are reported
+	errStore := errors.New("store failure")
+	bl = NewBanList(&failingStore{Store: NewMemoryStore(), err: errStore})
+	if _, err := New(&Options{Address: "bad.example.com:50002", BanList: bl}); err != errStore {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// Store failing every read with the provided error
+type failingStore struct {
+	Store
+	err error
+}
+
+func (s *failingStore) Get(key string) ([]byte, error) {
+	return nil, s.err
+}
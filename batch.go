@@ -0,0 +1,250 @@
+package electrum
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// Default batching settings for multi-item operations
+const (
+	defaultBatchSize        = 50
+	defaultBatchConcurrency = 4
+)
+
+// TransactionResult holds the outcome of fetching a single transaction as part
+// of a multi-item operation
+type TransactionResult struct {
+	// Requested transaction identifier
+	Hash string
+
+	// Hex-encoded transaction, empty on failure
+	Hex string
+
+	// Error produced while fetching the transaction, if any
+	Err error
+}
+
+// Check if a message is a batch response, i.e. a JSON array
+func isBatch(m []byte) bool {
+	m = bytes.TrimLeft(m, " \t\r")
+	return len(m) > 0 && m[0] == '['
+}
+
+// Split a batch response and route each of its items
+func (c *Client) routeBatch(s *session, m []byte) {
+	var batch []*response
+	if err := c.codec.Unmarshal(m, &batch); err != nil || len(batch) == 0 {
+		return
+	}
+	for _, resp := range batch {
+		if resp == nil {
+			continue
+		}
+		if c.debug {
+			resp.raw = m
+		}
+		resp.size = len(m) / len(batch)
+		c.route(s, resp)
+	}
+}
+
+// Deliver an error response without identifier to the batches in flight, as servers answer
+// a batch they can't process, e.g. one exceeding their limits, with a single error object
+// instead of an array; returns false if the message is not such a response
+func (c *Client) routeBatchError(s *session, m []byte, resp *response) bool {
+	if resp.Error == nil || resp.Method != "" || resp.ID != 0 {
+		return false
+	}
+	c.Lock()
+	pending := make([]*subscription, 0, len(c.batches))
+	for b := range c.batches {
+		pending = append(pending, b)
+	}
+	c.Unlock()
+	if len(pending) == 0 {
+		return false
+	}
+	var msg struct {
+		ID *int `json:"id"`
+	}
+	if err := c.codec.Unmarshal(m, &msg); err != nil || msg.ID != nil {
+		return false
+	}
+	for _, b := range pending {
+		c.deliver(b, resp, s.ctx.Done())
+	}
+	return true
+}
+
+// Dispatch several requests as a single JSON-RPC batch and wait for all their results;
+// the returned responses match the order of the requests, with a nil value for any
+// request not answered before the context is done or the connection is closed. If the
+// server rejects the whole batch, its error is set on the response of every request
+func (c *Client) batchRequest(ctx context.Context, reqs []*request) (results []*response, err error) {
+	start := time.Now()
+	defer func() {
+		for i, req := range reqs {
+			if results != nil && results[i] != nil {
+				c.reportCall(req, start, results[i], nil)
+			} else {
+				c.reportCall(req, start, nil, c.callError(req, err))
+			}
+		}
+	}()
+
+	for _, req := range reqs {
+		if err = c.supports(req.Method); err != nil {
+			return nil, err
+		}
+	}
+	if err = c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.calls.Done()
+	if err = chargeRequests(ctx, len(reqs)); err != nil {
+		return nil, err
+	}
+	if err = c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	subs := make([]*subscription, len(reqs))
+	rejected := newSubscription(ctx)
+	c.Lock()
+	for i, req := range reqs {
+		subs[i] = newSubscription(ctx)
+		c.subs[req.ID] = subs[i]
+	}
+	c.batches[rejected] = struct{}{}
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		for _, req := range reqs {
+			c.removeSubscriptionLocked(req.ID)
+		}
+		delete(c.batches, rejected)
+		rejected.cancel(nil)
+		c.Unlock()
+	}()
+
+	if err = c.dispatchBatch(reqs); err != nil {
+		return nil, err
+	}
+
+	// Collect the results
+	timeout := c.requestTimer()
+	defer timeout.Stop()
+	results = make([]*response, len(reqs))
+	for i, sub := range subs {
+		select {
+		case r := <-sub.messages:
+			r.req = reqs[i]
+			results[i] = r
+		case r := <-rejected.messages:
+			for j := i; j < len(reqs); j++ {
+				results[j] = &response{ID: reqs[j].ID, Error: r.Error, req: reqs[j]}
+			}
+			return results, nil
+		case <-timeout.C:
+			return results, ErrTimeout
+		case <-sub.ctx.Done():
+			if err := ctx.Err(); err != nil {
+				return results, err
+			}
+			return results, ErrConnClosed
+		}
+	}
+	return results, nil
+}
+
+// GetTransactions will fetch several transactions by running 'blockchain.transaction.get'
+// operations in JSON-RPC batches, with a bounded number of batches in flight; results are
+// returned in the order of the provided hashes, each with its own error if any. The
+// returned error is only set if the context is done before completion
+func (c *Client) GetTransactions(ctx context.Context, hashes []string) ([]TransactionResult, error) {
+	results := make([]TransactionResult, len(hashes))
+	for i, hash := range hashes {
+		results[i].Hash = hash
+	}
+
+	size := c.batchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	concurrency := c.batchWorkers
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for start := 0; start < len(results); start += size {
+		end := start + size
+		if end > len(results) {
+			end = len(results)
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(batch []TransactionResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			c.fetchTransactions(ctx, batch)
+		}(results[start:end])
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		for i := range results {
+			if results[i].Hex == "" && results[i].Err == nil {
+				results[i].Err = err
+			}
+		}
+		return results, err
+	}
+	return results, nil
+}
+
+// Fetch a batch of transactions, setting the result or error of each item
+func (c *Client) fetchTransactions(ctx context.Context, batch []TransactionResult) {
+	reqs := make([]*request, len(batch))
+	for i := range batch {
+		reqs[i] = c.req("blockchain.transaction.get", batch[i].Hash)
+	}
+	responses, err := c.batchRequest(ctx, reqs)
+	for i, res := range responses {
+		if res == nil {
+			continue
+		}
+		if res.Error != nil {
+			batch[i].Err = c.resError(res)
+			continue
+		}
+		var tx string
+		if err := c.decode(res, &tx); err != nil {
+			batch[i].Err = err
+			continue
+		}
+		if c.verify {
+			if id, err := TxID(tx); err != nil || id != batch[i].Hash {
+				batch[i].Err = c.callError(res.req, ErrServerMismatch)
+				continue
+			}
+		}
+		batch[i].Hex = tx
+	}
+	if err != nil {
+		for i := range batch {
+			if batch[i].Hex == "" && batch[i].Err == nil {
+				batch[i].Err = c.callError(reqs[i], err)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package electrum
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+func TestGetTransactions(t *testing.T) {
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("blockchain.transaction.get", func(params []json.RawMessage) (interface{}, error) {
+		var hash string
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(hash, "missing") {
+			return nil, &electrumtest.Error{Code: 2, Message: "unknown transaction"}
+		}
+		return "tx-" + hash, nil
+	})
+	client, err := New(&Options{
+		Address:          srv.Addr(),
+		BatchSize:        10,
+		BatchConcurrency: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var hashes []string
+	for i := 0; i < 95; i++ {
+		if i%10 == 3 {
+			hashes = append(hashes, fmt.Sprintf("missing-%d", i))
+			continue
+		}
+		hashes = append(hashes, fmt.Sprint(i))
+	}
+	results, err := client.GetTransactions(context.Background(), hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(hashes) {
+		t.Fatalf("unexpected results count: %d", len(results))
+	}
+	for i, r := range results {
+		if r.Hash != hashes[i] {
+			t.Fatalf("unexpected result order: %+v", r)
+		}
+		if i%10 == 3 {
+			if r.Err == nil || r.Hex != "" {
+				t.Errorf("expected error for %s: %+v", r.Hash, r)
+			}
+			continue
+		}
+		if r.Err != nil || r.Hex != "tx-"+r.Hash {
+			t.Errorf("unexpected result: %+v", r)
+		}
+	}
+
+	// Cancelled operations report the context error for every pending item
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = client.GetTransactions(ctx, hashes)
+	if err != context.Canceled || results[0].Err != context.Canceled {
+		t.Errorf("unexpected result: %v", err)
+	}
+}
+
+func TestGetTransactionsVerified(t *testing.T) {
+	segwitID, _ := TxID(strippedTx)
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("blockchain.transaction.get", func(params []json.RawMessage) (interface{}, error) {
+		if string(params[0]) == `"`+segwitID+`"` {
+			return segwitTx, nil
+		}
+		return genesisCoinbase, nil
+	})
+	client, err := New(&Options{
+		Address:         srv.Addr(),
+		VerifyResponses: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	results, err := client.GetTransactions(context.Background(), []string{genesisCoinbaseID, segwitID, "0000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[1].Err != nil || results[1].Hex != segwitTx {
+		t.Errorf("unexpected results: %+v, %+v", results[0], results[1])
+	}
+	if !errors.Is(results[2].Err, ErrServerMismatch) {
+		t.Errorf("unexpected error: %v", results[2].Err)
+	}
+}
+
+func TestBatchRejected(t *testing.T) {
+	// Server answering batches with a single error object instead of an array
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			res := `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch too large"}}`
+			if line[0] != '[' {
+				req := &request{}
+				if err := json.Unmarshal(line, req); err != nil {
+					return
+				}
+				res = mockResult(req)[0]
+			}
+			if _, err := conn.Write([]byte(res + "\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	client, err := New(&Options{Address: ln.Addr().String(), RequestTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	results, err := client.GetTransactions(context.Background(), []string{"aa", "bb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		var re *RPCError
+		if !errors.As(r.Err, &re) || re.Code != -32600 {
+			t.Errorf("unexpected result: %+v", r)
+		}
+	}
+}
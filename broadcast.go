@@ -0,0 +1,254 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix used for the queued transactions on the store
+const broadcastPrefix = "broadcast/"
+
+// Rejection reasons reported by the daemon for transactions it already knows about,
+// e.g. accepted on a previous attempt whose response was lost
+var knownTxReasons = []string{
+	"txn-already-in-mempool",
+	"txn-already-known",
+	"already in mempool",
+	"already in block chain",
+	"already in utxo set",
+}
+
+// QueuedTx is a raw transaction waiting to be accepted by the server
+type QueuedTx struct {
+	// Transaction identifier, calculated from the raw transaction
+	ID string `json:"id"`
+
+	// Raw transaction in hex format
+	Hex string `json:"hex"`
+
+	// Number of broadcast attempts performed so far
+	Attempts int `json:"attempts"`
+
+	// Time the transaction was added to the queue
+	Added time.Time `json:"added"`
+}
+
+// BroadcastResult reports the terminal state of a queued transaction; a nil
+// error value means the transaction was accepted by the server
+type BroadcastResult struct {
+	Tx  *QueuedTx
+	Err error
+}
+
+// BroadcastQueueOptions define the available configuration options for a broadcast queue
+type BroadcastQueueOptions struct {
+	// Store used to persist queued transactions, defaults to a memory store
+	Store Store
+
+	// Interval between broadcast attempts for pending transactions, defaults to 30 seconds
+	RetryInterval time.Duration
+
+	// If set, transactions will be dropped with ErrMaxAttempts after the given number
+	// of failed attempts
+	MaxAttempts int
+}
+
+// ErrMaxAttempts is reported for queued transactions that couldn't be delivered
+// within the max number of attempts allowed
+var ErrMaxAttempts = errors.New("MAX_ATTEMPTS")
+
+// BroadcastQueue persists raw transactions and retries their broadcast until the server
+// accepts or rejects them, so transactions are not lost on network failures or
+// process restarts
+type BroadcastQueue struct {
+	client  *Client
+	opts    BroadcastQueueOptions
+	results chan *BroadcastResult
+	wake    chan struct{}
+	mu      sync.Mutex
+}
+
+// NewBroadcastQueue returns a queue that will use the provided client instance to
+// broadcast transactions
+func NewBroadcastQueue(client *Client, options *BroadcastQueueOptions) *BroadcastQueue {
+	opts := BroadcastQueueOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	if opts.RetryInterval == 0 {
+		opts.RetryInterval = 30 * time.Second
+	}
+	return &BroadcastQueue{
+		client:  client,
+		opts:    opts,
+		results: make(chan *BroadcastResult),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Trigger a new processing round without waiting for the retry interval
+func (q *BroadcastQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue persists a raw transaction for its broadcast; the transaction will be
+// submitted right away when the queue is running
+func (q *BroadcastQueue) Enqueue(rawTx string) (*QueuedTx, error) {
+	id, err := TxID(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	tx := &QueuedTx{ID: id, Hex: rawTx, Added: time.Now()}
+	if err := q.save(tx); err != nil {
+		return nil, err
+	}
+	q.notify()
+	return tx, nil
+}
+
+// Pending returns the list of transactions waiting to be accepted
+func (q *BroadcastQueue) Pending() ([]*QueuedTx, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	keys, err := q.opts.Store.Keys(broadcastPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var list []*QueuedTx
+	for _, k := range keys {
+		b, err := q.opts.Store.Get(k)
+		if err != nil {
+			continue
+		}
+		tx := &QueuedTx{}
+		if err := json.Unmarshal(b, tx); err != nil {
+			continue
+		}
+		list = append(list, tx)
+	}
+	return list, nil
+}
+
+// Results returns the channel used to report transactions reaching a terminal state,
+// i.e. accepted, rejected or dropped after too many attempts
+func (q *BroadcastQueue) Results() <-chan *BroadcastResult {
+	return q.results
+}
+
+// Run processes pending transactions, including the ones persisted by previous
+// executions, until the provided context is done, which also cancels any broadcast
+// in progress; the results channel is closed when returning
+func (q *BroadcastQueue) Run(ctx context.Context) {
+	defer close(q.results)
+
+	// Retry pending transactions as soon as the connection is recovered
+	stop := q.client.OnStateChange(func(s ConnectionState) {
+		if s == Reconnected {
+			q.notify()
+		}
+	})
+	defer stop()
+	t := time.NewTicker(q.opts.RetryInterval)
+	defer t.Stop()
+	for {
+		pending, err := q.Pending()
+		if err == nil {
+			for _, tx := range pending {
+				if res := q.attempt(ctx, tx); res != nil {
+					select {
+					case q.results <- res:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+		select {
+		case <-t.C:
+		case <-q.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Submit a queued transaction, returns a result when it reaches a terminal state;
+// transactions the daemon already knows about are reported as accepted
+func (q *BroadcastQueue) attempt(ctx context.Context, tx *QueuedTx) *BroadcastResult {
+	tx.Attempts++
+	_, err := q.client.BroadcastTransactionContext(ctx, tx.Hex)
+	switch {
+	case err == nil, knownTx(err):
+		return q.finish(tx, nil)
+	case errors.Is(err, ErrRejectedTx):
+		return q.finish(tx, err)
+	case ctx.Err() != nil:
+		// Interrupted by the queue stopping, not counted as an attempt
+		tx.Attempts--
+	case q.opts.MaxAttempts > 0 && tx.Attempts >= q.opts.MaxAttempts:
+		return q.finish(tx, ErrMaxAttempts)
+	}
+
+	// Transient failure, keep the transaction for the next attempt
+	/* #nosec */
+	q.save(tx)
+	return nil
+}
+
+// Check if a broadcast was rejected because the transaction is already in the mempool
+// or in the chain
+func knownTx(err error) bool {
+	var rejected *RejectedTxError
+	if !errors.As(err, &rejected) {
+		return false
+	}
+	reason := strings.ToLower(rejected.Reason)
+	for _, known := range knownTxReasons {
+		if strings.Contains(reason, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove a transaction from the queue and build its result
+func (q *BroadcastQueue) finish(tx *QueuedTx, err error) *BroadcastResult {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	/* #nosec */
+	q.opts.Store.Delete(broadcastPrefix + tx.ID)
+	return &BroadcastResult{Tx: tx, Err: err}
+}
+
+// Persist a queued transaction
+func (q *BroadcastQueue) save(tx *QueuedTx) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	return q.opts.Store.Put(broadcastPrefix+tx.ID, b)
+}
+
+// TxID returns the identifier of a raw transaction in hex format, i.e. the double
+// SHA-256 hash of its contents in reversed byte order; for segwit transactions the
+// witness data is excluded, as done by the network. Fails with ErrInvalidTx if the
+// transaction can't be decoded
+func TxID(rawTx string) (string, error) {
+	tx, err := parseTx(rawTx)
+	if err != nil {
+		return "", err
+	}
+	return tx.id, nil
+}
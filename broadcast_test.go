@@ -0,0 +1,247 @@
+package electrum
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+const genesisCoinbase = "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+
+const genesisCoinbaseID = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+
+// Segregated witness transaction, and the same transaction without the marker, flag
+// and witness data
+const (
+	segwitTx = "01000000" + "0001" + "01" + "cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd" + "00000000" +
+		"00" + "ffffffff" + "01" + "e803000000000000" + "0151" + "01" + "02" + "abcd" + "00000000"
+	strippedTx = "01000000" + "01" + "cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd" + "00000000" +
+		"00" + "ffffffff" + "01" + "e803000000000000" + "0151" + "00000000"
+)
+
+func TestTxID(t *testing.T) {
+	id, err := TxID(genesisCoinbase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != genesisCoinbaseID {
+		t.Errorf("unexpected transaction id: %s", id)
+	}
+	if _, err := TxID("invalid"); err == nil {
+		t.Error("expected error for invalid hex")
+	}
+
+	// Segregated witness data is not part of the transaction id
+	want, err := TxID(strippedTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := TxID(segwitTx); err != nil || id != want {
+		t.Errorf("unexpected segwit transaction id: %s, %v", id, err)
+	}
+	raw, _ := hex.DecodeString(segwitTx)
+	if want == reverseHex(doubleSHA256(raw)) {
+		t.Error("witness transaction id returned")
+	}
+}
+
+func TestBroadcastQueue(t *testing.T) {
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("blockchain.transaction.broadcast", func(params []json.RawMessage) (interface{}, error) {
+		if string(params[0]) != `"`+genesisCoinbase+`"` {
+			return nil, &electrumtest.Error{Code: 1, Message: "rejected"}
+		}
+		return genesisCoinbaseID, nil
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	store := NewMemoryStore()
+	q := NewBroadcastQueue(client, &BroadcastQueueOptions{Store: store})
+	if _, err := q.Enqueue(genesisCoinbase); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(mockTx(strings.Repeat("ab", 32), 0, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := q.Pending(); len(pending) != 2 {
+		t.Fatalf("unexpected pending list: %v", pending)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(stopped)
+	}()
+	for i := 0; i < 2; i++ {
+		res := <-q.Results()
+		switch res.Tx.Hex {
+		case genesisCoinbase:
+			if res.Err != nil {
+				t.Errorf("unexpected error: %s", res.Err)
+			}
+		default:
+			if !errors.Is(res.Err, ErrRejectedTx) {
+				t.Errorf("unexpected error: %v", res.Err)
+			}
+		}
+	}
+	if keys, _ := store.Keys(broadcastPrefix); len(keys) != 0 {
+		t.Errorf("transactions not removed from store: %v", keys)
+	}
+
+	// Transactions already known by the daemon, e.g. accepted on an attempt whose
+	// response was lost, are reported as accepted
+	for _, reason := range []string{
+		"the transaction was rejected by network rules.\n\ntxn-already-in-mempool\n[0100]",
+		"Transaction already in block chain",
+	} {
+		srv.HandleError("blockchain.transaction.broadcast", 1, reason)
+		if _, err := q.Enqueue(genesisCoinbase); err != nil {
+			t.Fatal(err)
+		}
+		if res := <-q.Results(); res.Err != nil {
+			t.Errorf("unexpected error: %v", res.Err)
+		}
+	}
+
+	// The state listener is removed once the queue stops
+	cancel()
+	<-stopped
+	client.Lock()
+	watchers := len(client.watchers)
+	client.Unlock()
+	if watchers != 0 {
+		t.Errorf("state listener not removed: %d", watchers)
+	}
+}
+
+func TestBroadcastQueueStop(t *testing.T) {
+	// Broadcasts are only answered once the test completes
+	srv := newTestServer(t, nil)
+	unanswered := make(chan struct{})
+	srv.HandleFunc("blockchain.transaction.broadcast", func([]json.RawMessage) (interface{}, error) {
+		<-unanswered
+		return genesisCoinbaseID, nil
+	})
+	t.Cleanup(func() { close(unanswered) })
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	q := NewBroadcastQueue(client, nil)
+	if _, err := q.Enqueue(genesisCoinbase); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Stopping the queue cancels the broadcast in progress, keeping the transaction
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast in progress not cancelled")
+	}
+	pending, err := q.Pending()
+	if err != nil || len(pending) != 1 || pending[0].Attempts != 0 {
+		t.Errorf("unexpected pending list: %v, %v", pending, err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("a/1", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("b/1", []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get("a/1"); err != nil || string(v) != "one" {
+		t.Errorf("unexpected value: %s, %v", v, err)
+	}
+	if keys, _ := s.Keys("a/"); len(keys) != 1 || keys[0] != "a/1" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+	if err := s.Delete("a/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("a/1"); err != ErrNotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBroadcastTransaction(t *testing.T) {
+	segwitID, err := TxID(strippedTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("blockchain.transaction.broadcast", func(params []json.RawMessage) (interface{}, error) {
+		var tx string
+		if err := json.Unmarshal(params[0], &tx); err != nil {
+			return nil, err
+		}
+		switch tx {
+		case genesisCoinbase:
+			return genesisCoinbaseID, nil
+		case segwitTx:
+			return segwitID, nil
+		case "00":
+			return nil, &electrumtest.Error{Code: 1, Message: "the transaction was rejected by network rules.\n\nmissing-inputs\n[00]"}
+		case "01":
+			return "258: txn-mempool-conflict", nil
+		default:
+			return nil, &electrumtest.Error{Code: -102, Message: "server busy"}
+		}
+	})
+	client, err := New(&Options{Address: srv.Addr(), VerifyResponses: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if txid, err := client.BroadcastTransaction(genesisCoinbase); err != nil || txid != genesisCoinbaseID {
+		t.Errorf("unexpected result: %s, %v", txid, err)
+	}
+
+	// Segregated witness transactions are identified without their witness data
+	if txid, err := client.BroadcastTransaction(segwitTx); err != nil || txid != segwitID {
+		t.Errorf("unexpected result: %s, %v", txid, err)
+	}
+
+	// Rejections reported as error objects and as result messages
+	for hex, reason := range map[string]string{"00": "missing-inputs", "01": "258: txn-mempool-conflict"} {
+		_, err := client.BroadcastTransaction(hex)
+		var re *RejectedTxError
+		if !errors.Is(err, ErrRejectedTx) || !errors.As(err, &re) || re.Reason != reason {
+			t.Errorf("%s: unexpected error: %v", hex, err)
+		}
+	}
+
+	// Errors unrelated to the transaction
+	if _, err := client.BroadcastTransaction("02"); errors.Is(err, ErrRejectedTx) || !errors.Is(err, ErrServerBusy) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
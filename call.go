@@ -0,0 +1,23 @@
+package electrum
+
+import "context"
+
+// Call will synchronously run an arbitrary protocol operation, decoding its result
+// into a value of type T; useful for methods not directly supported by the client.
+// Errors are reported the same way as for the built-in operations
+func Call[T any](c *Client, ctx context.Context, method string, params ...interface{}) (T, error) {
+	var result T
+	res, err := c.syncRequest(ctx, c.req(method, params...))
+	if err != nil {
+		return result, err
+	}
+
+	if res.Error != nil {
+		return result, c.resError(res)
+	}
+
+	if err := c.decode(res, &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
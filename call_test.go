@@ -0,0 +1,37 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"blockchain.scripthash.get_balance": `{"confirmed":1200,"unconfirmed":-200}`,
+		"server.banner":                     `"Welcome"`,
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	balance, err := Call[Balance](client, context.Background(), "blockchain.scripthash.get_balance", "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Confirmed != 1200 || balance.Unconfirmed != -200 {
+		t.Errorf("unexpected result: %+v", balance)
+	}
+
+	banner, err := Call[string](client, context.Background(), "server.banner")
+	if err != nil || banner != "Welcome" {
+		t.Errorf("unexpected result: %q, %v", banner, err)
+	}
+
+	// Results not matching the expected type
+	if _, err := Call[int](client, context.Background(), "server.banner"); !errors.Is(err, ErrInvalidResult) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package electrum
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// Direction markers used on captured protocol lines
+const (
+	captureOut = ">>"
+	captureIn  = "<<"
+)
+
+// Writes raw protocol messages to a sink, one line per message prefixed by
+// its timestamp and direction
+type capture struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func newCapture(w io.Writer) *capture {
+	if w == nil {
+		return nil
+	}
+	return &capture{w: w}
+}
+
+// Record a single message; write failures are ignored to avoid disrupting
+// the communication with the server
+func (c *capture) record(direction string, m []byte) {
+	if c == nil {
+		return
+	}
+	line := make([]byte, 0, len(m)+40)
+	line = time.Now().UTC().AppendFormat(line, time.RFC3339Nano)
+	line = append(line, ' ')
+	line = append(line, direction...)
+	line = append(line, ' ')
+	line = append(line, bytes.TrimRight(m, "\r\n")...)
+	line = append(line, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	/* #nosec */
+	c.w.Write(line)
+}
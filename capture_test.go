@@ -0,0 +1,34 @@
+package electrum
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	out := &syncBuffer{}
+	client, err := New(&Options{
+		Address: newTestServer(t, map[string]string{"server.banner": `"Welcome"`}).Addr(),
+		Capture: out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServerBanner(); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected capture: %q", lines)
+	}
+	for i, expected := range []string{
+		` >> {"jsonrpc":"2.0","id":0,"method":"server.banner","params":[]}`,
+		` << {"jsonrpc":"2.0","id":0,"result":"Welcome"}`,
+	} {
+		if !strings.HasSuffix(lines[i], expected) {
+			t.Errorf("unexpected line: %s", lines[i])
+		}
+	}
+}
@@ -1,15 +1,19 @@
 package electrum
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"math/rand"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,23 +25,48 @@ const (
 	Protocol10 = "1.0"
 	Protocol11 = "1.1"
 	Protocol12 = "1.2"
+	Protocol13 = "1.3"
+	Protocol14 = "1.4"
 )
 
 // Common errors
 var (
-	ErrDeprecatedMethod  = errors.New("DEPRECATED_METHOD")
-	ErrUnavailableMethod = errors.New("UNAVAILABLE_METHOD")
-	ErrRejectedTx        = errors.New("REJECTED_TRANSACTION")
-	ErrUnreachableHost   = errors.New("UNREACHABLE_HOST")
+	ErrDeprecatedMethod     = errors.New("DEPRECATED_METHOD")
+	ErrUnavailableMethod    = errors.New("UNAVAILABLE_METHOD")
+	ErrRejectedTx           = errors.New("REJECTED_TRANSACTION")
+	ErrUnreachableHost      = errors.New("UNREACHABLE_HOST")
+	ErrConnClosed           = errors.New("CONNECTION_CLOSED")
+	ErrTooManySubscriptions = errors.New("TOO_MANY_SUBSCRIPTIONS")
+	ErrInvalidResult        = errors.New("INVALID_RESULT")
+	ErrServerMismatch       = errors.New("SERVER_MISMATCH")
+	ErrAlreadyStarted       = errors.New("ALREADY_STARTED")
+	ErrTimeout              = errors.New("TIMEOUT")
+	ErrBusy                 = errors.New("BUSY")
+	ErrClientClosed         = errors.New("CLIENT_CLOSED")
+	ErrUnsubscribed         = errors.New("UNSUBSCRIBED")
+	ErrSlowConsumer         = errors.New("SLOW_CONSUMER")
 )
 
+// Default max time to wait for the response of a synchronous operation
+const defaultRequestTimeout = 30 * time.Second
+
+// Default max time to establish a connection with the server
+const defaultConnectTimeout = 30 * time.Second
+
+// Default interval between keep-alive operations
+const defaultKeepAliveInterval = 60 * time.Second
+
+// Default number of consecutive failed keep-alive operations tolerated
+const defaultKeepAliveFailures = 3
+
 // Message Delimiter, according to the protocol specification
 // http://docs.electrum.org/en/latest/protocol.html#format
 const delimiter = byte('\n')
 
 // Options define the available configuration options
 type Options struct {
-	// Address of the server to use for network communications
+	// Address of the server to use for network communications; either a plain 'host:port'
+	// value or an URL using one of the supported schemes: 'tcp', 'ssl', 'ws' or 'wss'
 	Address string
 
 	// Version advertised by the client instance
@@ -46,19 +75,202 @@ type Options struct {
 	// Protocol version preferred by the client instance
 	Protocol string
 
-	// If set to true, will enable the client to continuously dispatch
-	// a 'server.version' operation every 60 seconds
+	// Min protocol version supported by the client instance; for protocol 1.1 and newer
+	// the [ProtocolMin, Protocol] range is advertised to the server, letting it select the
+	// best mutually supported version. Defaults to the preferred protocol version
+	ProtocolMin string
+
+	// If set to true, the protocol version is negotiated with the server when the client is
+	// started, advertising the [ProtocolMin, Protocol] range; methods are then enabled according
+	// to the version selected by the server. In this mode the range defaults to [1.0, 1.4]
+	NegotiateProtocol bool
+
+	// If provided, will be used to create the transport of every session, from Start
+	// to Stop, instead of the default one; network related options are ignored
+	Transport func(ctx context.Context) (Transport, error)
+
+	// If provided, will be used to establish the network connections with the server
+	// instead of the default dialer, e.g. to route them through a proxy
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// If provided, connections are established through the SOCKS5 proxy, e.g. a Tor
+	// client; '.onion' servers are reached through a local Tor client by default
+	Proxy *ProxyOptions
+
+	// Max time to establish a connection with the server, including any TLS or WebSocket
+	// handshake, defaults to 30 seconds; a negative value disables the limit
+	ConnectTimeout time.Duration
+
+	// Period of the TCP keep-alive probes sent on the connection, defaults to 30 seconds;
+	// a negative value disables them
+	TCPKeepAlive time.Duration
+
+	// If set to true, Nagle's algorithm is enabled on the connection, i.e. TCP_NODELAY
+	// is disabled, trading latency for fewer packets
+	TCPDelay bool
+
+	// If provided, will be used as local address for the connection, e.g. to select the
+	// network interface on multi-homed hosts; either an IP address or an 'ip:port' value
+	LocalAddr string
+
+	// If set, the connection is considered dead and recovered when no data is received
+	// from the server during the given period; should be longer than the keep-alive
+	// interval, which ensures regular traffic
+	ReadIdleTimeout time.Duration
+
+	// If set, will limit the time spent writing each message to the connection
+	WriteTimeout time.Duration
+
+	// If provided, will be used to recover dropped connections; by default reconnection
+	// is attempted every 5 seconds with no limit
+	Reconnect *ReconnectOptions
+
+	// If set to true, will enable the client to continuously dispatch a 'server.ping'
+	// operation, or 'server.version' on protocol versions not supporting it
 	KeepAlive bool
 
+	// Interval between keep-alive operations, defaults to 60 seconds
+	KeepAliveInterval time.Duration
+
+	// Number of consecutive failed keep-alive operations after which the connection is
+	// considered dead and recovered, defaults to 3; a negative value disables the check.
+	// Only supported by the default transport
+	KeepAliveFailures int
+
+	// If provided, every keep-alive operation will be delayed by a random amount of
+	// time within the window, to prevent clients created at the same time from
+	// contacting the server in lockstep
+	KeepAliveJitter time.Duration
+
 	// Agent identifier that will be transmitted to the server when required;
 	// will be concatenated with the client version
 	Agent string
 
+	// If provided, will be used to build the client identifier transmitted on
+	// 'server.version' operations instead of the default "agent-version" format
+	AgentFormat func(agent, version string) string
+
 	// If provided, will be used to setup a secure network connection with the server
 	TLS *tls.Config
 
-	// If provided, will be used as logging sink
-	Log *log.Logger
+	// If provided, the server certificate is verified against this hex-encoded SHA-256
+	// fingerprint, of either the leaf certificate or its public key info, instead of the
+	// system roots; provides transport security for servers using self-signed certificates.
+	// A 'VerifyConnection' callback set on the 'TLS' configuration runs after the pin is
+	// matched. Implies the use of a secure connection
+	TLSPin string
+
+	// If provided, server certificates are verified using trust on first use: the certificate
+	// presented on the first connection to a server is recorded on the store and connections
+	// presenting a different one fail with ErrCertChanged, mirroring the Electrum wallet
+	// behavior. Ignored if 'TLSPin' is set. Implies the use of a secure connection
+	TrustStore Store
+
+	// If provided, will be presented to the server to authenticate the client on
+	// deployments requiring mutual TLS; implies the use of a secure connection
+	ClientCertificate *tls.Certificate
+
+	// If provided, will be used as logging sink; accepts a *slog.Logger directly, use
+	// StdLogger to adapt a standard library *log.Logger. Operations are logged at debug
+	// level with the method name, request identifier and duration as structured fields,
+	// failed operations at warning level
+	Log Logger
+
+	// If provided, will be used to encode and decode protocol messages instead
+	// of the standard library 'encoding/json' package
+	Codec Codec
+
+	// If set to true, results will be checked against the request that produced them,
+	// e.g. the hash of returned transactions must match the requested identifier and
+	// block headers must link to the ones already received; inconsistent results fail
+	// with ErrServerMismatch
+	VerifyResponses bool
+
+	// If set to true, the parameters of failed operations will be omitted from
+	// the returned *CallError values, e.g. to keep addresses out of application logs
+	RedactParams bool
+
+	// If set to true, errors produced by server responses will include a *RawError value,
+	// providing access to the raw response payload; like any other error produced by an
+	// operation it's wrapped in a *CallError, use errors.As to retrieve it
+	Debug bool
+
+	// If provided, connecting to a server with an active ban entry will fail with
+	// ErrBannedServer
+	BanList *BanList
+
+	// If set, will limit the number of simultaneous subscriptions; additional
+	// subscriptions will fail with ErrTooManySubscriptions
+	MaxSubscriptions int
+
+	// Capacity of the channels handed to subscription consumers; by default notifications
+	// are delivered on unbuffered channels
+	SubscriptionBuffer int
+
+	// Action taken when a notification can't be delivered because the consumer's channel
+	// is full, defaults to OverflowBlock; with other policies an unbuffered channel overflows
+	// whenever the consumer is not ready to receive, so a buffer should be set as well
+	OverflowPolicy OverflowPolicy
+
+	// Number of recent connection events kept by the client and available
+	// through the Events method, defaults to 64
+	EventHistory int
+
+	// If provided, transactions are validated locally before being broadcast, failing
+	// with a *PreflightError instead of submitting invalid transactions to the server
+	Preflight *PreflightOptions
+
+	// Max number of requests included on each JSON-RPC batch by multi-item
+	// operations such as GetTransactions, defaults to 50
+	BatchSize int
+
+	// Max number of batches in flight at any time for multi-item operations,
+	// defaults to 4
+	BatchConcurrency int
+
+	// If set, fee estimates and histograms are cached for the given period, shared
+	// by all callers; use RefreshFees to discard cached results
+	FeeCacheTTL time.Duration
+
+	// If provided, every request/response pair is recorded on the journal, e.g.
+	// to keep an audit trail of the data obtained from the server
+	Journal Journal
+
+	// If provided, every raw message exchanged with the server is written to it, one
+	// line per message prefixed with a timestamp and its direction: '>>' for outbound
+	// and '<<' for inbound messages. Useful to debug misbehaving servers when the
+	// traffic is encrypted; the capture includes request parameters unredacted
+	Capture io.Writer
+
+	// If provided, will be invoked after every synchronous operation with metadata
+	// about the exchange, e.g. to attribute slowness or collect latency metrics;
+	// must not block
+	OnCall func(*CallInfo)
+
+	// If provided, will receive instrumentation events about operations, reconnections
+	// and active subscriptions, e.g. to export them to a metrics system
+	Metrics Metrics
+
+	// Max time to wait for the response of a synchronous operation before failing
+	// with ErrTimeout, defaults to 30 seconds; a negative value disables the limit
+	RequestTimeout time.Duration
+
+	// If set, will limit the number of outstanding requests, a batch counting as a
+	// single request; additional callers wait for a slot to be available until their
+	// context is done
+	MaxInflight int
+
+	// If set to true, callers exceeding the 'MaxInflight' limit fail immediately
+	// with ErrBusy instead of waiting
+	FailWhenBusy bool
+
+	// If provided, synchronous operations without side effects failing with a transient
+	// error, e.g. a dropped connection or a busy server, are retried according to it
+	Retry *RetryPolicy
+
+	// If set, subscriptions rejected by the server will fall back to polling
+	// the equivalent query at the given interval, when such a query exists
+	PollInterval time.Duration
 }
 
 // Client defines the protocol client instance structure and interface
@@ -72,42 +284,166 @@ type Client struct {
 	// Protocol version preferred by the client instance
 	Protocol string
 
-	done         chan bool
-	transport    *transport
+	protocolMin  string
+	negotiate    bool
+	negotiated   string
+	onCall       func(*CallInfo)
+	preflight    *PreflightOptions
+	fees         *feeCache
+	batchSize    int
+	batchWorkers int
+	journal      Journal
+	capture      *capture
+	metrics      Metrics
+	stats        clientStats
+	timeout      time.Duration
+	retry        *RetryPolicy
+	inflight     chan struct{}
+	failBusy     bool
+	session      *session
+	transport    *transportOptions
+	newTransport func(ctx context.Context) (Transport, error)
+	banList      *BanList
+	keepAlive    bool
+	interval     time.Duration
+	maxFailures  int
+	jitter       time.Duration
 	counter      int
 	subs         map[int]*subscription
-	ping         *time.Ticker
-	log          *log.Logger
+	batches      map[*subscription]struct{}
+	log          Logger
+	codec        Codec
 	agent        string
-	bgProcessing context.Context
-	cleanUp      context.CancelFunc
+	pollInterval time.Duration
+	maxSubs      int
+	subBuffer    int
+	overflow     OverflowPolicy
+	debug        bool
+	verify       bool
+	chain        *headerChain
+	redactParams bool
 	resuming     context.Context
 	stopResuming context.CancelFunc
+	watchers     []*func(ConnectionState)
+	subWatchers  []func(*Subscription, SubscriptionEvent, error)
+	state        ConnectionState
+	events       *eventLog
+	closing      bool
+	closed       bool
+	calls        sync.WaitGroup
+	workers      sync.WaitGroup
+	reporting    sync.Mutex
 	sync.Mutex
 }
 
+// Network activity of a running client, from Start to Stop
+type session struct {
+	transport Transport
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
 type subscription struct {
-	method   string
-	params   []string
-	messages chan *response
-	handler  func(*response)
-	ctx      context.Context
+	id          int
+	method      string
+	params      []interface{}
+	unsubscribe string
+	messages    chan *response
+	handler     func(*response)
+	onClose     func()
+	poll        func() (interface{}, error)
+	polling     bool
+	backfill    func() error
+	resumed     bool
+	snapshot    chan *response
+	created     time.Time
+	received    atomic.Uint64
+	resuming    atomic.Bool
+	dropped     atomic.Uint64
+	done        chan struct{}
+	ctx         context.Context
+	cancel      context.CancelCauseFunc
+}
+
+// Check if a notification belongs to the subscription; notifications for subscriptions
+// with parameters, e.g. an address, carry the same value as their first parameter
+func (sub *subscription) matches(resp *response) bool {
+	if sub.method != resp.Method {
+		return false
+	}
+	if len(sub.params) == 0 {
+		return true
+	}
+	params, ok := resp.Params.([]interface{})
+	return ok && len(params) > 0 && params[0] == sub.params[0]
 }
 
-// New will create and start processing on a new client instance
+// Create a new subscription instance bound to the provided context; the subscription
+// is terminated when the context is done or when it gets removed from the client
+func newSubscription(ctx context.Context) *subscription {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sub := &subscription{
+		messages: make(chan *response),
+		created:  time.Now(),
+		done:     make(chan struct{}),
+	}
+	sub.ctx, sub.cancel = context.WithCancelCause(ctx)
+	return sub
+}
+
+// New will create and start processing on a new client instance, failing if the server
+// can't be reached; use NewClient and Connect to establish the connection later
 func New(options *Options) (*Client, error) {
-	t, err := getTransport(&transportOptions{
-		address: options.Address,
-		tls:     options.TLS,
-	})
+	return NewWithContext(context.Background(), options)
+}
+
+// NewWithContext will create and start processing on a new client instance; the
+// provided context is only used for the connection setup
+func NewWithContext(ctx context.Context, options *Options) (*Client, error) {
+	client, err := NewClient(options)
 	if err != nil {
 		return nil, err
 	}
+	if err := client.Start(ctx); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewClient will create a new client instance without starting any network activity;
+// use Start to establish the connection with the server
+func NewClient(options *Options) (*Client, error) {
+	if err := validateOptions(options); err != nil {
+		return nil, err
+	}
+	opts, err := newTransportOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if options.Transport == nil {
+		if err := validateAddress(opts); err != nil {
+			return nil, err
+		}
+	}
 
 	// By default use the latest supported protocol version
 	// https://electrumx.readthedocs.io/en/latest/protocol-changes.html
 	if options.Protocol == "" {
 		options.Protocol = Protocol12
+		if options.NegotiateProtocol {
+			options.Protocol = Protocol14
+		}
+	}
+
+	// By default advertise only the preferred protocol version, or the full
+	// range of known versions when negotiating
+	if options.ProtocolMin == "" {
+		options.ProtocolMin = options.Protocol
+		if options.NegotiateProtocol {
+			options.ProtocolMin = Protocol10
+		}
 	}
 
 	// Use library version as default client version
@@ -120,73 +456,462 @@ func New(options *Options) (*Client, error) {
 		options.Agent = "fairbank-electrum"
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	client := &Client{
-		transport:    t,
+	// Use "agent-version" as default client identifier
+	if options.AgentFormat == nil {
+		options.AgentFormat = func(agent, version string) string {
+			return fmt.Sprintf("%s-%s", agent, version)
+		}
+	}
+
+	// Use 'encoding/json' as default codec
+	if options.Codec == nil {
+		options.Codec = stdCodec{}
+	}
+
+	// Limit the time spent waiting for responses by default
+	if options.RequestTimeout == 0 {
+		options.RequestTimeout = defaultRequestTimeout
+	}
+
+	var fees *feeCache
+	if options.FeeCacheTTL > 0 {
+		fees = newFeeCache(options.FeeCacheTTL)
+	}
+
+	var chain *headerChain
+	if options.VerifyResponses {
+		chain = newHeaderChain(headersChunkSize)
+	}
+
+	var inflight chan struct{}
+	if options.MaxInflight > 0 {
+		inflight = make(chan struct{}, options.MaxInflight)
+	}
+
+	return &Client{
+		transport:    opts,
+		newTransport: options.Transport,
+		banList:      options.BanList,
+		keepAlive:    options.KeepAlive,
+		interval:     options.KeepAliveInterval,
+		maxFailures:  options.KeepAliveFailures,
+		jitter:       options.KeepAliveJitter,
 		counter:      0,
-		bgProcessing: ctx,
-		cleanUp:      cancel,
-		done:         make(chan bool),
 		subs:         make(map[int]*subscription),
+		batches:      make(map[*subscription]struct{}),
 		log:          options.Log,
-		agent:        fmt.Sprintf("%s-%s", options.Agent, options.Version),
+		codec:        options.Codec,
+		pollInterval: options.PollInterval,
+		maxSubs:      options.MaxSubscriptions,
+		subBuffer:    options.SubscriptionBuffer,
+		overflow:     options.OverflowPolicy,
+		debug:        options.Debug,
+		verify:       options.VerifyResponses,
+		chain:        chain,
+		redactParams: options.RedactParams,
+		agent:        options.AgentFormat(options.Agent, options.Version),
 		Address:      options.Address,
 		Version:      options.Version,
 		Protocol:     options.Protocol,
+		protocolMin:  options.ProtocolMin,
+		negotiate:    options.NegotiateProtocol,
+		events:       newEventLog(options.EventHistory),
+		onCall:       options.OnCall,
+		preflight:    options.Preflight,
+		fees:         fees,
+		batchSize:    options.BatchSize,
+		batchWorkers: options.BatchConcurrency,
+		journal:      options.Journal,
+		capture:      newCapture(options.Capture),
+		metrics:      options.Metrics,
+		timeout:      options.RequestTimeout,
+		retry:        options.Retry,
+		inflight:     inflight,
+		failBusy:     options.FailWhenBusy,
+	}, nil
+}
+
+// Build the settings of the default transport from the network related options
+func newTransportOptions(options *Options) (*transportOptions, error) {
+	opts, err := parseAddress(options.Address, options.TLS)
+	if err != nil {
+		return nil, err
+	}
+	opts.reconnect = options.Reconnect
+	opts.dial = options.Dial
+	if opts.proxy, err = resolveProxy(options.Proxy, opts.address); err != nil {
+		return nil, err
+	}
+	opts.timeout = options.ConnectTimeout
+	opts.idle = options.ReadIdleTimeout
+	opts.keepAlive = options.TCPKeepAlive
+	opts.delay = options.TCPDelay
+	if options.LocalAddr != "" {
+		if opts.local, err = resolveLocalAddr(options.LocalAddr); err != nil {
+			return nil, err
+		}
+	}
+	opts.write = options.WriteTimeout
+	if opts.timeout == 0 {
+		opts.timeout = defaultConnectTimeout
+	}
+	if options.ClientCertificate != nil {
+		if err := opts.setClientCertificate(*options.ClientCertificate); err != nil {
+			return nil, err
+		}
+	}
+	if options.TLSPin != "" {
+		if err := opts.setPin(options.TLSPin); err != nil {
+			return nil, err
+		}
+	} else if options.TrustStore != nil {
+		if err := opts.setTrustStore(options.TrustStore); err != nil {
+			return nil, err
+		}
 	}
+	return opts, nil
+}
 
-	// Automatically send a 'server.version' or 'server.ping' request every 60 seconds as a keep-alive
-	// signal to the server
-	if options.KeepAlive {
-		client.ping = time.NewTicker(60 * time.Second)
-		go func() {
-			defer client.ping.Stop()
-			for {
-				select {
-				case <-client.ping.C:
-					// Deliberately ignore errors produced by "ping" messages
-					// "server.ping" is not recognized by the server in the current release (1.4.3)
-					if b, err := client.req("server.version", client.Version, client.Protocol).encode(); err == nil {
-						/* #nosec */
-						client.transport.sendMessage(b)
-					}
-				case <-client.bgProcessing.Done():
-					return
+// DefaultTransport returns a function, suitable for the 'Transport' option, creating the
+// transport used by the client when none is provided, configured with the network related
+// settings on options; useful to wrap the default transport, e.g. with RecordTransport
+func DefaultTransport(options *Options) func(ctx context.Context) (Transport, error) {
+	opts, err := newTransportOptions(options)
+	if err == nil {
+		err = validateAddress(opts)
+	}
+	return func(ctx context.Context) (Transport, error) {
+		if err != nil {
+			return nil, err
+		}
+		t, err := getTransport(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+}
+
+// Start will establish the connection with the server and begin processing; existing
+// subscriptions, e.g. from a previous execution, are registered again with the server.
+// The provided context is only used for the connection setup
+func (c *Client) Start(ctx context.Context) error {
+	if c.shuttingDown() || c.isClosed() {
+		return ErrClientClosed
+	}
+	if c.running() {
+		return ErrAlreadyStarted
+	}
+	if c.banList != nil {
+		ban, err := c.banList.Get(c.Address)
+		if err != nil {
+			return err
+		}
+		if ban != nil {
+			return ErrBannedServer
+		}
+	}
+	t, err := c.connect(ctx)
+	if err != nil {
+		c.events.add("", err)
+		if c.log != nil {
+			c.log.Error("connection failed", "server", c.Address, "error", err)
+		}
+		return err
+	}
+
+	sctx, cancel := context.WithCancel(context.Background())
+	s := &session{transport: t, ctx: sctx, cancel: cancel}
+	c.Lock()
+	if c.closed || c.session != nil {
+		closed := c.closed
+		c.Unlock()
+		cancel()
+		/* #nosec */
+		t.Close()
+		if closed {
+			return ErrClientClosed
+		}
+		return ErrAlreadyStarted
+	}
+	c.session = s
+	c.state = Ready
+	c.Unlock()
+	c.stats.setConnected(true)
+
+	if c.keepAlive {
+		go c.keepSessionAlive(s)
+	}
+	go c.monitorState(s)
+	go c.handleMessages(s)
+
+	// Negotiated protocol must be known before any other operation
+	if c.negotiate {
+		if _, err := c.ServerVersionContext(ctx); err != nil {
+			c.Stop()
+			return err
+		}
+	}
+
+	c.registerSubscriptions()
+	return nil
+}
+
+// Connect will establish the connection with the server on clients created with NewClient,
+// e.g. at configuration time, when the session is actually required; unlike Start it has no
+// effect if the client is already running, so it's safe to call repeatedly from the caller's
+// own retry logic. The provided context is only used for the connection setup
+func (c *Client) Connect(ctx context.Context) error {
+	if err := c.Start(ctx); err != nil && err != ErrAlreadyStarted {
+		return err
+	}
+	return nil
+}
+
+// Create the transport for a new session
+func (c *Client) connect(ctx context.Context) (Transport, error) {
+	if c.newTransport != nil {
+		return c.newTransport(ctx)
+	}
+	return getTransport(ctx, c.transport)
+}
+
+// Stop will terminate network activity, pending operations are released with
+// ErrConnClosed; subscriptions are preserved and will be registered again with
+// the server when the client is started
+func (c *Client) Stop() {
+	c.Lock()
+	s := c.session
+	c.session = nil
+	c.releasePendingLocked()
+	c.Unlock()
+	if s != nil {
+		s.cancel()
+		/* #nosec */
+		s.transport.Close()
+		c.stats.setConnected(false)
+		c.events.add(Closed, nil)
+		c.notifyState(Closed)
+	}
+}
+
+// Restart will stop the client, if running, and start it again with a new connection;
+// existing subscriptions are preserved
+func (c *Client) Restart(ctx context.Context) error {
+	c.Stop()
+	return c.Start(ctx)
+}
+
+// Check if the client is currently started
+func (c *Client) running() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.session != nil
+}
+
+// Get the currently running session, if any
+func (c *Client) current() *session {
+	c.Lock()
+	defer c.Unlock()
+	return c.session
+}
+
+// Automatically send a 'server.ping' or 'server.version' request periodically as a keep-alive
+// signal to the server; after too many consecutive operations without a response the
+// connection is dropped and recovered
+func (c *Client) keepSessionAlive(s *session) {
+	limit := c.maxFailures
+	if limit == 0 {
+		limit = defaultKeepAliveFailures
+	}
+	failures := 0
+	ping := time.NewTimer(keepAliveDelay(c.interval, c.jitter))
+	defer ping.Stop()
+	for {
+		select {
+		case <-ping.C:
+			delay := keepAliveDelay(c.interval, c.jitter)
+			if !c.IsConnected() {
+				failures = 0
+				ping.Reset(delay)
+				continue
+			}
+
+			// Error responses still prove the server is alive
+			ctx, cancel := context.WithTimeout(s.ctx, delay)
+			err := c.ping(ctx, c.keepAliveRequest())
+			cancel()
+			if err == nil || s.ctx.Err() != nil {
+				failures = 0
+			} else if failures++; limit > 0 && failures >= limit {
+				failures = 0
+				if t, ok := s.transport.(*transport); ok {
+					t.drop(ErrKeepAliveFailed)
 				}
 			}
-		}()
+			ping.Reset(delay)
+		case <-s.ctx.Done():
+			return
+		}
 	}
+}
 
-	// Monitor transport state
-	go func() {
-		for {
-			select {
-			case s := <-client.transport.state:
-				client.Lock()
-				count := len(client.subs)
-				client.Unlock()
-				if s == Reconnected && count > 0 {
-					go client.resumeSubscriptions()
+// Monitor transport state
+func (c *Client) monitorState(s *session) {
+	for {
+		select {
+		case state := <-s.transport.States():
+			c.events.add(state, nil)
+			c.Lock()
+			c.state = state
+			if state == Disconnected || state == Failed {
+				c.releasePendingLocked()
+			}
+			count := len(c.subs)
+			c.Unlock()
+			if state == Disconnected {
+				c.suspendSubscriptions()
+			}
+			if state == Reconnected && count > 0 {
+				go c.resumeSubscriptions(s)
+			}
+			c.stats.setConnected(state == Ready || state == Reconnected)
+			if state == Reconnected {
+				c.stats.reconnects.Add(1)
+				if c.metrics != nil {
+					c.metrics.ObserveReconnect()
 				}
-			case <-client.bgProcessing.Done():
+			}
+			c.notifyState(state)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// Release all in-flight requests, failing them with ErrConnClosed; subscriptions
+// with a notification handler are preserved to be registered again with the
+// server. Must be called with the client lock held
+func (c *Client) releasePendingLocked() {
+	for id, sub := range c.subs {
+		if sub.handler == nil {
+			c.removeSubscriptionLocked(id)
+		}
+	}
+}
+
+// State returns the current state of the connection with the server; Closed if
+// the client is not running
+func (c *Client) State() ConnectionState {
+	c.Lock()
+	defer c.Unlock()
+	if c.session == nil {
+		return Closed
+	}
+	return c.state
+}
+
+// IsConnected reports whether the connection with the server is currently up,
+// without requiring a network round trip
+func (c *Client) IsConnected() bool {
+	switch c.State() {
+	case Ready, Reconnected:
+		return true
+	default:
+		return false
+	}
+}
+
+// OnStateChange registers a function to be notified of connection state changes, e.g. to
+// report a 'reconnecting' status or pause work while the server is unreachable. Listeners
+// are run sequentially on the state monitoring loop, except for the Closed state reported
+// by Stop, which runs on the caller's goroutine; listeners must not block. The returned
+// function unregisters the listener
+func (c *Client) OnStateChange(fn func(ConnectionState)) func() {
+	c.Lock()
+	defer c.Unlock()
+	w := &fn
+	c.watchers = append(c.watchers, w)
+	return func() {
+		c.Lock()
+		defer c.Unlock()
+		for i, v := range c.watchers {
+			if v == w {
+				c.watchers = append(c.watchers[:i:i], c.watchers[i+1:]...)
 				return
 			}
 		}
-	}()
+	}
+}
 
-	go client.handleMessages()
-	return client, nil
+// Run the registered state change listeners
+func (c *Client) notifyState(state ConnectionState) {
+	if c.log != nil {
+		c.log.Info("connection state changed", "server", c.Address, "state", state)
+	}
+	c.Lock()
+	watchers := c.watchers
+	c.Unlock()
+	for _, w := range watchers {
+		(*w)(state)
+	}
+}
+
+// Send a keep-alive request and wait for its response; unlike regular operations it
+// doesn't take a slot of the 'MaxInflight' limit, so busy clients are not mistaken for
+// dead connections, and it's not reported to the call hooks, logs and metrics
+func (c *Client) ping(ctx context.Context, req *request) error {
+	sub := newSubscription(ctx)
+	c.Lock()
+	c.subs[req.ID] = sub
+	c.Unlock()
+	defer c.removeSubscription(req.ID)
+
+	if err := c.dispatch(req); err != nil {
+		return err
+	}
+	select {
+	case r := <-sub.messages:
+		putResponse(r)
+		return nil
+	case <-sub.ctx.Done():
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrConnClosed
+	}
+}
+
+// Build the keep-alive request; 'server.ping' is only available on protocol 1.2 and newer
+func (c *Client) keepAliveRequest() *request {
+	if c.supports("server.ping") == nil {
+		return c.req("server.ping")
+	}
+	return c.req("server.version", c.agent, c.protocolVersion())
+}
+
+// Interval to wait before the next keep-alive operation, randomized within the
+// provided jitter window
+func keepAliveDelay(interval, jitter time.Duration) time.Duration {
+	if interval <= 0 {
+		interval = defaultKeepAliveInterval
+	}
+	if jitter <= 0 {
+		return interval
+	}
+	/* #nosec */
+	return interval + time.Duration(rand.Int63n(int64(jitter)))
 }
 
 // Build a request object
-func (c *Client) req(name string, params ...string) *request {
+func (c *Client) req(name string, params ...interface{}) *request {
 	c.Lock()
 	defer c.Unlock()
 
 	// If no parameters are specified send an empty array
 	// http://docs.electrum.org/en/latest/protocol.html#request
 	if len(params) == 0 {
-		params = []string{}
+		params = []interface{}{}
 	}
 	req := &request{
 		ID:     c.counter,
@@ -197,49 +922,104 @@ func (c *Client) req(name string, params ...string) *request {
 	return req
 }
 
-// Receive incoming network messages and the 'stop' signal
-func (c *Client) handleMessages() {
+// Decode the result of a response into the provided value
+func (c *Client) decode(res *response, v interface{}) error {
+	b, err := c.codec.Marshal(res.Result)
+	if err == nil {
+		err = c.codec.Unmarshal(b, v)
+	}
+	if err == nil {
+		return nil
+	}
+	err = newDecodeError(v, b, err)
+	if res.req != nil {
+		return c.callError(res.req, err)
+	}
+	return err
+}
+
+// Receive incoming network messages until the session is stopped
+func (c *Client) handleMessages(s *session) {
 	for {
 		select {
-		case <-c.done:
-			for i := range c.subs {
-				c.removeSubscription(i)
-			}
-			c.cleanUp()
+		case <-s.ctx.Done():
 			return
-		case err := <-c.transport.errors:
+		case err := <-s.transport.Errors():
+			c.events.add("", err)
+			c.stats.setError(err)
 			if c.log != nil {
-				c.log.Println(err)
+				c.log.Error("transport error", "server", c.Address, "error", err)
 			}
-		case m := <-c.transport.messages:
+		case m := <-s.transport.Messages():
 			if c.log != nil {
-				c.log.Println(m)
+				c.log.Debug("message received", "server", c.Address, "size", len(m))
 			}
-			resp := &response{}
-			if err := json.Unmarshal(m, resp); err != nil {
+			c.capture.record(captureIn, m)
+			c.stats.bytesIn.Add(uint64(len(m)))
+			if isBatch(m) {
+				c.routeBatch(s, m)
 				break
 			}
-
-			// Message routed by method name
-			if resp.Method != "" {
-				c.Lock()
-				for _, sub := range c.subs {
-					if sub.method == resp.Method {
-						sub.messages <- resp
-					}
-				}
-				c.Unlock()
+			resp := getResponse()
+			if err := c.codec.Unmarshal(m, resp); err != nil {
+				putResponse(resp)
+				break
+			}
+			if c.debug {
+				resp.raw = m
+			}
+			resp.size = len(m)
+			if c.routeBatchError(s, m, resp) {
 				break
 			}
+			c.route(s, resp)
+		}
+	}
+}
 
-			// Message routed by ID
-			c.Lock()
-			sub, ok := c.subs[resp.ID]
-			c.Unlock()
-			if ok {
-				sub.messages <- resp
+// Deliver a response to the subscriptions waiting for it
+func (c *Client) route(s *session, resp *response) {
+	// Message routed by method name and subscription parameters
+	if resp.Method != "" {
+		c.stats.notifications.Add(1)
+		var targets []*subscription
+		c.Lock()
+		for _, sub := range c.subs {
+			if sub.matches(resp) {
+				targets = append(targets, sub)
 			}
 		}
+		c.Unlock()
+		for _, sub := range targets {
+			c.deliver(sub, resp, s.ctx.Done())
+		}
+		if len(targets) == 0 {
+			putResponse(resp)
+		}
+		return
+	}
+
+	// Message routed by ID; responses no one is waiting for, e.g. keep-alive
+	// results, are recycled right away
+	c.stats.responses.Add(1)
+	c.Lock()
+	sub, ok := c.subs[resp.ID]
+	c.Unlock()
+	if !ok {
+		putResponse(resp)
+		return
+	}
+	c.deliver(sub, resp, s.ctx.Done())
+}
+
+// Hand a message to a subscription; delivery is abandoned if the subscription is
+// terminated or the provided channel is closed while waiting for it to be received,
+// which prevents the router from blocking indefinitely
+func (c *Client) deliver(sub *subscription, resp *response, done <-chan struct{}) {
+	select {
+	case sub.messages <- resp:
+	case <-sub.ctx.Done():
+	case <-done:
 	}
 }
 
@@ -247,21 +1027,31 @@ func (c *Client) handleMessages() {
 func (c *Client) removeSubscription(id int) {
 	c.Lock()
 	defer c.Unlock()
+	c.removeSubscriptionLocked(id)
+}
+
+// Remove an existing messages subscription, must be called with the client lock held.
+// Message channels are never closed, instead the subscription's context is cancelled
+// to signal both the router and the processing loop to stop using it
+func (c *Client) removeSubscriptionLocked(id int) {
 	sub, ok := c.subs[id]
 	if ok {
-		close(sub.messages)
+		sub.cancel(nil)
 		delete(c.subs, id)
 	}
 }
 
 // Restart processing of existing subscriptions; intended to be triggered after
 // recovering from a dropped connection
-func (c *Client) resumeSubscriptions() {
+func (c *Client) resumeSubscriptions(s *session) {
 	// Handle existing resume attempts
+	c.Lock()
 	if c.stopResuming != nil {
 		c.stopResuming()
 	}
 	c.resuming, c.stopResuming = context.WithCancel(context.Background())
+	resuming := c.resuming
+	c.Unlock()
 
 	// Wait for the connection to be responsive
 	rt := time.NewTicker(2 * time.Second)
@@ -273,92 +1063,552 @@ WAIT:
 			if _, err := c.ServerVersion(); err == nil {
 				break WAIT
 			}
-		case <-c.resuming.Done():
+		case <-resuming.Done():
 			return
-		case <-c.bgProcessing.Done():
+		case <-s.ctx.Done():
 			return
 		}
 	}
 
-	// Restart existing subscriptions
-	for id, sub := range c.subs {
-		c.removeSubscription(id)
-		sub.messages = make(chan *response)
-		if err := c.startSubscription(sub); err != nil {
-			c.log.Printf("failed to resume subscription '%s' with error: %s\n", sub.method, err)
+	c.registerSubscriptions()
+}
+
+// Register existing subscriptions again with the server, e.g. on a new connection;
+// processing loops and the channels handed to consumers are preserved. Subscriptions
+// are reported as resumed once the server accepts them
+func (c *Client) registerSubscriptions() {
+	c.Lock()
+	var subs []*subscription
+	for _, sub := range c.subs {
+		if sub.handler != nil {
+			subs = append(subs, sub)
+		}
+	}
+	c.Unlock()
+
+	// Events missed while the connection was down are delivered before registering the
+	// subscriptions again, when supported
+	for _, sub := range subs {
+		if sub.backfill == nil {
+			continue
+		}
+		if err := sub.backfill(); err != nil && sub.ctx.Err() == nil {
+			c.notifySubscription(sub, SubscriptionGap, err)
+			if c.log != nil {
+				c.log.Warn("failed to backfill subscription", "server", c.Address, "method", sub.method, "error", err)
+			}
+		}
+	}
+	for _, sub := range subs {
+		sub.resuming.Store(true)
+	}
+	for i, err := range c.subscribeBatch(subs) {
+		if err == nil {
+			continue
+		}
+		sub := subs[i]
+		sub.resuming.Store(false)
+		c.notifySubscription(sub, SubscriptionFailed, err)
+		sub.cancel(err)
+		if c.log != nil {
+			c.log.Warn("failed to resume subscription", "server", c.Address, "method", sub.method, "error", err)
 		}
 	}
 }
 
-// Start a subscription processing loop
+// Start a subscription processing loop and send its subscribe request to the server
 func (c *Client) startSubscription(sub *subscription) error {
+	if err := c.runSubscription(sub); err != nil {
+		return err
+	}
+	if err := c.subscribe(sub); err != nil {
+		sub.cancel(err)
+		return err
+	}
+	return nil
+}
+
+// Start a subscription processing loop, without registering it with the server
+func (c *Client) runSubscription(sub *subscription) error {
 	// Start processing loop
-	// Will be terminating when closing the subscription's context or
-	// by closing it's messages channel
+	// Will be terminating when the subscription's context is done, either by the
+	// consumer or by the client when the subscription is removed. This is the only
+	// goroutine running the subscription's handler, which guarantees events are
+	// delivered in the order they were received from the server
+	//
+	// When a snapshot channel is provided, the first result is handed to it instead
+	// of the handler; the channel is closed if the subscription terminates before the
+	// first result is received
+	snapshot := sub.snapshot
+
+	// Subscriptions run on behalf of a tenant count towards its quota until terminated
+	tenant := tenantFromContext(sub.ctx)
+	if tenant != nil {
+		if err := tenant.acquireSubscription(); err != nil {
+			sub.cancel(err)
+			return err
+		}
+	}
+	c.Lock()
+	if c.closing {
+		c.Unlock()
+		if tenant != nil {
+			tenant.releaseSubscription()
+		}
+		sub.cancel(ErrClientClosed)
+		return ErrClientClosed
+	}
+	c.workers.Add(1)
+	c.Unlock()
 	go func() {
+		defer c.workers.Done()
+		if tenant != nil {
+			defer tenant.releaseSubscription()
+		}
+		defer c.reapSubscription(sub)
+		defer func() {
+			if snapshot != nil {
+				close(snapshot)
+			}
+		}()
 		for {
 			select {
-			case msg, ok := <-sub.messages:
-				if !ok {
+			case msg := <-sub.messages:
+				sub.received.Add(1)
+				resumed := sub.resuming.CompareAndSwap(true, false)
+				if msg.Error != nil && sub.poll != nil && c.pollInterval > 0 {
+					if resumed {
+						c.notifySubscription(sub, SubscriptionResumed, nil)
+					}
+					go c.pollSubscription(sub)
+					continue
+				}
+
+				// Subscribe requests rejected by the server terminate the subscription,
+				// unless the error is handed to a caller waiting for the initial result
+				if msg.Error != nil && snapshot == nil {
+					err := c.resError(msg)
+					if resumed {
+						c.notifySubscription(sub, SubscriptionFailed, err)
+					}
+					sub.cancel(err)
 					return
 				}
+				if resumed {
+					c.notifySubscription(sub, SubscriptionResumed, nil)
+				}
+				if snapshot != nil {
+					snapshot <- msg
+					snapshot = nil
+					continue
+				}
+				sub.resumed = resumed
 				sub.handler(msg)
+				sub.resumed = false
 			case <-sub.ctx.Done():
 				return
 			}
 		}
 	}()
+	return nil
+}
+
+// Register a subscription and send the subscribe request to the server
+func (c *Client) subscribe(sub *subscription) error {
+	return c.subscribeBatch([]*subscription{sub})[0]
+}
+
+// Register several subscriptions and send their subscribe requests to the server, grouped
+// in batches; the returned errors match the order of the subscriptions
+func (c *Client) subscribeBatch(subs []*subscription) []error {
+	errs := make([]error, len(subs))
+	var reqs []*request
+	var pending []int
+	for i, sub := range subs {
+		req, err := c.registerSubscription(sub)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		reqs = append(reqs, req)
+		pending = append(pending, i)
+	}
+
+	// Send requests to the server
+	for start := 0; start < len(reqs); start += defaultBatchSize {
+		end := start + defaultBatchSize
+		if end > len(reqs) {
+			end = len(reqs)
+		}
+		var err error
+		if end-start == 1 {
+			err = c.dispatch(reqs[start])
+		} else {
+			err = c.dispatchBatch(reqs[start:end])
+		}
+		if err == nil {
+			continue
+		}
+		for j := start; j < end; j++ {
+			i := pending[j]
+			errs[i] = err
+			subs[i].cancel(err)
+			c.removeSubscription(reqs[j].ID)
+		}
+	}
+	return errs
+}
 
-	// Register subscription
+// Add a subscription to the registry, returning the subscribe request to send
+func (c *Client) registerSubscription(sub *subscription) (*request, error) {
+	if err := c.supports(sub.method); err != nil {
+		return nil, err
+	}
 	req := c.req(sub.method, sub.params...)
 	c.Lock()
+	if sub.ctx.Err() != nil {
+		c.Unlock()
+		return nil, context.Cause(sub.ctx)
+	}
+
+	// A previous registration is replaced atomically, so the subscription remains
+	// listed while registered again with the server
+	if c.subs[sub.id] == sub {
+		delete(c.subs, sub.id)
+	}
+	if c.maxSubs > 0 && c.activeSubscriptions() >= c.maxSubs {
+		c.Unlock()
+		return nil, ErrTooManySubscriptions
+	}
+	sub.id = req.ID
 	c.subs[req.ID] = sub
 	c.Unlock()
+	c.reportSubscriptions()
+	return req, nil
+}
+
+// Number of registered subscriptions, excluding pending synchronous requests;
+// must be called with the client lock held
+func (c *Client) activeSubscriptions() int {
+	count := 0
+	for _, sub := range c.subs {
+		if sub.handler != nil {
+			count++
+		}
+	}
+	return count
+}
 
-	// Send request to the server
-	b, err := req.encode()
+// Release the resources of a terminated subscription: remove it from the registry,
+// ask the server to stop sending notifications when supported and close the channel
+// handed to the consumer
+func (c *Client) reapSubscription(sub *subscription) {
+	c.Lock()
+	registered := c.subs[sub.id] == sub
+	if registered {
+		c.removeSubscriptionLocked(sub.id)
+	}
+	c.Unlock()
+	if registered {
+		c.reportSubscriptions()
+	}
+
+	// Deliberately ignore errors and responses for unsubscribe requests, there's
+	// nothing left to do on the client side
+	if registered && sub.unsubscribe != "" && c.running() && c.supports(sub.unsubscribe) == nil {
+		/* #nosec */
+		c.dispatch(c.req(sub.unsubscribe, sub.params...))
+	}
+	if sub.onClose != nil {
+		sub.onClose()
+	}
+	close(sub.done)
+}
+
+// Encode and send several requests to the server as a single JSON-RPC batch
+func (c *Client) dispatchBatch(reqs []*request) error {
+	for _, req := range reqs {
+		req.RPC = "2.0"
+	}
+	b, err := c.codec.Marshal(reqs)
 	if err != nil {
-		c.removeSubscription(req.ID)
 		return err
 	}
-	if err := c.transport.sendMessage(b); err != nil {
-		c.removeSubscription(req.ID)
+	s := c.current()
+	if s == nil {
+		return ErrConnClosed
+	}
+	b = append(b, delimiter)
+	c.capture.record(captureOut, b)
+	c.stats.sent(len(reqs), len(b))
+	return s.transport.SendMessage(b)
+}
+
+// Encode and send a request to the server; the encoding buffer is taken from
+// a shared pool to reduce allocations on the hot path, transports must not retain
+// the message once sent
+func (c *Client) dispatch(req *request) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+	if err := req.encodeTo(buf, c.codec); err != nil {
 		return err
 	}
-	return nil
+	s := c.current()
+	if s == nil {
+		return ErrConnClosed
+	}
+	c.capture.record(captureOut, buf.Bytes())
+	c.stats.sent(1, buf.Len())
+	return s.transport.SendMessage(buf.Bytes())
 }
 
-// Dispatch a synchronous request, i.e. wait for it's result
-func (c *Client) syncRequest(req *request) (*response, error) {
+// Dispatch a synchronous request, i.e. wait for it's result; idempotent operations
+// are retried on transient failures when a retry policy is set
+func (c *Client) syncRequest(ctx context.Context, req *request) (*response, error) {
+	if c.retry != nil && !nonIdempotent[req.Method] {
+		return c.retryRequest(ctx, req)
+	}
+	return c.roundTrip(ctx, req)
+}
+
+// Run a single request/response exchange; the operation is abandoned with the
+// context error if ctx is done before a response arrives
+func (c *Client) roundTrip(ctx context.Context, req *request) (*response, error) {
+	if err := c.supports(req.Method); err != nil {
+		return nil, c.callError(req, err)
+	}
+	if err := c.begin(); err != nil {
+		return nil, c.callError(req, err)
+	}
+	defer c.calls.Done()
+	if err := chargeRequests(ctx, 1); err != nil {
+		return nil, c.callError(req, err)
+	}
+	if err := c.acquire(ctx); err != nil {
+		return nil, c.callError(req, err)
+	}
+	defer c.release()
+
 	// Setup a subscription for the request with proper cleanup
-	res := make(chan *response)
+	sub := newSubscription(nil)
 	c.Lock()
-	c.subs[req.ID] = &subscription{messages: res}
+	c.subs[req.ID] = sub
 	c.Unlock()
 	defer c.removeSubscription(req.ID)
 
 	// Encode and dispatch the request
-	b, err := req.encode()
-	if err != nil {
+	start := time.Now()
+	if err := c.dispatch(req); err != nil {
+		err = c.callError(req, err)
+		c.reportCall(req, start, nil, err)
 		return nil, err
 	}
-	if err := c.transport.sendMessage(b); err != nil {
-		return nil, err
+
+	// Log request
+	if c.log != nil {
+		c.log.Debug("request sent", "method", req.Method, "id", req.ID)
+	}
+
+	// Wait for the response
+	timeout := c.requestTimer()
+	defer timeout.Stop()
+	select {
+	case r := <-sub.messages:
+		r.req = req
+		r.latency = time.Since(start)
+		c.reportCall(req, start, r, nil)
+		return r, nil
+	case <-timeout.C:
+		err := c.callError(req, ErrTimeout)
+		c.reportCall(req, start, nil, err)
+		return nil, err
+	case <-sub.ctx.Done():
+		err := c.callError(req, ErrConnClosed)
+		c.reportCall(req, start, nil, err)
+		return nil, err
+	case <-ctx.Done():
+		err := c.callError(req, ctx.Err())
+		c.reportCall(req, start, nil, err)
+		return nil, err
+	}
+}
+
+// Take a slot for an outstanding request, when limited
+func (c *Client) acquire(ctx context.Context) error {
+	if c.inflight == nil {
+		return nil
+	}
+	if c.failBusy {
+		select {
+		case c.inflight <- struct{}{}:
+			return nil
+		default:
+			return ErrBusy
+		}
+	}
+	select {
+	case c.inflight <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release a slot taken for an outstanding request
+func (c *Client) release() {
+	if c.inflight != nil {
+		<-c.inflight
+	}
+}
+
+// Timer firing once the response of a request is overdue, never fires
+// when the request timeout is disabled
+func (c *Client) requestTimer() *time.Timer {
+	if c.timeout < 0 {
+		t := time.NewTimer(time.Hour)
+		t.Stop()
+		return t
+	}
+	return time.NewTimer(c.timeout)
+}
+
+// Provide metadata about a synchronous operation to the logging sink, the 'OnCall'
+// callback, the metrics hook and the request journal, if any
+func (c *Client) reportCall(req *request, start time.Time, res *response, err error) {
+	if c.journal != nil {
+		c.journalCall(req, start, res, err)
+	}
+	cause := err
+	if res != nil && res.Error != nil {
+		cause = c.resError(res)
+	}
+	if cause != nil {
+		c.stats.setError(cause)
+	}
+	if c.log == nil && c.onCall == nil && c.metrics == nil {
+		return
+	}
+	info := &CallInfo{
+		Method:   req.Method,
+		Server:   c.transport.address,
+		Protocol: c.protocol(),
+		Latency:  time.Since(start),
+		Err:      cause,
+	}
+	if res != nil {
+		info.Size = res.size
+	}
+	if c.log != nil {
+		if info.Err != nil {
+			c.log.Warn("request failed", "method", req.Method, "id", req.ID,
+				"duration", info.Latency, "error", info.Err)
+		} else {
+			c.log.Debug("request completed", "method", req.Method, "id", req.ID,
+				"duration", info.Latency)
+		}
+	}
+	if c.metrics != nil {
+		c.metrics.ObserveCall(info)
+	}
+	if c.onCall != nil {
+		c.onCall(info)
+	}
+}
+
+// NegotiatedProtocol returns the protocol version selected by the server on the last
+// 'server.version' operation, empty if unknown
+func (c *Client) NegotiatedProtocol() string {
+	c.Lock()
+	defer c.Unlock()
+	return c.negotiated
+}
+
+// Protocol version in use, the one negotiated with the server when known
+func (c *Client) protocol() string {
+	c.Lock()
+	defer c.Unlock()
+	if c.negotiated != "" {
+		return c.negotiated
+	}
+	return c.Protocol
+}
+
+// Close will finish execution and properly terminate the underlying network transport;
+// pending operations are released with ErrConnClosed and all subscriptions are terminated.
+// The client can't be started again; calling Close more than once has no effect
+func (c *Client) Close() {
+	c.Lock()
+	c.closed = true
+	c.Unlock()
+	c.Stop()
+	c.Lock()
+	defer c.Unlock()
+	for id, sub := range c.subs {
+		sub.cancel(ErrClientClosed)
+		c.removeSubscriptionLocked(id)
+	}
+}
+
+// Shutdown will gracefully terminate the client: new operations are rejected with
+// ErrClientClosed, pending ones are given until ctx is done to complete, and the client
+// is closed afterwards. Returns once all subscription channels are closed, or with the
+// context error if it expires before. The client can't be started again; calling
+// Shutdown more than once has no effect
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.Lock()
+	c.closing = true
+	c.Unlock()
+
+	var err error
+	if !wait(ctx, &c.calls) {
+		err = ctx.Err()
+	}
+	c.Close()
+	if !wait(ctx, &c.workers) {
+		err = ctx.Err()
 	}
+	return err
+}
 
-	// Log request
-	if c.log != nil {
-		c.log.Println(req)
+// Register an in-flight operation, failing if the client is shutting down
+func (c *Client) begin() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closing {
+		return ErrClientClosed
 	}
+	c.calls.Add(1)
+	return nil
+}
 
-	// Wait for the response
-	return <-res, nil
+// Check if the client was shut down
+func (c *Client) shuttingDown() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.closing
 }
 
-// Close will finish execution and properly terminate the underlying network transport
-func (c *Client) Close() {
-	c.transport.close()
-	close(c.done)
+// Check if the client was closed
+func (c *Client) isClosed() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.closed
+}
+
+// Wait for the group to complete until ctx is done; reports whether it completed
+func wait(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 // ServerPing will send a ping message to the server to ensure it is responding, and to keep the
@@ -366,51 +1616,97 @@ func (c *Client) Close() {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-ping
 func (c *Client) ServerPing() error {
-	switch c.Protocol {
-	case Protocol12:
-		res, err := c.syncRequest(c.req("server.ping"))
-		if err != nil {
-			return err
-		}
-		if res.Error != nil {
-			return errors.New(res.Error.Message)
-		}
-		return nil
-	default:
-		return ErrUnavailableMethod
+	return c.ServerPingContext(context.Background())
+}
+
+// ServerPingContext is like ServerPing but uses the provided context to cancel the operation
+func (c *Client) ServerPingContext(ctx context.Context) error {
+	res, err := c.syncRequest(ctx, c.req("server.ping"))
+	if err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return c.resError(res)
+	}
+	return nil
+}
+
+// Protocol version argument for 'server.version' operations; a single string for
+// protocol 1.0 and a [min, max] range for newer versions
+func (c *Client) protocolVersion() interface{} {
+	if c.Protocol == Protocol10 {
+		return c.Protocol
 	}
+	return []string{c.protocolMin, c.Protocol}
 }
 
 // ServerVersion will synchronously run a 'server.version' operation
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-version
 func (c *Client) ServerVersion() (*VersionInfo, error) {
-	res, err := c.syncRequest(c.req("server.version", c.agent, c.Protocol))
+	return c.ServerVersionContext(context.Background())
+}
+
+// ServerVersionContext is like ServerVersion but uses the provided context to cancel the operation
+func (c *Client) ServerVersionContext(ctx context.Context) (*VersionInfo, error) {
+	res, err := c.syncRequest(ctx, c.req("server.version", c.agent, c.protocolVersion()))
 	if err != nil {
 		return nil, err
 	}
 
 	if res.Error != nil {
-		return nil, errors.New(res.Error.Message)
-	}
-
-	info := &VersionInfo{}
-	switch c.Protocol {
-	case Protocol10:
-		info.Software = res.Result.(string)
-	case Protocol11:
-		fallthrough
-	case Protocol12:
-		var d []string
-		b, err := json.Marshal(res.Result)
-		if err != nil {
-			return nil, err
+		return nil, c.resError(res)
+	}
+
+	info, err := parseVersionInfo(res.Result, c.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	c.Lock()
+	c.negotiated = info.Protocol
+	c.Unlock()
+	return info, nil
+}
+
+// Decode the result of a 'server.version' operation; servers return either a bare
+// software string (protocol 1.0), a [software, protocol] tuple or, in some
+// implementations, an object. When not reported, the protocol version is assumed
+// to be the one requested by the client
+func parseVersionInfo(result interface{}, protocol string) (*VersionInfo, error) {
+	info := &VersionInfo{Protocol: protocol}
+	switch r := result.(type) {
+	case string:
+		info.Software = r
+	case []interface{}:
+		if len(r) == 0 {
+			return nil, ErrInvalidResult
 		}
-		if err = json.Unmarshal(b, &d); err != nil {
-			return nil, err
+		for i, v := range r {
+			s, ok := v.(string)
+			if !ok {
+				return nil, ErrInvalidResult
+			}
+			switch i {
+			case 0:
+				info.Software = s
+			case 1:
+				info.Protocol = s
+			}
 		}
-		info.Software = d[0]
-		info.Protocol = d[1]
+	case map[string]interface{}:
+		software, _ := r["software"].(string)
+		if software == "" {
+			software, _ = r["server_version"].(string)
+		}
+		if software == "" {
+			return nil, ErrInvalidResult
+		}
+		info.Software = software
+		if p, ok := r["protocol"].(string); ok && p != "" {
+			info.Protocol = p
+		}
+	default:
+		return nil, ErrInvalidResult
 	}
 	return info, nil
 }
@@ -419,97 +1715,107 @@ func (c *Client) ServerVersion() (*VersionInfo, error) {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-banner
 func (c *Client) ServerBanner() (string, error) {
-	res, err := c.syncRequest(c.req("server.banner"))
-	if err != nil {
-		return "", err
-	}
-
-	if res.Error != nil {
-		return "", errors.New(res.Error.Message)
-	}
+	return c.ServerBannerContext(context.Background())
+}
 
-	return res.Result.(string), nil
+// ServerBannerContext is like ServerBanner but uses the provided context to cancel the operation
+func (c *Client) ServerBannerContext(ctx context.Context) (string, error) {
+	return Call[string](c, ctx, "server.banner")
 }
 
 // ServerDonationAddress will synchronously run a 'server.donation_address' operation
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-donation-address
 func (c *Client) ServerDonationAddress() (string, error) {
-	res, err := c.syncRequest(c.req("server.donation_address"))
-	if err != nil {
-		return "", err
-	}
-
-	if res.Error != nil {
-		return "", errors.New(res.Error.Message)
-	}
+	return c.ServerDonationAddressContext(context.Background())
+}
 
-	return res.Result.(string), nil
+// ServerDonationAddressContext is like ServerDonationAddress but uses the provided context to cancel the operation
+func (c *Client) ServerDonationAddressContext(ctx context.Context) (string, error) {
+	return Call[string](c, ctx, "server.donation_address")
 }
 
 // ServerFeatures returns a list of features and services supported by the server
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-donation-address
 func (c *Client) ServerFeatures() (*ServerInfo, error) {
-	info := new(ServerInfo)
-	switch c.Protocol {
-	case Protocol10:
-		return nil, ErrUnavailableMethod
-	default:
-		res, err := c.syncRequest(c.req("server.features"))
-		if err != nil {
-			return nil, err
-		}
+	return c.ServerFeaturesContext(context.Background())
+}
 
-		if res.Error != nil {
-			return nil, errors.New(res.Error.Message)
-		}
+// ServerFeaturesContext is like ServerFeatures but uses the provided context to cancel the operation
+func (c *Client) ServerFeaturesContext(ctx context.Context) (*ServerInfo, error) {
+	res, err := c.syncRequest(ctx, c.req("server.features"))
+	if err != nil {
+		return nil, err
+	}
 
-		b, err := json.Marshal(res.Result)
-		if err != nil {
-			return nil, err
-		}
-		if err = json.Unmarshal(b, &info); err != nil {
-			return nil, err
-		}
+	if res.Error != nil {
+		return nil, c.resError(res)
+	}
+
+	info := new(ServerInfo)
+	if err = c.decode(res, &info); err != nil {
+		return nil, err
 	}
 	return info, nil
 }
 
+// AddPeer will synchronously run a 'server.add_peer' operation, announcing a server with the
+// provided features to the connected server; the result reports whether the peer was accepted
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-add-peer
+func (c *Client) AddPeer(features *ServerInfo) (bool, error) {
+	return c.AddPeerContext(context.Background(), features)
+}
+
+// AddPeerContext is like AddPeer but uses the provided context to cancel the operation
+func (c *Client) AddPeerContext(ctx context.Context, features *ServerInfo) (bool, error) {
+	return Call[bool](c, ctx, "server.add_peer", features)
+}
+
 // ServerPeers returns a list of peer servers
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-peers-subscribe
 func (c *Client) ServerPeers() (peers []*Peer, err error) {
-	res, err := c.syncRequest(c.req("server.peers.subscribe"))
+	return c.ServerPeersContext(context.Background())
+}
+
+// ServerPeersContext is like ServerPeers but uses the provided context to cancel the operation
+func (c *Client) ServerPeersContext(ctx context.Context) (peers []*Peer, err error) {
+	res, err := c.syncRequest(ctx, c.req("server.peers.subscribe"))
 	if err != nil {
 		return
 	}
 
 	if res.Error != nil {
-		err = errors.New(res.Error.Message)
+		err = c.resError(res)
 		return
 	}
 
 	var list []interface{}
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return
-	}
-	if err = json.Unmarshal(b, &list); err != nil {
+	if err = c.decode(res, &list); err != nil {
 		return
 	}
+	peers = parsePeers(list)
+	return
+}
 
-	for _, l := range list {
-		p := &Peer{
-			Address: l.([]interface{})[0].(string),
-			Name:    l.([]interface{})[1].(string),
-		}
-		b, err := json.Marshal(l.([]interface{})[2])
-		if err != nil {
+// Decode a peers list; entries are provided as [address, name, [features...]] tuples,
+// malformed entries are ignored
+func parsePeers(list []interface{}) (peers []*Peer) {
+	for _, entry := range list {
+		l, _ := entry.([]interface{})
+		if len(l) < 3 {
 			continue
 		}
-		if err = json.Unmarshal(b, &p.Features); err != nil {
-			continue
+		p := &Peer{}
+		p.Address, _ = l[0].(string)
+		p.Name, _ = l[1].(string)
+		features, _ := l[2].([]interface{})
+		for _, f := range features {
+			if s, ok := f.(string); ok {
+				p.Features = append(p.Features, s)
+			}
 		}
 		peers = append(peers, p)
 	}
@@ -520,118 +1826,134 @@ func (c *Client) ServerPeers() (peers []*Peer, err error) {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-address-get-balance
 func (c *Client) AddressBalance(address string) (balance *Balance, err error) {
-	res, err := c.syncRequest(c.req("blockchain.address.get_balance", address))
-	if err != nil {
-		return
-	}
-
-	if res.Error != nil {
-		err = errors.New(res.Error.Message)
-		return
-	}
+	return c.AddressBalanceContext(context.Background(), address)
+}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return
-	}
-	if err = json.Unmarshal(b, &balance); err != nil {
-		return
-	}
-	return
+// AddressBalanceContext is like AddressBalance but uses the provided context to cancel the operation
+func (c *Client) AddressBalanceContext(ctx context.Context, address string) (balance *Balance, err error) {
+	return Call[*Balance](c, ctx, "blockchain.address.get_balance", address)
 }
 
 // AddressHistory will synchronously run a 'blockchain.address.get_history' operation
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-address-get-history
 func (c *Client) AddressHistory(address string) (list *[]Tx, err error) {
-	res, err := c.syncRequest(c.req("blockchain.address.get_history", address))
-	if err != nil {
-		return
-	}
-
-	if res.Error != nil {
-		err = errors.New(res.Error.Message)
-		return
-	}
+	return c.AddressHistoryContext(context.Background(), address)
+}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return
-	}
-	if err = json.Unmarshal(b, &list); err != nil {
-		return
-	}
-	return
+// AddressHistoryContext is like AddressHistory but uses the provided context to cancel the operation
+func (c *Client) AddressHistoryContext(ctx context.Context, address string) (list *[]Tx, err error) {
+	return Call[*[]Tx](c, ctx, "blockchain.address.get_history", address)
 }
 
 // AddressMempool will synchronously run a 'blockchain.address.get_mempool' operation
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-address-get-mempool
 func (c *Client) AddressMempool(address string) (list *[]Tx, err error) {
-	res, err := c.syncRequest(c.req("blockchain.address.get_mempool", address))
-	if err != nil {
-		return
-	}
-
-	if res.Error != nil {
-		err = errors.New(res.Error.Message)
-		return
-	}
+	return c.AddressMempoolContext(context.Background(), address)
+}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return
-	}
-	if err = json.Unmarshal(b, &list); err != nil {
-		return
-	}
-	return
+// AddressMempoolContext is like AddressMempool but uses the provided context to cancel the operation
+func (c *Client) AddressMempoolContext(ctx context.Context, address string) (list *[]Tx, err error) {
+	return Call[*[]Tx](c, ctx, "blockchain.address.get_mempool", address)
 }
 
 // AddressListUnspent will synchronously run a 'blockchain.address.listunspent' operation
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-address-listunspent
 func (c *Client) AddressListUnspent(address string) (list *[]Tx, err error) {
-	res, err := c.syncRequest(c.req("blockchain.address.listunspent", address))
-	if err != nil {
-		return
-	}
+	return c.AddressListUnspentContext(context.Background(), address)
+}
 
-	if res.Error != nil {
-		err = errors.New(res.Error.Message)
-		return
-	}
+// AddressListUnspentContext is like AddressListUnspent but uses the provided context to cancel the operation
+func (c *Client) AddressListUnspentContext(ctx context.Context, address string) (list *[]Tx, err error) {
+	return Call[*[]Tx](c, ctx, "blockchain.address.listunspent", address)
+}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
-		return
-	}
-	if err = json.Unmarshal(b, &list); err != nil {
-		return
-	}
-	return
+// ScriptHashBalance will synchronously run a 'blockchain.scripthash.get_balance' operation; script
+// hashes are supported on protocol 1.1 and newer
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-get-balance
+func (c *Client) ScriptHashBalance(scripthash string) (balance *Balance, err error) {
+	return c.ScriptHashBalanceContext(context.Background(), scripthash)
+}
+
+// ScriptHashBalanceContext is like ScriptHashBalance but uses the provided context to cancel the operation
+func (c *Client) ScriptHashBalanceContext(ctx context.Context, scripthash string) (balance *Balance, err error) {
+	return Call[*Balance](c, ctx, "blockchain.scripthash.get_balance", scripthash)
+}
+
+// ScriptHashHistory will synchronously run a 'blockchain.scripthash.get_history' operation; script
+// hashes are supported on protocol 1.1 and newer
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-get-history
+func (c *Client) ScriptHashHistory(scripthash string) (list *[]Tx, err error) {
+	return c.ScriptHashHistoryContext(context.Background(), scripthash)
+}
+
+// ScriptHashHistoryContext is like ScriptHashHistory but uses the provided context to cancel the operation
+func (c *Client) ScriptHashHistoryContext(ctx context.Context, scripthash string) (list *[]Tx, err error) {
+	return Call[*[]Tx](c, ctx, "blockchain.scripthash.get_history", scripthash)
+}
+
+// ScriptHashMempool will synchronously run a 'blockchain.scripthash.get_mempool' operation; script
+// hashes are supported on protocol 1.1 and newer
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-get-mempool
+func (c *Client) ScriptHashMempool(scripthash string) (list *[]Tx, err error) {
+	return c.ScriptHashMempoolContext(context.Background(), scripthash)
+}
+
+// ScriptHashMempoolContext is like ScriptHashMempool but uses the provided context to cancel the operation
+func (c *Client) ScriptHashMempoolContext(ctx context.Context, scripthash string) (list *[]Tx, err error) {
+	return Call[*[]Tx](c, ctx, "blockchain.scripthash.get_mempool", scripthash)
+}
+
+// ScriptHashListUnspent will synchronously run a 'blockchain.scripthash.listunspent' operation; script
+// hashes are supported on protocol 1.1 and newer
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-listunspent
+func (c *Client) ScriptHashListUnspent(scripthash string) (list *[]Tx, err error) {
+	return c.ScriptHashListUnspentContext(context.Background(), scripthash)
+}
+
+// ScriptHashListUnspentContext is like ScriptHashListUnspent but uses the provided context to cancel the operation
+func (c *Client) ScriptHashListUnspentContext(ctx context.Context, scripthash string) (list *[]Tx, err error) {
+	return Call[*[]Tx](c, ctx, "blockchain.scripthash.listunspent", scripthash)
 }
 
-// BlockHeader will synchronously run a 'blockchain.block.get_header' operation
+// BlockHeader will synchronously run a 'blockchain.block.get_header' operation, or a
+// 'blockchain.block.header' one on protocol 1.3 and newer; use BlockHeaderProof to get
+// the header along with its checkpoint proof
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-block-get-header
 func (c *Client) BlockHeader(index int) (header *BlockHeader, err error) {
-	res, err := c.syncRequest(c.req("blockchain.block.get_header", strconv.Itoa(index)))
+	return c.BlockHeaderContext(context.Background(), index)
+}
+
+// BlockHeaderContext is like BlockHeader but uses the provided context to cancel the operation
+func (c *Client) BlockHeaderContext(ctx context.Context, index int) (header *BlockHeader, err error) {
+	if c.usesHeaderMethod() {
+		return c.blockHeader(ctx, index, 0)
+	}
+	res, err := c.syncRequest(ctx, c.req("blockchain.block.get_header", strconv.Itoa(index)))
 	if err != nil {
 		return
 	}
 
 	if res.Error != nil {
-		err = errors.New(res.Error.Message)
+		err = c.resError(res)
 		return
 	}
 
-	b, err := json.Marshal(res.Result)
-	if err != nil {
+	if err = c.decode(res, &header); err != nil {
 		return
 	}
-	if err = json.Unmarshal(b, &header); err != nil {
-		return
+	if c.verify && header != nil {
+		completeHeader(header)
+		if header.BlockHeight != uint64(index) || !c.chain.link(header) {
+			header, err = nil, c.callError(res.req, ErrServerMismatch)
+		}
 	}
 	return
 }
@@ -640,71 +1962,218 @@ func (c *Client) BlockHeader(index int) (header *BlockHeader, err error) {
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-transaction-broadcast
 func (c *Client) BroadcastTransaction(hex string) (string, error) {
-	res, err := c.syncRequest(c.req("blockchain.transaction.broadcast", hex))
+	return c.BroadcastTransactionContext(context.Background(), hex)
+}
+
+// BroadcastTransactionContext is like BroadcastTransaction but uses the provided context to cancel the operation
+func (c *Client) BroadcastTransactionContext(ctx context.Context, hex string) (string, error) {
+	if c.preflight != nil {
+		if err := c.validateTx(ctx, hex); err != nil {
+			return "", err
+		}
+	}
+
+	res, err := c.syncRequest(ctx, c.req("blockchain.transaction.broadcast", hex))
 	if err != nil {
 		return "", err
 	}
 
-	if res.Result == nil || strings.Contains(res.Result.(string), "rejected") {
-		return "", ErrRejectedTx
+	// Since protocol 1.1 transactions rejected by the daemon are reported as
+	// error objects; other errors are not related to the transaction itself
+	if res.Error != nil {
+		err := c.resError(res)
+		if res.Error.Code == CodeBadRequest {
+			return "", &RejectedTxError{Reason: rejectReason(res.Error.Message), Err: err}
+		}
+		return "", err
+	}
+
+	// Protocol 1.0 servers report rejections as a result message instead
+	// of the transaction identifier
+	var txid string
+	if err := c.decode(res, &txid); err != nil {
+		return "", err
+	}
+	if !isHex(txid) {
+		return "", &RejectedTxError{Reason: txid}
+	}
+
+	if c.verify {
+		if id, err := TxID(hex); err != nil || id != txid {
+			return "", c.callError(res.req, ErrServerMismatch)
+		}
+	}
+	return txid, nil
+}
+
+// Extract the reason provided by the daemon from a broadcast error message; ElectrumX
+// reports it after a generic notice, followed by the submitted transaction
+func rejectReason(message string) string {
+	if i := strings.Index(message, "\n\n"); i >= 0 {
+		message = message[i+2:]
 	}
+	if i := strings.LastIndex(message, "\n["); i >= 0 {
+		message = message[:i]
+	}
+	return strings.TrimSpace(message)
+}
 
-	return res.Result.(string), nil
+// Check if a value is a non-empty hex-encoded string, e.g. a hash rather than a
+// rejection message
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
 }
 
 // GetTransaction will synchronously run a 'blockchain.transaction.get' operation
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain.transaction.get
 func (c *Client) GetTransaction(hash string) (string, error) {
-	res, err := c.syncRequest(c.req("blockchain.transaction.get", hash))
+	return c.GetTransactionContext(context.Background(), hash)
+}
+
+// GetTransactionContext is like GetTransaction but uses the provided context to cancel the operation
+func (c *Client) GetTransactionContext(ctx context.Context, hash string) (string, error) {
+	res, err := c.syncRequest(ctx, c.req("blockchain.transaction.get", hash))
 	if err != nil {
 		return "", err
 	}
 
 	if res.Error != nil {
-		return "", errors.New(res.Error.Message)
+		return "", c.resError(res)
 	}
 
-	return res.Result.(string), nil
+	var tx string
+	if err := c.decode(res, &tx); err != nil {
+		return "", err
+	}
+	if c.verify {
+		if id, err := TxID(tx); err != nil || id != hash {
+			return "", c.callError(res.req, ErrServerMismatch)
+		}
+	}
+	return tx, nil
 }
 
-// EstimateFee will synchronously run a 'blockchain.estimatefee' operation
+// GetTransactionVerbose will synchronously run a 'blockchain.transaction.get' operation in
+// verbose mode, returning the transaction details as decoded by the server's daemon
 //
-// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-estimatefee
-func (c *Client) EstimateFee(blocks int) (float64, error) {
-	res, err := c.syncRequest(c.req("blockchain.estimatefee", strconv.Itoa(blocks)))
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain.transaction.get
+func (c *Client) GetTransactionVerbose(hash string) (*TransactionInfo, error) {
+	return c.GetTransactionVerboseContext(context.Background(), hash)
+}
+
+// GetTransactionVerboseContext is like GetTransactionVerbose but uses the provided context to cancel the operation
+func (c *Client) GetTransactionVerboseContext(ctx context.Context, hash string) (*TransactionInfo, error) {
+	res, err := c.syncRequest(ctx, c.req("blockchain.transaction.get", hash, true))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if res.Error != nil {
-		return 0, errors.New(res.Error.Message)
+		return nil, c.resError(res)
+	}
+
+	info := new(TransactionInfo)
+	if err := c.decode(res, info); err != nil {
+		return nil, err
+	}
+	if c.verify && info.TxID != hash {
+		return nil, c.callError(res.req, ErrServerMismatch)
+	}
+	return info, nil
+}
+
+// Run a 'blockchain.estimatefee' operation
+func (c *Client) estimateFee(ctx context.Context, blocks int) (float64, error) {
+	return Call[float64](c, ctx, "blockchain.estimatefee", strconv.Itoa(blocks))
+}
+
+// EstimateFeeRate returns the result of EstimateFee as the amount of satoshis per kilobyte;
+// a negative value means the server's daemon doesn't have enough information to make
+// an estimate
+func (c *Client) EstimateFeeRate(blocks int) (Amount, error) {
+	return c.EstimateFeeRateContext(context.Background(), blocks)
+}
+
+// EstimateFeeRateContext is like EstimateFeeRate but uses the provided context to cancel the operation
+func (c *Client) EstimateFeeRateContext(ctx context.Context, blocks int) (Amount, error) {
+	fee, err := c.EstimateFeeContext(ctx, blocks)
+	if err != nil {
+		return 0, err
 	}
+	if fee < 0 {
+		return -1, nil
+	}
+	return AmountFromBTC(fee), nil
+}
+
+// RelayFee will synchronously run a 'blockchain.relayfee' operation, returning the minimum
+// fee, in satoshis per kilobyte, a transaction must pay to be accepted by the server's daemon
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-relayfee
+func (c *Client) RelayFee() (Amount, error) {
+	return c.RelayFeeContext(context.Background())
+}
 
-	return res.Result.(float64), nil
+// RelayFeeContext is like RelayFee but uses the provided context to cancel the operation
+func (c *Client) RelayFeeContext(ctx context.Context) (Amount, error) {
+	fee, err := Call[float64](c, ctx, "blockchain.relayfee")
+	if err != nil {
+		return 0, err
+	}
+	return AmountFromBTC(fee), nil
 }
 
 // TransactionMerkle will synchronously run a 'blockchain.transaction.get_merkle' operation
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-transaction-get-merkle
 func (c *Client) TransactionMerkle(tx string, height int) (tm *TxMerkle, err error) {
-	res, err := c.syncRequest(c.req("blockchain.transaction.get_merkle", tx, strconv.Itoa(height)))
+	return c.TransactionMerkleContext(context.Background(), tx, height)
+}
+
+// TransactionMerkleContext is like TransactionMerkle but uses the provided context to cancel the operation
+func (c *Client) TransactionMerkleContext(ctx context.Context, tx string, height int) (tm *TxMerkle, err error) {
+	return Call[*TxMerkle](c, ctx, "blockchain.transaction.get_merkle", tx, strconv.Itoa(height))
+}
+
+// TransactionIDFromPos will synchronously run a 'blockchain.transaction.id_from_pos' operation,
+// returning the identifier of the transaction at the given position in a block and, if requested,
+// its merkle branch
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-transaction-id-from-pos
+func (c *Client) TransactionIDFromPos(height, pos int, withMerkle bool) (string, []string, error) {
+	return c.TransactionIDFromPosContext(context.Background(), height, pos, withMerkle)
+}
+
+// TransactionIDFromPosContext is like TransactionIDFromPos but uses the provided context to cancel the operation
+func (c *Client) TransactionIDFromPosContext(ctx context.Context, height, pos int, withMerkle bool) (string, []string, error) {
+	res, err := c.syncRequest(ctx, c.req("blockchain.transaction.id_from_pos", height, pos, withMerkle))
 	if err != nil {
-		return
+		return "", nil, err
 	}
 
 	if res.Error != nil {
-		err = errors.New(res.Error.Message)
-		return
+		return "", nil, c.resError(res)
 	}
 
-	b, err := json.Marshal(res.Result)
-	log.Printf("%s", res.Result)
-	if err != nil {
-		return
+	if !withMerkle {
+		var txid string
+		if err := c.decode(res, &txid); err != nil {
+			return "", nil, err
+		}
+		return txid, nil, nil
 	}
-	if err = json.Unmarshal(b, &tm); err != nil {
-		return
+
+	var result struct {
+		Hash   string   `json:"tx_hash"`
+		Merkle []string `json:"merkle"`
 	}
-	return
+	if err := c.decode(res, &result); err != nil {
+		return "", nil, err
+	}
+	return result.Hash, result.Merkle, nil
 }
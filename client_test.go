@@ -1,14 +1,23 @@
 package electrum
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/fairbank-io/electrum/electrumtest"
 )
 
 func TestClient(t *testing.T) {
@@ -30,7 +39,7 @@ func TestClient(t *testing.T) {
 
 		t.Run("ServerPing", func(t *testing.T) {
 			err := client.ServerPing()
-			if err != ErrUnavailableMethod {
+			if !errors.Is(err, ErrUnavailableMethod) {
 				t.Error(err)
 				return
 			}
@@ -182,7 +191,7 @@ func TestClient(t *testing.T) {
 		t.Run("NotifyBlockHeaders", func(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
-			headers, err := client.NotifyBlockHeaders(ctx)
+			headers, _, err := client.NotifyBlockHeaders(ctx)
 			if err != nil {
 				t.Error(err)
 				return
@@ -200,7 +209,7 @@ func TestClient(t *testing.T) {
 		t.Run("NotifyAddressTransactions", func(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
-			txs, err := client.NotifyAddressTransactions(ctx, testAddress)
+			txs, _, err := client.NotifyAddressTransactions(ctx, testAddress)
 			if err != nil {
 				t.Error(err)
 				return
@@ -388,7 +397,7 @@ func TestClient(t *testing.T) {
 		t.Run("NotifyBlockHeaders", func(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
-			headers, err := client.NotifyBlockHeaders(ctx)
+			headers, _, err := client.NotifyBlockHeaders(ctx)
 			if err != nil {
 				t.Error(err)
 				return
@@ -406,7 +415,7 @@ func TestClient(t *testing.T) {
 		t.Run("NotifyAddressTransactions", func(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
-			txs, err := client.NotifyAddressTransactions(ctx, testAddress)
+			txs, _, err := client.NotifyAddressTransactions(ctx, testAddress)
 			if err != nil {
 				t.Error(err)
 				return
@@ -493,3 +502,1193 @@ func ExampleClient_ServerDonationAddress() {
 	fmt.Println(addr)
 	// Output: bc1q3jc48stsmulrvsyulpgyekfggfapxrpc3ertgk
 }
+
+func TestAddressStatus(t *testing.T) {
+	if s := addressStatus(nil); s != nil {
+		t.Errorf("unexpected status for empty history: %v", s)
+	}
+	s := addressStatus([]Tx{{Hash: "a1", Height: 100}, {Hash: "b2", Height: 101}})
+	if s != "bdd3f0b62da385cf5a4c845900e5e1fe090ce48d319baec740fc953c8554357b" {
+		t.Errorf("unexpected status: %v", s)
+	}
+}
+
+func TestKeepAliveDelay(t *testing.T) {
+	if d := keepAliveDelay(0, 0); d != 60*time.Second {
+		t.Errorf("unexpected delay without jitter: %s", d)
+	}
+	if d := keepAliveDelay(5*time.Second, 0); d != 5*time.Second {
+		t.Errorf("unexpected delay with custom interval: %s", d)
+	}
+	for i := 0; i < 100; i++ {
+		d := keepAliveDelay(0, 10*time.Second)
+		if d < 60*time.Second || d >= 70*time.Second {
+			t.Errorf("delay out of jitter window: %s", d)
+		}
+	}
+}
+
+func TestKeepAliveRequest(t *testing.T) {
+	c := &Client{Protocol: Protocol14}
+	if r := c.keepAliveRequest(); r.Method != "server.ping" {
+		t.Errorf("unexpected keep-alive method: %s", r.Method)
+	}
+	c = &Client{Protocol: Protocol11, protocolMin: Protocol10}
+	if r := c.keepAliveRequest(); r.Method != "server.version" {
+		t.Errorf("unexpected keep-alive method: %s", r.Method)
+	}
+	c.negotiated = Protocol12
+	if r := c.keepAliveRequest(); r.Method != "server.ping" {
+		t.Errorf("unexpected keep-alive method: %s", r.Method)
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	c := &Client{Protocol: Protocol10, protocolMin: Protocol10}
+	if v := c.protocolVersion(); v != Protocol10 {
+		t.Errorf("unexpected protocol argument: %v", v)
+	}
+	c = &Client{Protocol: Protocol12, protocolMin: Protocol11}
+	b, _ := (&request{Method: "server.version", Params: []interface{}{"agent", c.protocolVersion()}}).encode()
+	if !strings.Contains(string(b), `"params":["agent",["1.1","1.2"]]`) {
+		t.Errorf("unexpected request encoding: %s", b)
+	}
+}
+
+func TestRawError(t *testing.T) {
+	// Errors for a request are wrapped with its details, the raw error is still reachable
+	req := &request{Method: "server.unknown"}
+	res := &response{Error: &rpcError{Message: "unknown method"}, raw: []byte(`{"error":{"message":"unknown method"}}`), req: req}
+	var err *RawError
+	if errors.As((&Client{}).resError(res), &err) {
+		t.Error("raw error returned outside debug mode")
+	}
+	wrapped := (&Client{debug: true}).resError(res)
+	if !errors.As(wrapped, &err) {
+		t.Fatal("expected raw error in debug mode")
+	}
+	if err.Error() != "unknown method" || string(err.Raw()) != string(res.raw) {
+		t.Errorf("unexpected error contents: %s, %s", err, err.Raw())
+	}
+	var rpcErr *RPCError
+	if !errors.As(wrapped, &rpcErr) || rpcErr.Message != "unknown method" {
+		t.Errorf("unexpected error: %v", wrapped)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	req := &request{Method: "blockchain.address.get_balance", Params: []interface{}{"addr"}}
+	res := &response{Error: &rpcError{Message: "invalid params"}, req: req}
+	err := (&Client{}).resError(res)
+	if err.Error() != "blockchain.address.get_balance [addr]: invalid params" {
+		t.Errorf("unexpected error message: %s", err)
+	}
+	err = (&Client{redactParams: true}).resError(res)
+	if err.Error() != "blockchain.address.get_balance [redacted]: invalid params" {
+		t.Errorf("unexpected error message: %s", err)
+	}
+	var ce *CallError
+	if !errors.As(err, &ce) || ce.Method != req.Method {
+		t.Errorf("unexpected error value: %#v", err)
+	}
+}
+
+func TestRPCError(t *testing.T) {
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("blockchain.transaction.get", func([]json.RawMessage) (interface{}, error) {
+		return nil, &electrumtest.Error{Code: 2, Message: "daemon error: No such mempool transaction", Data: "details"}
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	_, err = client.GetTransaction("hash")
+	if !errors.Is(err, ErrDaemonError) || errors.Is(err, ErrBadRequest) {
+		t.Errorf("unexpected error class: %v", err)
+	}
+	var re *RPCError
+	if !errors.As(err, &re) {
+		t.Fatalf("unexpected error value: %#v", err)
+	}
+	if re.Code != CodeDaemonError || re.Message != "daemon error: No such mempool transaction" || re.Data != "details" {
+		t.Errorf("unexpected error contents: %+v", re)
+	}
+}
+
+func TestMaxInflight(t *testing.T) {
+	hold := make(chan struct{})
+	srv := newTestServer(t, map[string]string{"server.donation_address": `"address"`})
+	srv.HandleFunc("server.banner", func([]json.RawMessage) (interface{}, error) {
+		<-hold
+		return "Welcome", nil
+	})
+	client, err := New(&Options{
+		Address:      srv.Addr(),
+		MaxInflight:  1,
+		FailWhenBusy: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	done := make(chan error)
+	go func() {
+		_, err := client.ServerBanner()
+		done <- err
+	}()
+	for len(client.inflight) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := client.ServerDonationAddress(); !errors.Is(err, ErrBusy) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	close(hold)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if _, err := client.ServerDonationAddress(); err != nil {
+		t.Error(err)
+	}
+
+	// Waiting callers are released when their context is done
+	client.failBusy = false
+	client.inflight <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.ServerBannerContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	<-client.inflight
+}
+
+// Results for tests only checking requests reach the server
+var bannerResult = map[string]string{"server.banner": `"Welcome"`}
+
+// Start a test server answering the provided methods with raw JSON results; the server
+// is closed once the test completes
+func newTestServer(t *testing.T, results map[string]string) *electrumtest.Server {
+	srv := electrumtest.NewServer()
+	t.Cleanup(srv.Close)
+	for method, result := range results {
+		srv.Handle(method, json.RawMessage(result))
+	}
+	return srv
+}
+
+// Push a notification to the clients of a test server every millisecond until the
+// test completes
+func notifyRepeatedly(t *testing.T, srv *electrumtest.Server, method string, params ...interface{}) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				/* #nosec */
+				srv.Notify(method, params...)
+			}
+		}
+	}()
+}
+
+// Start a local server answering every request with the provided handler, which
+// returns the lines to write back, or the items of the result for batches; reserved for
+// tests requiring control over the wire, e.g. withheld responses or message ordering,
+// the rest use the electrumtest server
+func mockServer(t *testing.T, handler func(req *request) []string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				write := func(lines []string) error {
+					for _, l := range lines {
+						if _, err := conn.Write([]byte(l + "\n")); err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					// Batches are answered with a single array of results
+					if line[0] == '[' {
+						var batch []*request
+						if err := json.Unmarshal(line, &batch); err != nil {
+							return
+						}
+						var results []string
+						for _, req := range batch {
+							results = append(results, handler(req)...)
+						}
+						if err := write([]string{"[" + strings.Join(results, ",") + "]"}); err != nil {
+							return
+						}
+						continue
+					}
+					req := &request{}
+					if err := json.Unmarshal(line, req); err != nil {
+						return
+					}
+					if err := write(handler(req)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// Basic mock handler returning a fixed result for every method
+func mockResult(req *request) []string {
+	result := `"ok"`
+	if req.Method == "server.version" {
+		result = `["ElectrumX 1.8.5", "1.2"]`
+	}
+	return []string{fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":%s}`, req.ID, result)}
+}
+
+func TestClientShutdown(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"server.banner":                `"Welcome"`,
+		"blockchain.address.subscribe": `"status"`,
+	})
+	notifyRepeatedly(t, srv, "blockchain.address.subscribe", "address", "status")
+	for i := 0; i < 20; i++ {
+		client, err := New(&Options{Address: srv.Addr()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Subscriptions with consumers, and without
+		for j := 0; j < 3; j++ {
+			txs, _, err := client.NotifyAddressTransactions(context.Background(), "address")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if j == 0 {
+				continue
+			}
+			go func() {
+				for range txs {
+				}
+			}()
+		}
+
+		// In-flight requests
+		var wg sync.WaitGroup
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					if _, err := client.ServerBanner(); err != nil {
+						if !errors.Is(err, ErrConnClosed) && !errors.Is(err, ErrUnreachableHost) {
+							t.Error(err)
+						}
+						return
+					}
+				}
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		client.Close()
+		client.Close()
+		wg.Wait()
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	// Slow responses for the banner
+	srv := newTestServer(t, map[string]string{"blockchain.address.subscribe": `"status"`})
+	srv.HandleFunc("server.banner", func([]json.RawMessage) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		return "Welcome", nil
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, _, err := client.NotifyAddressTransactions(context.Background(), "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		for range txs {
+		}
+		close(closed)
+	}()
+
+	pending := make(chan error, 1)
+	go func() {
+		_, err := client.ServerBanner()
+		pending <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-pending; err != nil {
+		t.Errorf("pending request not completed: %v", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("subscription channel not closed")
+	}
+	if _, err := client.ServerBanner(); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := client.Start(context.Background()); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Pending requests are released when the context expires; version requests are
+	// only answered once the test completes
+	unanswered := make(chan struct{})
+	srv.HandleFunc("server.version", func([]json.RawMessage) (interface{}, error) {
+		<-unanswered
+		return nil, nil
+	})
+	t.Cleanup(func() { close(unanswered) })
+	client, err = New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, err := client.ServerVersion()
+		pending <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := <-pending; !errors.Is(err, ErrConnClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSubscriptionReaping(t *testing.T) {
+	unsubscribed := make(chan string, 1)
+	srv := newTestServer(t, map[string]string{"blockchain.address.subscribe": `"status"`})
+	srv.HandleFunc("blockchain.address.unsubscribe", func(params []json.RawMessage) (interface{}, error) {
+		var addr string
+		/* #nosec */
+		json.Unmarshal(params[0], &addr)
+		unsubscribed <- addr
+		return true, nil
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	txs, _, err := client.NotifyAddressTransactions(ctx, "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-txs
+	cancel()
+	for range txs {
+	}
+	select {
+	case addr := <-unsubscribed:
+		if addr != "address" {
+			t.Errorf("unexpected unsubscribe param: %s", addr)
+		}
+	case <-time.After(time.Second):
+		t.Error("no unsubscribe request received")
+	}
+	client.Lock()
+	defer client.Unlock()
+	if len(client.subs) != 0 {
+		t.Errorf("subscription not removed: %d registered", len(client.subs))
+	}
+}
+
+func TestSubscriptionLimit(t *testing.T) {
+	srv := newTestServer(t, map[string]string{"blockchain.address.subscribe": `"status"`})
+	client, err := New(&Options{Address: srv.Addr(), MaxSubscriptions: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.NotifyAddressTransactions(context.Background(), fmt.Sprintf("address-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := client.NotifyBlockHeaders(context.Background()); err != ErrTooManySubscriptions {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// Codec wrapper counting the number of operations performed
+type countingCodec struct {
+	stdCodec
+	calls int64
+}
+
+func (cc *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	atomic.AddInt64(&cc.calls, 1)
+	return cc.stdCodec.Unmarshal(data, v)
+}
+
+func TestCustomCodec(t *testing.T) {
+	codec := &countingCodec{}
+	client, err := New(&Options{Address: newTestServer(t, nil).Addr(), Codec: codec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.ServerVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&codec.calls) == 0 {
+		t.Error("custom codec not used")
+	}
+
+	// Requests are encoded the same regardless of the codec path taken
+	req := &request{Method: "blockchain.scripthash.get_history", Params: []interface{}{"<a&b>", 1}}
+	std, custom := new(bytes.Buffer), new(bytes.Buffer)
+	if err := req.encodeTo(std, stdCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := req.encodeTo(custom, codec); err != nil {
+		t.Fatal(err)
+	}
+	if std.String() != custom.String() {
+		t.Errorf("unexpected encoding: %q, %q", std.String(), custom.String())
+	}
+}
+
+// Mock handler returning the provided raw JSON results by method name, and the
+// basic mock results for any other method
+func mockMethods(results map[string]string) func(req *request) []string {
+	return func(req *request) []string {
+		if r, ok := results[req.Method]; ok {
+			return []string{fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":%s}`, req.ID, r)}
+		}
+		return mockResult(req)
+	}
+}
+
+func TestParseVersionInfo(t *testing.T) {
+	cases := []struct {
+		result   string
+		software string
+		protocol string
+	}{
+		{`"ElectrumX 1.2"`, "ElectrumX 1.2", "1.0"},
+		{`["ElectrumX 1.8.5", "1.2"]`, "ElectrumX 1.8.5", "1.2"},
+		{`["Fulcrum 1.9"]`, "Fulcrum 1.9", "1.0"},
+		{`{"software": "electrs 0.9", "protocol": "1.4"}`, "electrs 0.9", "1.4"},
+	}
+	for _, c := range cases {
+		var result interface{}
+		if err := json.Unmarshal([]byte(c.result), &result); err != nil {
+			t.Fatal(err)
+		}
+		info, err := parseVersionInfo(result, Protocol10)
+		if err != nil || info.Software != c.software || info.Protocol != c.protocol {
+			t.Errorf("%s: unexpected result %+v, %v", c.result, info, err)
+		}
+	}
+	for _, r := range []interface{}{nil, 1.0, []interface{}{}, []interface{}{1.0, "1.2"}, map[string]interface{}{}} {
+		if _, err := parseVersionInfo(r, Protocol12); err != ErrInvalidResult {
+			t.Errorf("%v: unexpected error %v", r, err)
+		}
+	}
+}
+
+func TestVerifyResponses(t *testing.T) {
+	// Headers at heights 100 and 101 are linked, the one at 102 is not
+	raw, _ := hex.DecodeString(genesisHeader)
+	genesis, err := parseHeader(raw, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := func(height int, prev string) string {
+		return fmt.Sprintf(`{"block_height":%d,"version":%d,"prev_block_hash":"%s","merkle_root":"%s","timestamp":%d,"bits":%d,"nonce":%d}`,
+			height, genesis.Version, prev, genesis.MerkleRoot, genesis.Timestamp, genesis.Bits, genesis.Nonce)
+	}
+	const genesisHash = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	segwitID, _ := TxID(strippedTx)
+	srv := newTestServer(t, map[string]string{"blockchain.transaction.broadcast": `"0000"`})
+	srv.HandleFunc("blockchain.transaction.get", func(params []json.RawMessage) (interface{}, error) {
+		var txid string
+		/* #nosec */
+		json.Unmarshal(params[0], &txid)
+		if txid == segwitID {
+			return segwitTx, nil
+		}
+		return genesisCoinbase, nil
+	})
+	srv.HandleFunc("blockchain.block.get_header", func(params []json.RawMessage) (interface{}, error) {
+		var height string
+		/* #nosec */
+		json.Unmarshal(params[0], &height)
+		switch height {
+		case "101":
+			return json.RawMessage(header(101, genesisHash)), nil
+		case "102":
+			return json.RawMessage(header(102, genesis.PrevBlockHash)), nil
+		}
+		return json.RawMessage(header(100, genesis.PrevBlockHash)), nil
+	})
+	client, err := New(&Options{
+		Address:         srv.Addr(),
+		VerifyResponses: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.GetTransaction(genesisCoinbaseID); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.GetTransaction(segwitID); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.GetTransaction("0000"); !errors.Is(err, ErrServerMismatch) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.BroadcastTransaction(genesisCoinbase); !errors.Is(err, ErrServerMismatch) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.BlockHeader(100); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.BlockHeader(101); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.BlockHeader(102); !errors.Is(err, ErrServerMismatch) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.BlockHeader(103); !errors.Is(err, ErrServerMismatch) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	client, err := New(&Options{Address: newTestServer(t, map[string]string{
+		"blockchain.address.get_balance": `"not a balance"`,
+		"server.banner":                  `{"banner":1}`,
+	}).Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	_, err = client.AddressBalance("address")
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrInvalidResult) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if de.Expected != "electrum.Balance" || de.Payload != `"not a balance"` {
+		t.Errorf("unexpected error details: %+v", de)
+	}
+	if _, err := client.ServerBanner(); !errors.Is(err, ErrInvalidResult) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSubscriptionOrder(t *testing.T) {
+	const total = 200
+	client, err := New(&Options{Address: mockServer(t, func(req *request) []string {
+		lines := mockResult(req)
+		if req.Method == "blockchain.address.subscribe" {
+			for i := 0; i < total; i++ {
+				lines = append(lines, fmt.Sprintf(`{"jsonrpc":"2.0","method":"%s","params":["address","%d"]}`, req.Method, i))
+			}
+		}
+		return lines
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	txs, _, err := client.NotifyAddressTransactions(ctx, "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if initial := <-txs; initial.Status != "ok" {
+		t.Fatalf("unexpected initial status: %s", initial.Status)
+	}
+	for i := 0; i < total; i++ {
+		if s := <-txs; s.Status != fmt.Sprint(i) {
+			t.Fatalf("unexpected event order, got %s expecting %d", s.Status, i)
+		}
+	}
+}
+
+func TestClientConnect(t *testing.T) {
+	// Server unavailable when the connection is required
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	client, err := NewClient(&Options{Address: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Connect(context.Background()); err == nil {
+		t.Error("connection to unavailable server succeeded")
+	}
+
+	client, err = NewClient(&Options{Address: newTestServer(t, bannerResult).Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		if err := client.Connect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.ServerBanner(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientLifecycle(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"server.banner":                `"Welcome"`,
+		"blockchain.address.subscribe": `"status"`,
+	})
+	notifyRepeatedly(t, srv, "blockchain.address.subscribe", "address", "status")
+	client, err := NewClient(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.ServerBanner(); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("unexpected error before start: %v", err)
+	}
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Start(context.Background()); err != ErrAlreadyStarted {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	txs, _, err := client.NotifyAddressTransactions(context.Background(), "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received int64
+	closed := make(chan bool)
+	go func() {
+		for range txs {
+			atomic.AddInt64(&received, 1)
+		}
+		close(closed)
+	}()
+
+	// Subscriptions survive restarts
+	if err := client.Restart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServerBanner(); err != nil {
+		t.Error(err)
+	}
+	count := atomic.LoadInt64(&received)
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt64(&received) == count {
+		t.Error("no notifications received after restart")
+	}
+
+	client.Stop()
+	if _, err := client.ServerBanner(); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("unexpected error after stop: %v", err)
+	}
+	client.Close()
+	<-closed
+
+	var ce *CallError
+	if _, err := client.ServerBanner(); !errors.Is(err, ErrClientClosed) || !errors.As(err, &ce) || ce.Method != "server.banner" {
+		t.Errorf("unexpected error after close: %v", err)
+	}
+
+	// Closed clients can't be started again
+	if err := client.Start(context.Background()); err != ErrClientClosed {
+		t.Errorf("unexpected error after close: %v", err)
+	}
+	if err := client.Restart(context.Background()); err != ErrClientClosed {
+		t.Errorf("unexpected error after close: %v", err)
+	}
+}
+
+func TestCallInfo(t *testing.T) {
+	var calls []*CallInfo
+	addr := newTestServer(t, map[string]string{
+		"server.version": `["ElectrumX 1.16", "1.1"]`,
+		"server.banner":  `"welcome"`,
+	}).Addr()
+	client, err := New(&Options{
+		Address: addr,
+		OnCall:  func(info *CallInfo) { calls = append(calls, info) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.ServerVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServerBanner(); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", len(calls))
+	}
+	if calls[0].Method != "server.version" || calls[0].Protocol != Protocol12 {
+		t.Errorf("unexpected call info: %+v", calls[0])
+	}
+	info := calls[1]
+	if info.Method != "server.banner" || info.Server != addr || info.Protocol != Protocol11 {
+		t.Errorf("unexpected call info: %+v", info)
+	}
+	if info.Size == 0 || info.Latency <= 0 || info.Err != nil {
+		t.Errorf("unexpected call info: %+v", info)
+	}
+}
+
+func TestSubscribeWithSnapshot(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"blockchain.headers.subscribe":    `{"block_height":100}`,
+		"blockchain.address.subscribe":    `"initial"`,
+		"blockchain.scripthash.subscribe": `null`,
+	})
+	notifyRepeatedly(t, srv, "blockchain.address.subscribe", "address", "status")
+	notifyRepeatedly(t, srv, "blockchain.headers.subscribe", map[string]int{"block_height": 101})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	status, txs, err := client.SubscribeAddressTransactions(ctx, "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "initial" {
+		t.Errorf("unexpected status: %s", status)
+	}
+	if s := <-txs; s.Address != "address" || s.Status != "status" {
+		t.Errorf("unexpected notification: %+v", s)
+	}
+
+	// Script hashes without history have an empty status
+	status, _, err = client.SubscribeScriptHash(ctx, "scripthash")
+	if err != nil || status != "" {
+		t.Errorf("unexpected status: %q, %v", status, err)
+	}
+
+	tip, headers, err := client.SubscribeBlockHeaders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip.BlockHeight != 100 {
+		t.Errorf("unexpected tip: %+v", tip)
+	}
+	if h := <-headers; h.BlockHeight != 101 {
+		t.Errorf("unexpected notification: %+v", h)
+	}
+
+	// Subscriptions terminated before the initial result is received fail
+	client.Close()
+	if _, _, err := client.SubscribeBlockHeaders(ctx); err == nil {
+		t.Error("expected subscription to fail")
+	}
+}
+
+func TestScriptHashMethods(t *testing.T) {
+	const history = `[{"tx_hash":"aa","height":10},{"tx_hash":"bb","height":0,"fee":200}]`
+	client, err := New(&Options{Address: newTestServer(t, map[string]string{
+		"blockchain.scripthash.get_balance": `{"confirmed":1000,"unconfirmed":-200}`,
+		"blockchain.scripthash.get_history": history,
+		"blockchain.scripthash.get_mempool": history,
+		"blockchain.scripthash.listunspent": `[{"tx_hash":"aa","tx_pos":1,"height":10,"value":1000}]`,
+	}).Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	const scripthash = "8b01df4e368ea28f8dc0423bcf7a4923e3a12d307c875e47a0cfbf90b5c39161"
+	balance, err := client.ScriptHashBalance(scripthash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Confirmed != 1000 || balance.Unconfirmed != -200 {
+		t.Errorf("unexpected balance: %+v", balance)
+	}
+	for _, fn := range []func(string) (*[]Tx, error){client.ScriptHashHistory, client.ScriptHashMempool} {
+		list, err := fn(scripthash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(*list) != 2 || (*list)[0].Hash != "aa" || (*list)[0].Height != 10 {
+			t.Errorf("unexpected history: %+v", *list)
+		}
+	}
+	utxos, err := client.ScriptHashListUnspent(scripthash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*utxos) != 1 || (*utxos)[0].Value != 1000 || (*utxos)[0].Pos != 1 {
+		t.Errorf("unexpected utxos: %+v", *utxos)
+	}
+
+	client.Protocol = Protocol10
+	if _, err := client.ScriptHashBalance(scripthash); !errors.Is(err, ErrUnavailableMethod) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNotifyAddressTransactions(t *testing.T) {
+	srv := newTestServer(t, map[string]string{"blockchain.address.subscribe": `null`})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	txs, _, err := client.NotifyAddressTransactions(ctx, "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := <-txs; s.Address != "address" || s.Status != "" {
+		t.Errorf("unexpected initial status %q", s.Status)
+	}
+	/* #nosec */
+	srv.Notify("blockchain.address.subscribe", "address", "updated")
+	if s := <-txs; s.Address != "address" || s.Status != "updated" {
+		t.Errorf("unexpected status %q, expecting %q", s.Status, "updated")
+	}
+	cancel()
+	for range txs {
+	}
+}
+
+func TestNotifyScriptHash(t *testing.T) {
+	srv := newTestServer(t, map[string]string{"blockchain.scripthash.subscribe": `null`})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statuses, _, err := client.NotifyScriptHash(ctx, "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := <-statuses; s.ScriptHash != "scripthash" || s.Status != "" {
+		t.Errorf("unexpected initial status %q", s.Status)
+	}
+
+	// Notifications for other script hashes are ignored
+	/* #nosec */
+	srv.Notify("blockchain.scripthash.subscribe", "other", "ignored")
+	/* #nosec */
+	srv.Notify("blockchain.scripthash.subscribe", "scripthash", "updated")
+	if s := <-statuses; s.ScriptHash != "scripthash" || s.Status != "updated" {
+		t.Errorf("unexpected status %q, expecting %q", s.Status, "updated")
+	}
+	cancel()
+	for range statuses {
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	var mu sync.Mutex
+	unsubscribed := map[string]int{}
+	srv := newTestServer(t, map[string]string{
+		"blockchain.address.subscribe":    `"status"`,
+		"blockchain.scripthash.subscribe": `"status"`,
+	})
+	for _, method := range []string{"blockchain.address.unsubscribe", "blockchain.scripthash.unsubscribe"} {
+		srv.HandleFunc(method, func(params []json.RawMessage) (interface{}, error) {
+			var key string
+			/* #nosec */
+			json.Unmarshal(params[0], &key)
+			mu.Lock()
+			unsubscribed[key]++
+			mu.Unlock()
+			return true, nil
+		})
+	}
+	addr := srv.Addr()
+
+	// Script hash subscriptions can be cancelled since protocol 1.4.2, while
+	// address subscriptions are only available before protocol 1.3
+	modern, err := New(&Options{Address: addr, Protocol: "1.4.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer modern.Close()
+	legacy, err := New(&Options{Address: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close()
+
+	ctx := context.Background()
+	statuses, _, err := modern.NotifyScriptHash(ctx, "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, _, err := legacy.NotifyAddressTransactions(ctx, "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Consumers must keep reading for notifications to be routed
+	closed := make(chan struct{}, 2)
+	go func() {
+		for range statuses {
+		}
+		closed <- struct{}{}
+	}()
+	go func() {
+		for range txs {
+		}
+		closed <- struct{}{}
+	}()
+
+	if active, err := modern.UnsubscribeScriptHash("scripthash"); err != nil || !active {
+		t.Fatalf("unexpected result: %v, %v", active, err)
+	}
+	if active, err := legacy.UnsubscribeAddress("address"); err != nil || !active {
+		t.Fatalf("unexpected result: %v, %v", active, err)
+	}
+	if _, err := legacy.UnsubscribeScriptHash("scripthash"); !errors.Is(err, ErrUnavailableMethod) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Channels are closed once the server confirms
+	for i := 0; i < 2; i++ {
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("channel not closed")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if unsubscribed["scripthash"] != 1 || unsubscribed["address"] != 1 {
+		t.Errorf("unexpected unsubscribe requests: %v", unsubscribed)
+	}
+}
+
+func TestTransactionIDFromPos(t *testing.T) {
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("blockchain.transaction.id_from_pos", func(params []json.RawMessage) (interface{}, error) {
+		if string(params[2]) == "true" {
+			return json.RawMessage(`{"tx_hash":"aa","merkle":["bb","cc"]}`), nil
+		}
+		return "aa", nil
+	})
+	client, err := New(&Options{Protocol: Protocol14, Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	txid, merkle, err := client.TransactionIDFromPos(100, 1, false)
+	if err != nil || txid != "aa" || merkle != nil {
+		t.Errorf("unexpected result: %s, %v, %v", txid, merkle, err)
+	}
+	txid, merkle, err = client.TransactionIDFromPos(100, 1, true)
+	if err != nil || txid != "aa" || len(merkle) != 2 || merkle[1] != "cc" {
+		t.Errorf("unexpected result: %s, %v, %v", txid, merkle, err)
+	}
+}
+
+func TestGetTransactionVerbose(t *testing.T) {
+	client, err := New(&Options{Address: newTestServer(t, map[string]string{
+		"blockchain.transaction.get": `{ "txid": "aa", "hash": "aa", "size": 225, "vsize": 144, "version": 2, "locktime": 0, "vin": [{"txid": "bb", "vout": 1, "scriptSig": {"asm": "", "hex": ""}, "txinwitness": ["30", "02"], "sequence": 4294967295}], "vout": [{"value": 0.015, "n": 0, "scriptPubKey": {"hex": "0014", "type": "witness_v0_keyhash", "address": "bc1q"}}], "blockhash": "cc", "confirmations": 6, "time": 1600000000, "blocktime": 1600000000 }`,
+	}).Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	info, err := client.GetTransactionVerbose("aa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.TxID != "aa" || info.VSize != 144 || info.Confirmations != 6 || info.BlockHash != "cc" {
+		t.Errorf("unexpected transaction: %+v", info)
+	}
+	if len(info.Inputs) != 1 || info.Inputs[0].TxID != "bb" || info.Inputs[0].Vout != 1 || len(info.Inputs[0].Witness) != 2 {
+		t.Errorf("unexpected inputs: %+v", info.Inputs)
+	}
+	if len(info.Outputs) != 1 || info.Outputs[0].Amount() != 1500000 || info.Outputs[0].ScriptPubKey.Address != "bc1q" {
+		t.Errorf("unexpected outputs: %+v", info.Outputs)
+	}
+}
+
+func TestAddPeer(t *testing.T) {
+	var announced map[string]interface{}
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("server.add_peer", func(params []json.RawMessage) (interface{}, error) {
+		/* #nosec */
+		json.Unmarshal(params[0], &announced)
+		return true, nil
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	accepted, err := client.AddPeer(&ServerInfo{
+		GenesisHash:   "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+		HashFunction:  "sha256",
+		ServerVersion: "ElectrumX 1.16",
+		ProtocolMax:   "1.4",
+		ProtocolMin:   "1.1",
+	})
+	if err != nil || !accepted {
+		t.Fatalf("unexpected result: %v, %v", accepted, err)
+	}
+	if announced["server_version"] != "ElectrumX 1.16" || announced["protocol_min"] != "1.1" {
+		t.Errorf("unexpected features: %v", announced)
+	}
+}
+
+func TestNegotiateProtocol(t *testing.T) {
+	var advertised []interface{}
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("server.version", func(params []json.RawMessage) (interface{}, error) {
+		/* #nosec */
+		json.Unmarshal(params[1], &advertised)
+		return []string{"ElectrumX 1.8.5", "1.1"}, nil
+	})
+	client, err := New(&Options{
+		Address:           srv.Addr(),
+		NegotiateProtocol: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if len(advertised) != 2 || advertised[0] != Protocol10 || advertised[1] != Protocol14 {
+		t.Errorf("unexpected advertised range: %v", advertised)
+	}
+	if p := client.NegotiatedProtocol(); p != Protocol11 {
+		t.Errorf("unexpected negotiated protocol: %s", p)
+	}
+
+	// Methods are enabled according to the negotiated version
+	var ce *CallError
+	if err := client.ServerPing(); !errors.Is(err, ErrUnavailableMethod) || !errors.As(err, &ce) || ce.Method != "server.ping" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.BlockHeaders(0, 1); !errors.Is(err, ErrUnavailableMethod) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.ScriptHashHistory("scripthash"); errors.Is(err, ErrUnavailableMethod) {
+		t.Error("expected method to be available")
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	client, err := New(&Options{Address: mockServer(t, func(req *request) []string {
+		// Never answer balance requests
+		if req.Method == "blockchain.address.get_balance" {
+			return nil
+		}
+		return mockResult(req)
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.AddressBalanceContext(ctx, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Abandoned requests don't affect later operations
+	if _, err := client.ServerBannerContext(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	client, err := New(&Options{
+		Address: mockServer(t, func(req *request) []string {
+			if req.Method == "server.banner" {
+				return nil
+			}
+			return mockResult(req)
+		}),
+		RequestTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.ServerBanner(); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.GetTransactions(context.Background(), []string{"hash"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,326 @@
+// Watchtower monitors a set of addresses on an Electrum server and notifies
+// webhooks about incoming payments and their confirmations.
+//
+// Usage:
+//
+//	watchtower -config watchtower.json
+//
+// The configuration file is a JSON document:
+//
+//	{
+//	  "server": "ssl://electrum.example.com:50002",
+//	  "addresses": ["1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"],
+//	  "webhooks": ["https://example.com/hooks/payments"],
+//	  "confirmations": 3,
+//	  "network": "mainnet"
+//	}
+//
+// The network used to decode the addresses is one of 'mainnet', the default, 'testnet'
+// or 'regtest'; addresses are tracked using their script hashes, so any server
+// supporting protocol 1.1 or newer can be used.
+//
+// Events are delivered as JSON documents using HTTP POST requests:
+//
+//	{"type": "payment", "address": "...", "tx_hash": "...", "height": 0, "confirmations": 0}
+//
+// A 'payment' event is sent when a transaction is first seen on the history of an address,
+// and a 'confirmation' event once it reaches the configured number of confirmations; each
+// event is sent once per address and transaction. Unconfirmed transactions are reported
+// with a height of 0, or -1 when spending other unconfirmed outputs.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/fairbank-io/electrum"
+)
+
+// Config of the watchtower instance
+type Config struct {
+	Server        string   `json:"server"`
+	Addresses     []string `json:"addresses"`
+	Webhooks      []string `json:"webhooks"`
+	Confirmations int      `json:"confirmations"`
+	Network       string   `json:"network"`
+}
+
+// Supported networks, by name
+var networks = map[string]*electrum.NetworkParams{
+	"mainnet": electrum.MainNetParams,
+	"testnet": electrum.TestNetParams,
+	"regtest": electrum.RegTestParams,
+}
+
+// Event published to the webhooks
+type Event struct {
+	Type          string `json:"type"`
+	Address       string `json:"address"`
+	TxHash        string `json:"tx_hash"`
+	Height        int64  `json:"height"`
+	Confirmations int    `json:"confirmations"`
+}
+
+// Transaction seen on the history of a watched address
+type txKey struct {
+	address string
+	hash    string
+}
+
+// Tracked state of a transaction
+type txState struct {
+	height    int64
+	confirmed bool
+}
+
+type watchtower struct {
+	conf   *Config
+	params *electrum.NetworkParams
+	client *electrum.Client
+	http   *http.Client
+	txs    map[txKey]*txState
+	tip    uint64
+	mu     sync.Mutex
+}
+
+func main() {
+	path := flag.String("config", "watchtower.json", "configuration file")
+	flag.Parse()
+
+	conf, err := loadConfig(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client, err := electrum.New(&electrum.Options{
+		Address:   conf.Server,
+		KeepAlive: true,
+		Agent:     "watchtower",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	w := &watchtower{
+		conf:   conf,
+		params: networks[conf.Network],
+		client: client,
+		http:   &http.Client{Timeout: 10 * time.Second},
+		txs:    make(map[txKey]*txState),
+	}
+	if err := w.run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Load and validate the configuration file
+func loadConfig(path string) (*Config, error) {
+	f, err := os.Open(path) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	conf := new(Config)
+	if err := json.NewDecoder(f).Decode(conf); err != nil {
+		return nil, err
+	}
+	if conf.Confirmations <= 0 {
+		conf.Confirmations = 1
+	}
+	if conf.Network == "" {
+		conf.Network = "mainnet"
+	}
+	if _, ok := networks[conf.Network]; !ok {
+		return nil, fmt.Errorf("unsupported network: %s", conf.Network)
+	}
+	return conf, nil
+}
+
+// Watch the chain tip and the configured addresses until the context is done
+func (w *watchtower) run(ctx context.Context) error {
+	tip, headers, err := w.client.SubscribeBlockHeaders(ctx)
+	if err != nil {
+		return err
+	}
+	w.tip = tip.BlockHeight
+
+	// Addresses are subscribed before loading their history, so no change is missed
+	for _, address := range w.conf.Addresses {
+		scripthash, err := electrum.ScriptHashFromAddress(address, w.params)
+		if err != nil {
+			return fmt.Errorf("invalid address %s: %w", address, err)
+		}
+		status, statuses, err := w.client.SubscribeScriptHash(ctx, scripthash)
+		if err != nil {
+			return err
+		}
+		if err := w.load(ctx, address, scripthash, status); err != nil {
+			return err
+		}
+		go func(address, scripthash string) {
+			for range statuses {
+				if err := w.scan(ctx, address, scripthash); err != nil {
+					log.Println(err)
+				}
+			}
+		}(address, scripthash)
+	}
+
+	for header := range headers {
+		w.mu.Lock()
+		w.tip = header.BlockHeight
+		w.mu.Unlock()
+		w.checkConfirmations()
+	}
+	return ctx.Err()
+}
+
+// Load the existing history of an address without generating events; the status reported
+// when subscribing identifies the history known at that point, transactions received
+// afterwards are still published. When the status matches no part of the history, e.g.
+// some transaction got confirmed meanwhile, the whole history is considered existing
+func (w *watchtower) load(ctx context.Context, address, scripthash, status string) error {
+	history, err := w.history(ctx, scripthash)
+	if err != nil {
+		return err
+	}
+	known := len(history)
+	for n := 0; n <= len(history); n++ {
+		if historyStatus(history[:n]) == status {
+			known = n
+			break
+		}
+	}
+	w.record(address, history[:known], false)
+	w.record(address, history[known:], true)
+	return nil
+}
+
+// Load the history of an address, publishing events for new and updated transactions
+func (w *watchtower) scan(ctx context.Context, address, scripthash string) error {
+	history, err := w.history(ctx, scripthash)
+	if err != nil {
+		return err
+	}
+	w.record(address, history, true)
+	return nil
+}
+
+// History of a script hash, in the order reported by the server
+func (w *watchtower) history(ctx context.Context, scripthash string) ([]electrum.Tx, error) {
+	history, err := w.client.ScriptHashHistoryContext(ctx, scripthash)
+	if err != nil || history == nil {
+		return nil, err
+	}
+	return *history, nil
+}
+
+// Status of a history as calculated by the server, empty for no history
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-basics.html#status
+func historyStatus(history []electrum.Tx) string {
+	if len(history) == 0 {
+		return ""
+	}
+	status := ""
+	for _, tx := range history {
+		status += fmt.Sprintf("%s:%d:", tx.Hash, tx.Height)
+	}
+	h := sha256.Sum256([]byte(status))
+	return hex.EncodeToString(h[:])
+}
+
+// Track the transactions on the history of an address, publishing events for new and
+// updated ones when notifying
+func (w *watchtower) record(address string, history []electrum.Tx, notify bool) {
+	// Heights are updated on every scan, e.g. transactions dropped back to the mempool
+	// after a reorganization are no longer confirmed
+	var events []*Event
+	w.mu.Lock()
+	for _, tx := range history {
+		key := txKey{address: address, hash: tx.Hash}
+		state, ok := w.txs[key]
+		if !ok {
+			state = new(txState)
+			w.txs[key] = state
+			events = append(events, &Event{Type: "payment", Address: address, TxHash: tx.Hash, Height: tx.Height})
+		}
+		state.height = tx.Height
+		if !notify {
+			state.confirmed = w.confirmations(state) >= w.conf.Confirmations
+		}
+	}
+	w.mu.Unlock()
+
+	if notify {
+		for _, e := range events {
+			w.publish(e)
+		}
+		w.checkConfirmations()
+	}
+}
+
+// Publish confirmation events for transactions reaching the required depth
+func (w *watchtower) checkConfirmations() {
+	var events []*Event
+	w.mu.Lock()
+	for key, state := range w.txs {
+		n := w.confirmations(state)
+		if state.confirmed || n < w.conf.Confirmations {
+			continue
+		}
+		state.confirmed = true
+		events = append(events, &Event{
+			Type:          "confirmation",
+			Address:       key.address,
+			TxHash:        key.hash,
+			Height:        state.height,
+			Confirmations: n,
+		})
+	}
+	w.mu.Unlock()
+	for _, e := range events {
+		w.publish(e)
+	}
+}
+
+// Number of confirmations of a transaction, must be called with the lock held
+func (w *watchtower) confirmations(state *txState) int {
+	if state.height <= 0 || uint64(state.height) > w.tip {
+		return 0
+	}
+	return int(w.tip-uint64(state.height)) + 1
+}
+
+// Deliver an event to all configured webhooks
+func (w *watchtower) publish(e *Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, hook := range w.conf.Webhooks {
+		res, err := w.http.Post(hook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("webhook %s failed: %s\n", hook, err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode >= 300 {
+			log.Printf("webhook %s failed with status: %s\n", hook, res.Status)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum"
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+const (
+	address    = "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	scripthash = "8b01df4e368ea28f8dc0423bcf7a4923e3a12d307c875e47a0cfbf90b5c39161"
+)
+
+func TestScan(t *testing.T) {
+	var mu sync.Mutex
+	history := []electrum.Tx{{Hash: "aa", Height: 100}, {Hash: "bb", Height: 0}}
+	var events []*Event
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := new(Event)
+		if err := json.NewDecoder(r.Body).Decode(e); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.HandleFunc("blockchain.scripthash.get_history", func(params []json.RawMessage) (interface{}, error) {
+		if string(params[0]) != `"`+scripthash+`"` {
+			t.Errorf("unexpected script hash: %s", params[0])
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]electrum.Tx(nil), history...), nil
+	})
+	client, err := electrum.New(&electrum.Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	w := &watchtower{
+		conf:   &Config{Webhooks: []string{hook.URL}, Confirmations: 2},
+		client: client,
+		http:   &http.Client{Timeout: time.Second},
+		txs:    make(map[txKey]*txState),
+		tip:    100,
+	}
+
+	// History known when subscribing doesn't generate events, transactions received
+	// afterwards do
+	ctx := context.Background()
+	if err := w.load(ctx, address, scripthash, historyStatus(history[:1])); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(events) != 1 || events[0].Type != "payment" || events[0].TxHash != "bb" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+	events = nil
+
+	// New transactions are reported once, even when spending unconfirmed outputs
+	history = append(history, electrum.Tx{Hash: "cc", Height: -1})
+	mu.Unlock()
+	for i := 0; i < 2; i++ {
+		if err := w.scan(ctx, address, scripthash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	if len(events) != 1 || events[0].Type != "payment" || events[0].TxHash != "cc" || events[0].Height != -1 {
+		t.Errorf("unexpected events: %+v", events)
+	}
+	events = nil
+	mu.Unlock()
+
+	// Confirmations are reported once the required depth is reached
+	w.mu.Lock()
+	w.tip = 101
+	w.mu.Unlock()
+	w.checkConfirmations()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0].Type != "confirmation" || events[0].TxHash != "aa" || events[0].Confirmations != 2 {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
@@ -0,0 +1,24 @@
+package electrum
+
+import "encoding/json"
+
+// Codec provides the encoding and decoding of protocol messages; custom implementations
+// can be provided to use alternative JSON libraries with better performance
+type Codec interface {
+	// Marshal returns the JSON encoding of v
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal parses the JSON-encoded data and stores the result in the value pointed to by v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Default codec based on the standard library 'encoding/json' package
+type stdCodec struct{}
+
+func (stdCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,121 @@
+package electrum
+
+import (
+	"context"
+)
+
+// Conflict describes a transaction spending the same output as a watched transaction
+type Conflict struct {
+	// Identifier of the watched transaction
+	TxID string
+
+	// Identifier of the conflicting transaction
+	ConflictingTxID string
+
+	// Output spent by both transactions
+	Outpoint Outpoint
+}
+
+// WatchConflicts monitors an unconfirmed transaction for conflicting spends, i.e. other
+// transactions spending any of its inputs, as seen on the history and mempool of the
+// provided addresses; usually the addresses owning the inputs of the watched transaction.
+// Detected conflicts are delivered on the returned channel, which is closed when the
+// context is done
+func (c *Client) WatchConflicts(ctx context.Context, txid string, addresses []string) (<-chan *Conflict, error) {
+	raw, err := c.GetTransactionContext(ctx, txid)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := parseTx(raw)
+	if err != nil {
+		return nil, err
+	}
+	spent := make(map[Outpoint]bool, len(tx.inputs))
+	for _, in := range tx.inputs {
+		spent[in] = true
+	}
+
+	// Watch all the addresses, merging their notifications
+	ctx, cancel := context.WithCancel(ctx)
+	changes := make(chan string)
+	for _, address := range addresses {
+		notifications, _, err := c.NotifyAddressTransactions(ctx, address)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		go func(address string) {
+			for range notifications {
+				select {
+				case changes <- address:
+				case <-ctx.Done():
+				}
+			}
+		}(address)
+	}
+
+	conflicts := make(chan *Conflict)
+	go func() {
+		defer close(conflicts)
+		defer cancel()
+		checked := map[string]bool{txid: true}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case address := <-changes:
+				for _, conflict := range c.findConflicts(ctx, txid, address, spent, checked) {
+					select {
+					case conflicts <- conflict:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return conflicts, nil
+}
+
+// Inspect the transactions on the history and mempool of an address not checked
+// before, looking for any spending one of the provided outputs
+func (c *Client) findConflicts(ctx context.Context, txid, address string, spent map[Outpoint]bool, checked map[string]bool) []*Conflict {
+	var candidates []Tx
+	for _, list := range []func(context.Context, string) (*[]Tx, error){c.AddressMempoolContext, c.AddressHistoryContext} {
+		txs, err := list(ctx, address)
+		if err != nil {
+			if c.log != nil {
+				c.log.Warn("conflict lookup failed", "address", address, "error", err)
+			}
+			continue
+		}
+		if txs != nil {
+			candidates = append(candidates, *txs...)
+		}
+	}
+
+	var conflicts []*Conflict
+	for _, candidate := range candidates {
+		if checked[candidate.Hash] {
+			continue
+		}
+		raw, err := c.GetTransactionContext(ctx, candidate.Hash)
+		if err != nil {
+			if c.log != nil {
+				c.log.Warn("conflict lookup failed", "txid", candidate.Hash, "error", err)
+			}
+			continue
+		}
+		checked[candidate.Hash] = true
+		tx, err := parseTx(raw)
+		if err != nil {
+			continue
+		}
+		for _, in := range tx.inputs {
+			if spent[in] {
+				conflicts = append(conflicts, &Conflict{TxID: txid, ConflictingTxID: candidate.Hash, Outpoint: in})
+			}
+		}
+	}
+	return conflicts
+}
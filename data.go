@@ -1,6 +1,17 @@
 package electrum
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Pools of reusable objects for the hot path
+var (
+	bufferPool   = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	responsePool = sync.Pool{New: func() interface{} { return new(response) }}
+)
 
 // VersionInfo contains the version information returned by the server
 type VersionInfo struct {
@@ -44,30 +55,109 @@ type Peer struct {
 	Features []string `json:"features"`
 }
 
-// Tx represents a transaction entry on the blockchain
+// PeerFeatures provides the parsed values of the feature flags announced by a peer
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-peers-subscribe
+type PeerFeatures struct {
+	// Max protocol version supported
+	Version string
+
+	// Port for TLS connections, 0 if not supported
+	SSLPort uint
+
+	// Port for plain TCP connections, 0 if not supported
+	TCPPort uint
+
+	// Pruning limit, 0 if the peer is not pruning history
+	Pruning uint64
+}
+
+// Tx represents a transaction entry on the blockchain; the height is 0 for mempool
+// transactions, or -1 when any of their inputs is unconfirmed
 type Tx struct {
 	Hash   string `json:"tx_hash"`
 	Pos    uint64 `json:"tx_pos"`
-	Height uint64 `json:"height"`
-	Value  uint64 `json:"value"`
+	Height int64  `json:"height"`
+	Value  Amount `json:"value"`
+}
+
+// TransactionInfo provides the decoded details of a transaction, as returned by the
+// server's daemon on verbose requests
+type TransactionInfo struct {
+	Hex           string     `json:"hex"`
+	TxID          string     `json:"txid"`
+	Hash          string     `json:"hash"`
+	Size          int        `json:"size"`
+	VSize         int        `json:"vsize"`
+	Weight        int        `json:"weight"`
+	Version       int        `json:"version"`
+	LockTime      uint32     `json:"locktime"`
+	Inputs        []TxInput  `json:"vin"`
+	Outputs       []TxOutput `json:"vout"`
+	BlockHash     string     `json:"blockhash"`
+	Confirmations int        `json:"confirmations"`
+	Time          int64      `json:"time"`
+	BlockTime     int64      `json:"blocktime"`
+}
+
+// TxInput describes an input of a decoded transaction
+type TxInput struct {
+	TxID      string    `json:"txid"`
+	Vout      uint32    `json:"vout"`
+	Coinbase  string    `json:"coinbase"`
+	ScriptSig *TxScript `json:"scriptSig"`
+	Witness   []string  `json:"txinwitness"`
+	Sequence  uint32    `json:"sequence"`
+}
+
+// TxOutput describes an output of a decoded transaction
+type TxOutput struct {
+	// Value of the output in BTC
+	Value        float64  `json:"value"`
+	N            uint32   `json:"n"`
+	ScriptPubKey TxScript `json:"scriptPubKey"`
+}
+
+// Amount returns the value of the output in satoshis
+func (o TxOutput) Amount() Amount {
+	return AmountFromBTC(o.Value)
+}
+
+// TxScript describes a transaction script
+type TxScript struct {
+	Asm       string   `json:"asm"`
+	Hex       string   `json:"hex"`
+	Type      string   `json:"type"`
+	ReqSigs   int      `json:"reqSigs"`
+	Address   string   `json:"address"`
+	Addresses []string `json:"addresses"`
 }
 
 // TxMerkle provides the merkle branch of a given transaction
 type TxMerkle struct {
-	BlockHeight string   `json:"block_height"`
+	BlockHeight uint64   `json:"block_height"`
 	Pos         uint64   `json:"pos"`
 	Merkle      []string `json:"merkle"`
 }
 
 // Balance show the funds available to an address, both
-// confirmed and unconfirmed
+// confirmed and unconfirmed; the unconfirmed value can be negative
+// when the mempool contains spends of confirmed funds
 type Balance struct {
-	Confirmed   uint64 `json:"confirmed"`
-	Unconfirmed uint64 `json:"unconfirmed"`
+	Confirmed   Amount `json:"confirmed"`
+	Unconfirmed Amount `json:"unconfirmed"`
 }
 
 // BlockHeader display summarized details about an existing block in the chain
 type BlockHeader struct {
+	// Height of the block; protocol 1.2 and newer report it as 'height' while older
+	// versions use 'block_height', headers from subscriptions carry both
+	Height uint64 `json:"height"`
+
+	// Serialized 80 bytes header, hex-encoded; provided by the server since protocol 1.2,
+	// rebuilt from the parsed fields for headers from subscriptions on older versions
+	RawHex string `json:"hex"`
+
 	BlockHeight   uint64 `json:"block_height"`
 	PrevBlockHash string `json:"prev_block_hash"`
 	Timestamp     uint64 `json:"timestamp"`
@@ -76,13 +166,54 @@ type BlockHeader struct {
 	UtxoRoot      string `json:"utxo_root"`
 	Version       int    `json:"version"`
 	Bits          uint64 `json:"bits"`
+
+	// Merkle branch and root connecting the header to a checkpoint, only
+	// present when requested with a checkpoint height
+	Branch []string `json:"branch,omitempty"`
+	Root   string   `json:"root,omitempty"`
+}
+
+// AddressStatus is delivered on address subscriptions, identifying the address
+// whose status changed; the status is empty for addresses without history
+type AddressStatus struct {
+	Address string `json:"address"`
+	Status  string `json:"status"`
+}
+
+// ScriptHashStatus is delivered on script hash subscriptions, identifying the
+// script hash whose status changed; the status is empty when it has no history
+type ScriptHashStatus struct {
+	ScriptHash string `json:"scripthash"`
+	Status     string `json:"status"`
 }
 
 // RPC error
 type rpcError struct {
-	Code    int64                  `json:"code"`
-	Message string                 `json:"message"`
-	Data    map[string]interface{} `json:"data"`
+	Code    int64       `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// CallInfo provides metadata about a completed request/response exchange
+type CallInfo struct {
+	// Protocol method invoked
+	Method string
+
+	// Address of the server that processed the request
+	Server string
+
+	// Protocol version in use for the exchange; the version negotiated with the
+	// server when known, the version preferred by the client otherwise
+	Protocol string
+
+	// Time elapsed between dispatching the request and receiving its response
+	Latency time.Duration
+
+	// Size in bytes of the response message, as received on the wire
+	Size int
+
+	// Error produced by the exchange, if any
+	Err error
 }
 
 // Protocol response structure
@@ -94,26 +225,58 @@ type response struct {
 	Params interface{} `json:"params"`
 	Result interface{} `json:"result"`
 	Error  *rpcError   `json:"error"`
+	raw    []byte
+	size   int
+	req    *request
+
+	// Time elapsed between dispatching the request and receiving the response
+	latency time.Duration
 }
 
 // Protocol request structure
 // http://docs.electrum.org/en/latest/protocol.html#request
 type request struct {
-	RPC    string   `json:"jsonrpc"`
-	ID     int      `json:"id"`
-	Method string   `json:"method"`
-	Params []string `json:"params"`
+	RPC    string        `json:"jsonrpc"`
+	ID     int           `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
 }
 
 // Properly encode a request object and append the message delimiter
 func (r *request) encode() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := r.encodeTo(buf, stdCodec{}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encode a request object into the provided buffer and append the message delimiter; the
+// default codec writes straight into the buffer, avoiding an intermediate allocation
+func (r *request) encodeTo(buf *bytes.Buffer, codec Codec) error {
 	if r.RPC == "" {
 		r.RPC = "2.0"
 	}
-	b, err := json.Marshal(r)
+	if _, ok := codec.(stdCodec); ok {
+		// The encoder terminates the message with a newline, the protocol delimiter
+		return json.NewEncoder(buf).Encode(r)
+	}
+	b, err := codec.Marshal(r)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	b = append(b, delimiter)
-	return b, nil
+	buf.Write(b)
+	return buf.WriteByte(delimiter)
+}
+
+// Get a clean response object from the pool
+func getResponse() *response {
+	r := responsePool.Get().(*response)
+	*r = response{}
+	return r
+}
+
+// Return a response object to the pool, must not be used afterwards
+func putResponse(r *response) {
+	responsePool.Put(r)
 }
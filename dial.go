@@ -0,0 +1,105 @@
+//go:build !js
+
+package electrum
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// Establish a network connection with the server, running any required handshake
+func dialServer(ctx context.Context, opts *transportOptions) (net.Conn, error) {
+	dial := opts.dial
+	if dial == nil {
+		dialer := &net.Dialer{KeepAlive: -1}
+		if opts.local != nil {
+			dialer.LocalAddr = opts.local
+		}
+		dial = dialer.DialContext
+	}
+	network, addr := "tcp", opts.address
+	if opts.network != "" {
+		network = opts.network
+	}
+	if opts.proxy != nil {
+		network, addr = "tcp", opts.proxy.Address
+	}
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Custom dialers may provide connections other than plain TCP sockets
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		if err := setSocketOptions(tcp, opts); err != nil {
+			/* #nosec */
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	// Abort any pending handshake when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		/* #nosec */
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	conn, err = handshake(conn, opts)
+	if !stop() {
+		if err == nil {
+			/* #nosec */
+			conn.Close()
+		}
+		return nil, ctx.Err()
+	}
+	return conn, err
+}
+
+// Apply the TCP keep-alive and delay settings to a connection
+func setSocketOptions(conn *net.TCPConn, opts *transportOptions) error {
+	period := opts.keepAlive
+	if period == 0 {
+		period = defaultTCPKeepAlive
+	}
+	if err := conn.SetKeepAlive(period > 0); err != nil {
+		return err
+	}
+	if period > 0 {
+		if err := conn.SetKeepAlivePeriod(period); err != nil {
+			return err
+		}
+	}
+	return conn.SetNoDelay(!opts.delay)
+}
+
+// Run the proxy, TLS and WebSocket handshakes required by the transport options,
+// if any; the connection is closed on failure
+func handshake(conn net.Conn, opts *transportOptions) (net.Conn, error) {
+	if opts.proxy != nil {
+		if err := socksHandshake(conn, opts.address, opts.proxy); err != nil {
+			/* #nosec */
+			conn.Close()
+			return nil, err
+		}
+	}
+	if opts.tls != nil {
+		tc := tls.Client(conn, opts.tls)
+		if err := tc.Handshake(); err != nil {
+			/* #nosec */
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	if opts.websocket {
+		ws, err := wsHandshake(conn, opts.address, opts.path)
+		if err != nil {
+			/* #nosec */
+			conn.Close()
+			return nil, err
+		}
+		return ws, nil
+	}
+	return conn, nil
+}
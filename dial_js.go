@@ -0,0 +1,214 @@
+//go:build js && wasm
+
+package electrum
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// Establish a network connection with the server; on browser environments only the
+// 'ws' and 'wss' schemes are supported, using the native WebSocket implementation
+func dialServer(ctx context.Context, opts *transportOptions) (net.Conn, error) {
+	if !opts.websocket || opts.proxy != nil || opts.dial != nil {
+		return nil, ErrUnsupportedScheme
+	}
+	scheme := "ws"
+	if opts.tls != nil {
+		scheme = "wss"
+	}
+	path := opts.path
+	if path == "" {
+		path = "/"
+	}
+
+	c := &jsConn{
+		ws:     js.Global().Get("WebSocket").New(scheme + "://" + opts.address + path),
+		notify: make(chan struct{}, 1),
+		addr:   jsAddr(opts.address),
+	}
+	c.ws.Set("binaryType", "arraybuffer")
+	opened := make(chan struct{})
+	c.listeners = []js.Func{
+		js.FuncOf(func(js.Value, []js.Value) interface{} {
+			close(opened)
+			return nil
+		}),
+		js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
+			c.receive(args[0].Get("data"))
+			return nil
+		}),
+		js.FuncOf(func(js.Value, []js.Value) interface{} {
+			c.setErr(io.EOF)
+			return nil
+		}),
+	}
+	for i, event := range []string{"open", "message", "close"} {
+		c.ws.Call("addEventListener", event, c.listeners[i])
+	}
+
+	select {
+	case <-opened:
+		return c, nil
+	case <-c.notify:
+		c.Close()
+		return nil, ErrUnreachableHost
+	case <-ctx.Done():
+		c.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// Network connection backed by a browser WebSocket; received messages are returned
+// as delimiter-terminated lines, so the connection can be used transparently by the
+// transport. Event callbacks run on the browser event loop and must never block,
+// messages are therefore kept on an unbounded buffer until read
+type jsConn struct {
+	ws        js.Value
+	listeners []js.Func
+	notify    chan struct{}
+	addr      net.Addr
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	err       error
+	deadline  time.Time
+}
+
+// Store a received message
+func (c *jsConn) receive(data js.Value) {
+	c.mu.Lock()
+	if data.Type() == js.TypeString {
+		c.buf.WriteString(data.String())
+	} else {
+		b := make([]byte, data.Get("byteLength").Int())
+		js.CopyBytesToGo(b, js.Global().Get("Uint8Array").New(data))
+		c.buf.Write(b)
+	}
+	if n := c.buf.Len(); n > 0 && c.buf.Bytes()[n-1] != delimiter {
+		c.buf.WriteByte(delimiter)
+	}
+	c.mu.Unlock()
+	c.wake()
+}
+
+// Record a terminal connection error
+func (c *jsConn) setErr(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	c.wake()
+}
+
+// Signal pending read operations
+func (c *jsConn) wake() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Read returns the contents of received messages
+func (c *jsConn) Read(p []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if c.buf.Len() > 0 {
+			n, err := c.buf.Read(p)
+			c.mu.Unlock()
+			return n, err
+		}
+		err, deadline := c.err, c.deadline
+		c.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+
+		if deadline.IsZero() {
+			<-c.notify
+			continue
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-c.notify:
+			t.Stop()
+		case <-t.C:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// Write sends the provided buffer as a single text message
+func (c *jsConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	c.ws.Call("send", string(p))
+	return len(p), nil
+}
+
+// Close terminates the WebSocket connection and releases the event callbacks
+func (c *jsConn) Close() error {
+	c.setErr(net.ErrClosed)
+	c.ws.Call("close")
+	for _, l := range c.listeners {
+		l.Release()
+	}
+	c.listeners = nil
+	return nil
+}
+
+// LocalAddr returns the server address, the local address is not available
+func (c *jsConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// RemoteAddr returns the server address
+func (c *jsConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// SetDeadline sets the read deadline; writes never block
+func (c *jsConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for pending and future read operations
+func (c *jsConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	c.wake()
+	return nil
+}
+
+// SetWriteDeadline has no effect, writes never block
+func (c *jsConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Address of a WebSocket server
+type jsAddr string
+
+// Network returns the address network name
+func (a jsAddr) Network() string {
+	return "websocket"
+}
+
+// String returns the address
+func (a jsAddr) String() string {
+	return string(a)
+}
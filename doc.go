@@ -7,9 +7,16 @@ are exported as asynchronous.
 
 Subscriptions take a context object that allows the client to cancel/close an instance at any
 given time; subscriptions also returned a channel for data transfer, the channel will be
-automatically closed by the client instance when the subscription is terminated.
+automatically closed by the client instance when the subscription is terminated. A Subscription
+handle is returned along with the channel to inspect the subscription, wait for its termination
+and its cause, or unsubscribe explicitly.
 
-The client supports TCP and TSL connections.
+Events for a given subscription are always delivered in the same order they were received
+from the server; every subscription is processed serially by a single goroutine, while
+different subscriptions are processed independently of each other.
+
+The client supports TCP, TSL and WebSocket connections; the connection type can be selected
+using an URL-style address, e.g. "ssl://node.xbt.eu:50002" or "ws://localhost:8080".
 
 Creating a Client
 
@@ -22,6 +29,13 @@ First start a new client instance
   })
 
 
+To control when network activity begins, create the instance with NewClient and use the
+Start, Stop and Restart methods; subscriptions are preserved across restarts, while a
+closed client can't be started again
+
+  client, _ := electrum.NewClient(&electrum.Options{Address: "node.xbt.eu:50002"})
+  err := client.Start(ctx)
+
 Synchronous Operations
 
 Execute operations as regular methods
@@ -35,7 +49,7 @@ Get notifications using regular channels and context
 
   ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
   defer cancel()
-  headers, _ := client.NotifyBlockHeaders(ctx)
+  headers, _, _ := client.NotifyBlockHeaders(ctx)
     for header := range headers {
     // Use header
   }
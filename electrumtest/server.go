@@ -0,0 +1,292 @@
+// Package electrumtest provides a scriptable Electrum server for testing purposes.
+//
+// The server listens on a local TCP port, so clients are exercised over a real socket;
+// responses are registered per method, and notifications and disconnections can be
+// triggered at any time:
+//
+//	srv := electrumtest.NewServer()
+//	defer srv.Close()
+//	srv.Handle("server.banner", "Welcome")
+//	client, _ := electrum.New(&electrum.Options{Address: srv.Addr()})
+//
+// Unless registered otherwise 'server.version' and 'server.ping' are answered with
+// sensible defaults, and unknown methods fail with an error.
+package electrumtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Default protocol version reported by the server
+const DefaultProtocol = "1.4"
+
+// Error codes used by the server
+const (
+	CodeBadRequest    = 1
+	CodeMethodUnknown = -32601
+)
+
+// Error is returned to the client when produced by a handler
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Error returns the message of the error
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// HandlerFunc produces the result for a request with the provided parameters; returning
+// an *Error lets handlers choose the error code sent to the client
+type HandlerFunc func(params []json.RawMessage) (interface{}, error)
+
+// Request received by the server
+type Request struct {
+	Method string
+	Params []json.RawMessage
+}
+
+// Protocol message, covering requests and responses
+type message struct {
+	RPC    string            `json:"jsonrpc"`
+	ID     *int              `json:"id,omitempty"`
+	Method string            `json:"method,omitempty"`
+	Params []json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage   `json:"result,omitempty"`
+	Error  *Error            `json:"error,omitempty"`
+}
+
+// Server is an in-process Electrum server; it's safe for concurrent use
+type Server struct {
+	ln       net.Listener
+	handlers map[string]HandlerFunc
+	conns    map[*conn]bool
+	requests []Request
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// NewServer starts a server listening on a random port of the loopback interface;
+// it panics if the listener can't be created
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("electrumtest: failed to listen: %s", err))
+	}
+	s := &Server{
+		ln:       ln,
+		handlers: make(map[string]HandlerFunc),
+		conns:    make(map[*conn]bool),
+	}
+	s.HandleFunc("server.version", func(params []json.RawMessage) (interface{}, error) {
+		return []string{"electrumtest", DefaultProtocol}, nil
+	})
+	s.Handle("server.ping", nil)
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr returns the 'host:port' address the server is listening on
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Handle registers a canned result for every request of the given method, replacing
+// any existing handler
+func (s *Server) Handle(method string, result interface{}) {
+	s.HandleFunc(method, func([]json.RawMessage) (interface{}, error) {
+		return result, nil
+	})
+}
+
+// HandleError registers an error response for every request of the given method,
+// replacing any existing handler
+func (s *Server) HandleError(method string, code int, msg string) {
+	s.HandleFunc(method, func([]json.RawMessage) (interface{}, error) {
+		return nil, &Error{Code: code, Message: msg}
+	})
+}
+
+// HandleFunc registers a function producing the responses of the given method,
+// replacing any existing handler
+func (s *Server) HandleFunc(method string, fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = fn
+}
+
+// Requests returns the requests received so far, in arrival order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Notify pushes a notification to every connected client; returns the number of
+// clients the notification was delivered to
+func (s *Server) Notify(method string, params ...interface{}) (int, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, c := range s.connections() {
+		if c.write(b) == nil {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// Disconnect closes the connections of every connected client, simulating a network
+// failure; the server keeps accepting new connections
+func (s *Server) Disconnect() {
+	for _, c := range s.connections() {
+		/* #nosec */
+		c.Close()
+	}
+}
+
+// Connections returns the number of currently connected clients
+func (s *Server) Connections() int {
+	return len(s.connections())
+}
+
+// Close stops the server, disconnecting every client
+func (s *Server) Close() {
+	/* #nosec */
+	s.ln.Close()
+	s.Disconnect()
+	s.wg.Wait()
+}
+
+// Active connections snapshot
+func (s *Server) connections() []*conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		list = append(list, c)
+	}
+	return list
+}
+
+// Accept connections until closed
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{Conn: nc}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+// Process the requests of a single client
+func (s *Server) handle(c *conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		/* #nosec */
+		c.Close()
+	}()
+
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		// Batches are answered with a single array of responses
+		var out []byte
+		if line[0] == '[' {
+			var batch []*message
+			if err := json.Unmarshal(line, &batch); err != nil {
+				return
+			}
+			responses := make([]*message, 0, len(batch))
+			for _, req := range batch {
+				responses = append(responses, s.respond(req))
+			}
+			out, err = json.Marshal(responses)
+		} else {
+			req := &message{}
+			if err := json.Unmarshal(line, req); err != nil {
+				return
+			}
+			out, err = json.Marshal(s.respond(req))
+		}
+		if err != nil || c.write(out) != nil {
+			return
+		}
+	}
+}
+
+// Produce the response for a request using the registered handler
+func (s *Server) respond(req *message) *message {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: req.Method, Params: req.Params})
+	fn := s.handlers[req.Method]
+	s.mu.Unlock()
+
+	res := &message{RPC: "2.0", ID: req.ID}
+	if fn == nil {
+		res.Error = &Error{Code: CodeMethodUnknown, Message: fmt.Sprintf("unknown method %q", req.Method)}
+		return res
+	}
+	result, err := fn(req.Params)
+	if err == nil {
+		// Successful responses always carry a result, even if null
+		if res.Result, err = json.Marshal(result); err == nil {
+			return res
+		}
+	}
+	switch e := err.(type) {
+	case *Error:
+		res.Error = e
+	default:
+		res.Error = &Error{Code: CodeBadRequest, Message: err.Error()}
+	}
+	return res
+}
+
+// Client connection, serializing writes from responses and notifications
+type conn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+func (c *conn) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,111 @@
+package electrumtest_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum"
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+func TestServer(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("server.banner", "Welcome")
+	srv.HandleError("server.donation_address", electrum.CodeDaemonError, "not available")
+	srv.HandleFunc("blockchain.scripthash.subscribe", func(params []json.RawMessage) (interface{}, error) {
+		return "status-1", nil
+	})
+
+	client, err := electrum.New(&electrum.Options{
+		Address:   srv.Addr(),
+		Reconnect: &electrum.ReconnectOptions{InitialDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Canned responses
+	if banner, err := client.ServerBanner(); err != nil || banner != "Welcome" {
+		t.Errorf("unexpected result: %q, %v", banner, err)
+	}
+	if _, err := client.ServerDonationAddress(); !errors.Is(err, electrum.ErrDaemonError) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.ServerFeatures(); !errors.Is(err, electrum.ErrMethodNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if reqs := srv.Requests(); len(reqs) != 3 || reqs[0].Method != "server.banner" {
+		t.Errorf("unexpected requests: %+v", reqs)
+	}
+
+	// Injected notifications
+	statuses, _, err := client.NotifyScriptHash(context.Background(), "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := <-statuses; s.Status != "status-1" {
+		t.Errorf("unexpected status: %s", s.Status)
+	}
+	if n, err := srv.Notify("blockchain.scripthash.subscribe", "scripthash", "status-2"); err != nil || n != 1 {
+		t.Fatalf("unexpected notification result: %d, %v", n, err)
+	}
+	if s := <-statuses; s.Status != "status-2" {
+		t.Errorf("unexpected status: %s", s.Status)
+	}
+
+	// Simulated disconnection, the client recovers the connection
+	reconnected := make(chan struct{}, 1)
+	client.OnStateChange(func(state electrum.ConnectionState) {
+		if state == electrum.Reconnected {
+			reconnected <- struct{}{}
+		}
+	})
+	srv.Disconnect()
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("client didn't reconnect")
+	}
+	if banner, err := client.ServerBanner(); err != nil || banner != "Welcome" {
+		t.Errorf("unexpected result after reconnection: %q, %v", banner, err)
+	}
+}
+
+func TestServerResponses(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	conn, err := net.Dial("tcp", srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Successful responses carry a result, even if null, and errors carry none
+	r := bufio.NewReader(conn)
+	for _, c := range []struct {
+		req string
+		res string
+	}{
+		{`{"jsonrpc":"2.0","id":1,"method":"server.ping","params":[]}`, `{"jsonrpc":"2.0","id":1,"result":null}`},
+		{`{"jsonrpc":"2.0","id":2,"method":"server.unknown","params":[]}`, `{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"unknown method \"server.unknown\""}}`},
+	} {
+		if _, err := conn.Write([]byte(c.req + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(line) != c.res {
+			t.Errorf("unexpected response: %s", line)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package electrum
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CallError wraps an error produced while running an operation, identifying the
+// method and parameters of the failed request; use errors.Is and errors.As to inspect
+// the underlying error, e.g. an *RPCError or *RawError, instead of type assertions
+type CallError struct {
+	// Name of the protocol method invoked
+	Method string
+
+	// Parameters submitted with the request, nil if redacted
+	Params []interface{}
+
+	// Underlying error
+	Err error
+}
+
+// Error returns the message of the underlying error, prefixed with the request details
+func (e *CallError) Error() string {
+	if e.Params == nil {
+		return fmt.Sprintf("%s [redacted]: %s", e.Method, e.Err)
+	}
+	return fmt.Sprintf("%s %v: %s", e.Method, e.Params, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+// Max length of the payload snippet included on decode errors
+const decodeSnippetSize = 120
+
+// DecodeError is returned when the result of an operation can't be decoded into
+// the expected type; errors.Is will match it with ErrInvalidResult
+type DecodeError struct {
+	// Name of the expected type
+	Expected string
+
+	// Leading portion of the offending payload
+	Payload string
+
+	// Underlying decoding error
+	Err error
+}
+
+// Build a decode error for a value of the given type
+func newDecodeError(v interface{}, payload []byte, err error) *DecodeError {
+	snippet := string(payload)
+	if len(snippet) > decodeSnippetSize {
+		snippet = snippet[:decodeSnippetSize] + "..."
+	}
+	return &DecodeError{
+		Expected: strings.TrimLeft(fmt.Sprintf("%T", v), "*"),
+		Payload:  snippet,
+		Err:      err,
+	}
+}
+
+// Error returns a description of the expected type and the payload received
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("invalid result, expected %s: %s (payload: %s)", e.Expected, e.Err, e.Payload)
+}
+
+// Unwrap returns the underlying decoding error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports decode errors as ErrInvalidResult
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrInvalidResult
+}
+
+// Error codes reported by ElectrumX servers, including the ones defined by the
+// JSON-RPC specification
+const (
+	CodeBadRequest             = 1
+	CodeDaemonError            = 2
+	CodeExcessiveResourceUsage = -101
+	CodeServerBusy             = -102
+	CodeMethodNotFound         = -32601
+	CodeInvalidParams          = -32602
+)
+
+// Error classes reported by servers; matched by *RPCError values using errors.Is
+var (
+	ErrBadRequest        = errors.New("BAD_REQUEST")
+	ErrDaemonError       = errors.New("DAEMON_ERROR")
+	ErrExcessiveUsage    = errors.New("EXCESSIVE_RESOURCE_USAGE")
+	ErrServerBusy        = errors.New("SERVER_BUSY")
+	ErrMethodNotFound    = errors.New("METHOD_NOT_FOUND")
+	ErrInvalidParameters = errors.New("INVALID_PARAMETERS")
+)
+
+// Error classes by code
+var rpcErrorClasses = map[int64]error{
+	CodeBadRequest:             ErrBadRequest,
+	CodeDaemonError:            ErrDaemonError,
+	CodeExcessiveResourceUsage: ErrExcessiveUsage,
+	CodeServerBusy:             ErrServerBusy,
+	CodeMethodNotFound:         ErrMethodNotFound,
+	CodeInvalidParams:          ErrInvalidParameters,
+}
+
+// RPCError is the error object returned by the server for a failed operation;
+// errors.Is will match it with the error class of its code, e.g. ErrDaemonError
+type RPCError struct {
+	// Numeric error code
+	Code int64
+
+	// Description of the error provided by the server
+	Message string
+
+	// Additional details, if any
+	Data interface{}
+}
+
+// Error returns the message provided by the server
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// Is reports whether the error belongs to the target error class
+func (e *RPCError) Is(target error) bool {
+	class, ok := rpcErrorClasses[e.Code]
+	return ok && class == target
+}
+
+// RejectedTxError is returned when a broadcast transaction is rejected by the server's
+// daemon; errors.Is will match it with ErrRejectedTx
+type RejectedTxError struct {
+	// Rejection reason provided by the daemon, if any
+	Reason string
+
+	// Error returned by the server, if any
+	Err error
+}
+
+// Error returns the rejection reason
+func (e *RejectedTxError) Error() string {
+	if e.Reason == "" {
+		return "transaction rejected"
+	}
+	return fmt.Sprintf("transaction rejected: %s", e.Reason)
+}
+
+// Unwrap returns the error returned by the server
+func (e *RejectedTxError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrRejectedTx
+func (e *RejectedTxError) Is(target error) bool {
+	return target == ErrRejectedTx
+}
+
+// RawError wraps an error produced by a server response, providing access to the raw
+// payload received; only produced when the client is running in debug mode, and wrapped
+// in a *CallError when returned by an operation
+type RawError struct {
+	err error
+	raw []byte
+}
+
+// Error returns the message of the underlying error
+func (e *RawError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *RawError) Unwrap() error {
+	return e.err
+}
+
+// Raw returns the response payload as received from the server
+func (e *RawError) Raw() []byte {
+	return e.raw
+}
+
+// Build the error value for a server response reporting a failure
+func (c *Client) resError(res *response) error {
+	var err error = &RPCError{
+		Code:    res.Error.Code,
+		Message: res.Error.Message,
+		Data:    res.Error.Data,
+	}
+	if c.debug && res.raw != nil {
+		err = &RawError{err: err, raw: res.raw}
+	}
+	if res.req != nil {
+		return c.callError(res.req, err)
+	}
+	return err
+}
+
+// Wrap an error with the details of the request that produced it
+func (c *Client) callError(req *request, err error) error {
+	ce := &CallError{Method: req.Method, Params: req.Params, Err: err}
+	if c.redactParams {
+		ce.Params = nil
+	}
+	return ce
+}
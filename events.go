@@ -0,0 +1,65 @@
+package electrum
+
+import (
+	"sync"
+	"time"
+)
+
+// Default number of connection events kept by the client
+const defaultEventHistory = 64
+
+// ConnectionEvent records a relevant occurrence on the client's connection
+type ConnectionEvent struct {
+	// Time of the event
+	Time time.Time
+
+	// New connection state, empty for error events
+	State ConnectionState
+
+	// Error reported, nil for state change events
+	Err error
+}
+
+// Bounded, in-memory log of connection events; once full, the oldest
+// events are discarded
+type eventLog struct {
+	events []ConnectionEvent
+	next   int
+	full   bool
+	mu     sync.Mutex
+}
+
+func newEventLog(size int) *eventLog {
+	if size <= 0 {
+		size = defaultEventHistory
+	}
+	return &eventLog{events: make([]ConnectionEvent, size)}
+}
+
+// Add a new event to the log
+func (l *eventLog) add(state ConnectionState, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events[l.next] = ConnectionEvent{Time: time.Now(), State: state, Err: err}
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Get the events on the log, oldest first
+func (l *eventLog) list() []ConnectionEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]ConnectionEvent(nil), l.events[:l.next]...)
+	}
+	return append(append([]ConnectionEvent(nil), l.events[l.next:]...), l.events[:l.next]...)
+}
+
+// Events returns the most recent connection events, oldest first: state changes,
+// reconnection failures and network errors, useful for post-mortem debugging
+// of connectivity issues
+func (c *Client) Events() []ConnectionEvent {
+	return c.events.list()
+}
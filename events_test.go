@@ -0,0 +1,33 @@
+package electrum
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventLog(t *testing.T) {
+	l := newEventLog(3)
+	if len(l.list()) != 0 {
+		t.Fatal("expected empty log")
+	}
+	l.add(Ready, nil)
+	l.add(Disconnected, nil)
+	if got := l.list(); len(got) != 2 || got[0].State != Ready || got[1].State != Disconnected {
+		t.Fatalf("unexpected events: %+v", got)
+	}
+
+	// Oldest events are discarded once the log is full
+	errTest := errors.New("test")
+	l.add(Reconnecting, nil)
+	l.add("", errTest)
+	got := l.list()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(got))
+	}
+	if got[0].State != Disconnected || got[1].State != Reconnecting || got[2].Err != errTest {
+		t.Fatalf("unexpected events: %+v", got)
+	}
+	if got[2].Time.Before(got[0].Time) {
+		t.Error("events out of order")
+	}
+}
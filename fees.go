@@ -0,0 +1,147 @@
+package electrum
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FeeHistogramEntry describes the mempool transactions paying a given fee rate
+type FeeHistogramEntry struct {
+	// Fee rate in satoshis per virtual byte
+	FeeRate float64
+
+	// Aggregated virtual size, in bytes, of the transactions paying at least the fee
+	// rate and less than the fee rate of the previous entry
+	VSize uint64
+}
+
+// Cache of fee related results, shared by all callers on a client; concurrent requests
+// for a missing entry are collapsed into a single server operation
+type feeCache struct {
+	ttl     time.Duration
+	entries map[string]*feeEntry
+	mu      sync.Mutex
+}
+
+type feeEntry struct {
+	value   interface{}
+	err     error
+	expires time.Time
+	ready   chan struct{}
+}
+
+func newFeeCache(ttl time.Duration) *feeCache {
+	return &feeCache{ttl: ttl, entries: make(map[string]*feeEntry)}
+}
+
+// Get a cached value, using the fetch function to load it if missing or stale;
+// errors are not cached
+func (fc *feeCache) get(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	if fc == nil {
+		return fetch()
+	}
+
+	fc.mu.Lock()
+	e, ok := fc.entries[key]
+	if ok {
+		select {
+		case <-e.ready:
+			ok = e.err == nil && time.Now().Before(e.expires)
+		default:
+			// Fetch in progress
+			fc.mu.Unlock()
+			<-e.ready
+			return e.value, e.err
+		}
+	}
+	if ok {
+		fc.mu.Unlock()
+		return e.value, nil
+	}
+	e = &feeEntry{ready: make(chan struct{})}
+	fc.entries[key] = e
+	fc.mu.Unlock()
+
+	e.value, e.err = fetch()
+	e.expires = time.Now().Add(fc.ttl)
+	close(e.ready)
+	return e.value, e.err
+}
+
+// Discard all cached values
+func (fc *feeCache) flush() {
+	if fc == nil {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.entries = make(map[string]*feeEntry)
+}
+
+// RefreshFees discards any cached fee results, forcing the next fee related
+// operations to query the server
+func (c *Client) RefreshFees() {
+	c.fees.flush()
+}
+
+// EstimateFee will synchronously run a 'blockchain.estimatefee' operation; when the
+// 'FeeCacheTTL' option is set, results are cached for the configured period
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-estimatefee
+func (c *Client) EstimateFee(blocks int) (float64, error) {
+	return c.EstimateFeeContext(context.Background(), blocks)
+}
+
+// EstimateFeeContext is like EstimateFee but uses the provided context to cancel the operation
+func (c *Client) EstimateFeeContext(ctx context.Context, blocks int) (float64, error) {
+	fee, err := c.fees.get(fmt.Sprintf("estimatefee:%d", blocks), func() (interface{}, error) {
+		return c.estimateFee(ctx, blocks)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return fee.(float64), nil
+}
+
+// FeeHistogram will synchronously run a 'mempool.get_fee_histogram' operation; when the
+// 'FeeCacheTTL' option is set, results are cached for the configured period
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#mempool-get-fee-histogram
+func (c *Client) FeeHistogram() ([]FeeHistogramEntry, error) {
+	return c.FeeHistogramContext(context.Background())
+}
+
+// FeeHistogramContext is like FeeHistogram but uses the provided context to cancel the operation
+func (c *Client) FeeHistogramContext(ctx context.Context) ([]FeeHistogramEntry, error) {
+	h, err := c.fees.get("histogram", func() (interface{}, error) {
+		return c.feeHistogram(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h.([]FeeHistogramEntry), nil
+}
+
+// Run a 'mempool.get_fee_histogram' operation
+func (c *Client) feeHistogram(ctx context.Context) ([]FeeHistogramEntry, error) {
+	res, err := c.syncRequest(ctx, c.req("mempool.get_fee_histogram"))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Error != nil {
+		return nil, c.resError(res)
+	}
+
+	var pairs [][2]float64
+	if err := c.decode(res, &pairs); err != nil {
+		return nil, err
+	}
+	histogram := make([]FeeHistogramEntry, len(pairs))
+	for i, p := range pairs {
+		histogram[i] = FeeHistogramEntry{FeeRate: p[0], VSize: uint64(p[1])}
+	}
+	return histogram, nil
+}
@@ -0,0 +1,66 @@
+package electrum
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFeeCache(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"blockchain.estimatefee":    `0.0002`,
+		"mempool.get_fee_histogram": `[[12.5, 1000], [5, 20000]]`,
+	})
+	requests := func() int {
+		n := 0
+		for _, req := range srv.Requests() {
+			if req.Method != "server.version" {
+				n++
+			}
+		}
+		return n
+	}
+	client, err := New(&Options{Address: srv.Addr(), FeeCacheTTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Concurrent calls are served by a single request
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if fee, err := client.EstimateFee(6); err != nil || fee != 0.0002 {
+				t.Errorf("unexpected result: %v, %v", fee, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := requests(); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+
+	h, err := client.FeeHistogram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 2 || h[0].FeeRate != 12.5 || h[1].VSize != 20000 {
+		t.Errorf("unexpected histogram: %+v", h)
+	}
+	if _, err := client.EstimateFee(2); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+
+	client.RefreshFees()
+	if _, err := client.EstimateFee(6); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests(); n != 4 {
+		t.Errorf("expected 4 requests, got %d", n)
+	}
+}
@@ -0,0 +1,37 @@
+package electrum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Double SHA-256 digest, as used for block and transaction hashes
+func doubleSHA256(b []byte) []byte {
+	h := sha256.Sum256(b)
+	h = sha256.Sum256(h[:])
+	return h[:]
+}
+
+// Reverse a byte slice in place
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+// Hex encode a hash in its conventional, byte-reversed, display order
+func reverseHex(b []byte) string {
+	r := append([]byte(nil), b...)
+	reverse(r)
+	return hex.EncodeToString(r)
+}
+
+// Decode a 32 bytes hash provided in display order into its internal byte order
+func decodeHash(s string) ([]byte, bool) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return nil, false
+	}
+	reverse(b)
+	return b, true
+}
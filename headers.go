@@ -0,0 +1,468 @@
+package electrum
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Size in bytes of a serialized block header
+const headerSize = 80
+
+// Default number of headers requested on each 'blockchain.block.headers' operation,
+// servers may return less
+const headersChunkSize = 2016
+
+// HeadersChunk contains a range of consecutive block headers
+type HeadersChunk struct {
+	// Number of headers included
+	Count int `json:"count"`
+
+	// Concatenated hex-encoded headers, 80 bytes each
+	Hex string `json:"hex"`
+
+	// Max number of headers the server returns on a single request
+	Max int `json:"max"`
+
+	// Merkle branch and root connecting the last header on the chunk to a checkpoint,
+	// only present when requested with a checkpoint height
+	Branch []string `json:"branch,omitempty"`
+	Root   string   `json:"root,omitempty"`
+}
+
+// Headers decodes the headers on the chunk, the first one at the provided height
+func (hc *HeadersChunk) Headers(start int) ([]*BlockHeader, error) {
+	raw, err := hex.DecodeString(hc.Hex)
+	if err != nil || len(raw) != hc.Count*headerSize {
+		return nil, ErrInvalidResult
+	}
+	headers := make([]*BlockHeader, hc.Count)
+	for i := range headers {
+		if headers[i], err = parseHeader(raw[i*headerSize:(i+1)*headerSize], uint64(start+i)); err != nil {
+			return nil, err
+		}
+	}
+	return headers, nil
+}
+
+// BlockHeaders will synchronously run a 'blockchain.block.headers' operation, returning up to
+// count consecutive headers starting at the provided height; available on protocol 1.2 and newer
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-block-headers
+func (c *Client) BlockHeaders(start, count int) (*HeadersChunk, error) {
+	return c.BlockHeadersContext(context.Background(), start, count)
+}
+
+// BlockHeadersContext is like BlockHeaders but uses the provided context to cancel the operation
+func (c *Client) BlockHeadersContext(ctx context.Context, start, count int) (*HeadersChunk, error) {
+	return c.blockHeaders(ctx, start, count, 0)
+}
+
+// BlockHeadersProof will synchronously run a 'blockchain.block.headers' operation with a
+// checkpoint height; the chunk includes the merkle branch and root connecting its last header
+// to the checkpoint. Available on protocol 1.4 and newer
+func (c *Client) BlockHeadersProof(start, count, cpHeight int) (*HeadersChunk, error) {
+	return c.BlockHeadersProofContext(context.Background(), start, count, cpHeight)
+}
+
+// BlockHeadersProofContext is like BlockHeadersProof but uses the provided context to cancel
+// the operation
+func (c *Client) BlockHeadersProofContext(ctx context.Context, start, count, cpHeight int) (*HeadersChunk, error) {
+	if err := c.supportsCheckpoints(); err != nil {
+		return nil, err
+	}
+	return c.blockHeaders(ctx, start, count, cpHeight)
+}
+
+// Run a 'blockchain.block.headers' operation, including the checkpoint height if provided
+func (c *Client) blockHeaders(ctx context.Context, start, count, cpHeight int) (*HeadersChunk, error) {
+	params := []interface{}{start, count}
+	if cpHeight > 0 {
+		params = append(params, cpHeight)
+	}
+	res, err := c.syncRequest(ctx, c.req("blockchain.block.headers", params...))
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, c.resError(res)
+	}
+	chunk := new(HeadersChunk)
+	if err := c.decode(res, chunk); err != nil {
+		return nil, err
+	}
+	if len(chunk.Hex) != chunk.Count*headerSize*2 {
+		return nil, c.callError(res.req, ErrInvalidResult)
+	}
+	if c.verify && chunk.Root != "" && chunk.Count > 0 {
+		last := chunk.Hex[(chunk.Count-1)*headerSize*2:]
+		if !verifyHeaderBranch(last, start+chunk.Count-1, chunk.Branch, chunk.Root) {
+			return nil, c.callError(res.req, ErrServerMismatch)
+		}
+	}
+	return chunk, nil
+}
+
+// BlockHeaderProof will synchronously run a 'blockchain.block.header' operation with a
+// checkpoint height; the header includes the merkle branch and root connecting it to the
+// checkpoint. Available on protocol 1.4 and newer; a checkpoint height of 0 requests the
+// header without a proof, available on protocol 1.3 and newer
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-block-header
+func (c *Client) BlockHeaderProof(height, cpHeight int) (*BlockHeader, error) {
+	return c.BlockHeaderProofContext(context.Background(), height, cpHeight)
+}
+
+// BlockHeaderProofContext is like BlockHeaderProof but uses the provided context to cancel
+// the operation
+func (c *Client) BlockHeaderProofContext(ctx context.Context, height, cpHeight int) (*BlockHeader, error) {
+	if cpHeight > 0 {
+		if err := c.supportsCheckpoints(); err != nil {
+			return nil, err
+		}
+	}
+	return c.blockHeader(ctx, height, cpHeight)
+}
+
+// Run a 'blockchain.block.header' operation, including the checkpoint height if provided;
+// the result is the raw header without a checkpoint, or the header along with its proof
+func (c *Client) blockHeader(ctx context.Context, height, cpHeight int) (*BlockHeader, error) {
+	params := []interface{}{height}
+	if cpHeight > 0 {
+		params = append(params, cpHeight)
+	}
+	res, err := c.syncRequest(ctx, c.req("blockchain.block.header", params...))
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, c.resError(res)
+	}
+	var proof struct {
+		Branch []string `json:"branch"`
+		Header string   `json:"header"`
+		Root   string   `json:"root"`
+	}
+	if cpHeight > 0 {
+		err = c.decode(res, &proof)
+	} else {
+		err = c.decode(res, &proof.Header)
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(proof.Header)
+	if err != nil {
+		return nil, c.callError(res.req, ErrInvalidResult)
+	}
+	header, err := parseHeader(raw, uint64(height))
+	if err != nil {
+		return nil, c.callError(res.req, err)
+	}
+	if c.verify && cpHeight > 0 && !verifyHeaderBranch(proof.Header, height, proof.Branch, proof.Root) {
+		return nil, c.callError(res.req, ErrServerMismatch)
+	}
+	if c.verify && !c.chain.link(header) {
+		return nil, c.callError(res.req, ErrServerMismatch)
+	}
+	header.Branch, header.Root = proof.Branch, proof.Root
+	return header, nil
+}
+
+// Check a merkle branch connects a hex-encoded header at the given height to the
+// checkpoint root; branch and root hashes are provided in display, byte-reversed, order
+func verifyHeaderBranch(header string, height int, branch []string, root string) bool {
+	raw, err := hex.DecodeString(header)
+	if err != nil || len(raw) < headerSize {
+		return false
+	}
+	h := doubleSHA256(raw[:headerSize])
+	for _, b := range branch {
+		node, ok := decodeHash(b)
+		if !ok {
+			return false
+		}
+		if height&1 == 1 {
+			h = doubleSHA256(append(node, h...))
+		} else {
+			h = doubleSHA256(append(h, node...))
+		}
+		height >>= 1
+	}
+	return reverseHex(h) == strings.ToLower(root)
+}
+
+// Decode a serialized block header at the given height
+func parseHeader(raw []byte, height uint64) (*BlockHeader, error) {
+	if len(raw) != headerSize {
+		return nil, ErrInvalidResult
+	}
+	return &BlockHeader{
+		Height:        height,
+		RawHex:        hex.EncodeToString(raw),
+		BlockHeight:   height,
+		Version:       int(int32(binary.LittleEndian.Uint32(raw[0:4]))),
+		PrevBlockHash: reverseHex(raw[4:36]),
+		MerkleRoot:    reverseHex(raw[36:68]),
+		Timestamp:     uint64(binary.LittleEndian.Uint32(raw[68:72])),
+		Bits:          uint64(binary.LittleEndian.Uint32(raw[72:76])),
+		Nonce:         uint64(binary.LittleEndian.Uint32(raw[76:80])),
+	}, nil
+}
+
+// Serialize the parsed fields of a block header
+func serializeHeader(h *BlockHeader) ([]byte, error) {
+	prev, ok := decodeHash(h.PrevBlockHash)
+	if !ok {
+		return nil, ErrInvalidResult
+	}
+	merkle, ok := decodeHash(h.MerkleRoot)
+	if !ok {
+		return nil, ErrInvalidResult
+	}
+	raw := make([]byte, 0, headerSize)
+	raw = binary.LittleEndian.AppendUint32(raw, uint32(int32(h.Version)))
+	raw = append(raw, prev...)
+	raw = append(raw, merkle...)
+	raw = binary.LittleEndian.AppendUint32(raw, uint32(h.Timestamp))
+	raw = binary.LittleEndian.AppendUint32(raw, uint32(h.Bits))
+	raw = binary.LittleEndian.AppendUint32(raw, uint32(h.Nonce))
+	return raw, nil
+}
+
+// Complete a header received on 'blockchain.headers.subscribe'; depending on the protocol
+// version the server provides the parsed fields, the raw header or both, along with the
+// height under different names. Fields that can't be derived are left as received
+func completeHeader(h *BlockHeader) {
+	if h.Height == 0 {
+		h.Height = h.BlockHeight
+	}
+	h.BlockHeight = h.Height
+	if h.RawHex == "" {
+		if raw, err := serializeHeader(h); err == nil {
+			h.RawHex = hex.EncodeToString(raw)
+		}
+		return
+	}
+	if h.MerkleRoot == "" {
+		raw, err := hex.DecodeString(h.RawHex)
+		if err != nil {
+			return
+		}
+		if parsed, err := parseHeader(raw, h.Height); err == nil {
+			parsed.RawHex = h.RawHex
+			*h = *parsed
+		}
+	}
+}
+
+// HeaderIterator provides sequential access to a range of block headers; headers
+// are fetched lazily in chunks, keeping memory usage constant regardless of the
+// size of the range
+type HeaderIterator struct {
+	client *Client
+	ctx    context.Context
+	next   int
+	end    int
+	chunk  []byte
+	height int
+}
+
+// Headers returns an iterator over the block headers in the [start, end) height range;
+// requires protocol 1.2 or newer
+func (c *Client) Headers(start, end int) *HeaderIterator {
+	return c.HeadersContext(context.Background(), start, end)
+}
+
+// HeadersContext is like Headers but uses the provided context to cancel the chunk
+// requests sent by the iterator
+func (c *Client) HeadersContext(ctx context.Context, start, end int) *HeaderIterator {
+	return &HeaderIterator{client: c, ctx: ctx, next: start, end: end, height: start}
+}
+
+// Next returns the next header in the range, fetching a new chunk from the server when
+// required; io.EOF is returned once the range is exhausted or the chain tip is reached
+func (it *HeaderIterator) Next() (*BlockHeader, error) {
+	if len(it.chunk) == 0 {
+		if it.next >= it.end {
+			return nil, io.EOF
+		}
+		count := it.end - it.next
+		if count > headersChunkSize {
+			count = headersChunkSize
+		}
+		res, err := it.client.BlockHeadersContext(it.ctx, it.next, count)
+		if err != nil {
+			return nil, err
+		}
+		if res.Count == 0 {
+			it.end = it.next
+			return nil, io.EOF
+		}
+		if it.chunk, err = hex.DecodeString(res.Hex); err != nil {
+			return nil, ErrInvalidResult
+		}
+		it.next += res.Count
+	}
+
+	header, err := parseHeader(it.chunk[:headerSize], uint64(it.height))
+	if err != nil {
+		return nil, err
+	}
+	it.chunk = it.chunk[headerSize:]
+	it.height++
+	return header, nil
+}
+
+// SyncProgress describes the state of an ongoing header synchronization
+type SyncProgress struct {
+	// Height of the last processed header
+	Height int
+
+	// Height of the chain tip when the synchronization started
+	Target int
+
+	// Average number of headers processed per second
+	Rate float64
+
+	// Estimated time remaining to reach the target height
+	ETA time.Duration
+}
+
+// SyncHeaders will process, in order, every block header from the start height up to
+// the current chain tip. If provided, the progress callback is invoked each time a
+// chunk of headers has been processed; the operation stops on the first error returned
+// by the handler or when the context is done. Requires protocol 1.2 or newer
+func (c *Client) SyncHeaders(ctx context.Context, start int, handler func(*BlockHeader) error, progress func(*SyncProgress)) error {
+	target, err := c.tipHeight(ctx)
+	if err != nil {
+		return err
+	}
+
+	began := time.Now()
+	it := c.HeadersContext(ctx, start, target+1)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := handler(header); err != nil {
+			return err
+		}
+
+		// Report progress at the end of every chunk
+		if progress != nil && len(it.chunk) == 0 {
+			p := &SyncProgress{Height: int(header.BlockHeight), Target: target}
+			if elapsed := time.Since(began).Seconds(); elapsed > 0 {
+				p.Rate = float64(it.height-start) / elapsed
+			}
+			if p.Rate > 0 {
+				p.ETA = time.Duration(float64(target-p.Height) / p.Rate * float64(time.Second))
+			}
+			progress(p)
+		}
+	}
+}
+
+// Hashes of the headers known to the client, used to check that headers received on
+// later requests link into the same chain; only the most recent heights are kept
+type headerChain struct {
+	size    int
+	tip     uint64
+	entries map[uint64]*chainEntry
+	mu      sync.Mutex
+}
+
+type chainEntry struct {
+	hash string
+	prev string
+}
+
+func newHeaderChain(size int) *headerChain {
+	return &headerChain{size: size, entries: make(map[uint64]*chainEntry)}
+}
+
+// Check a header matches the known header at its height and links to the ones at the
+// adjacent heights, storing it if it does; headers whose hash can't be computed don't link
+func (hc *headerChain) link(h *BlockHeader) bool {
+	if hc == nil {
+		return true
+	}
+	e := newChainEntry(h)
+	if e == nil {
+		return false
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if known, ok := hc.entries[h.BlockHeight]; ok && known.hash != e.hash {
+		return false
+	}
+	if below, ok := hc.entries[h.BlockHeight-1]; ok && h.BlockHeight > 0 && below.hash != e.prev {
+		return false
+	}
+	if above, ok := hc.entries[h.BlockHeight+1]; ok && above.prev != e.hash {
+		return false
+	}
+	hc.store(h.BlockHeight, e)
+	return true
+}
+
+// Store a new chain tip reported by the server; known headers above it or not linking
+// to it are discarded, e.g. after a reorganization
+func (hc *headerChain) extend(h *BlockHeader) {
+	if hc == nil {
+		return
+	}
+	e := newChainEntry(h)
+	if e == nil {
+		return
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if below, ok := hc.entries[h.BlockHeight-1]; ok && h.BlockHeight > 0 && below.hash != e.prev {
+		hc.entries = make(map[uint64]*chainEntry)
+	}
+	for height := range hc.entries {
+		if height > h.BlockHeight {
+			delete(hc.entries, height)
+		}
+	}
+	hc.tip = h.BlockHeight
+	hc.store(h.BlockHeight, e)
+}
+
+// Store the entry for a height, discarding the ones too far below the highest known
+// height; must be called with the lock held
+func (hc *headerChain) store(height uint64, e *chainEntry) {
+	hc.entries[height] = e
+	if height > hc.tip {
+		hc.tip = height
+	}
+	if len(hc.entries) <= hc.size {
+		return
+	}
+	for h := range hc.entries {
+		if hc.tip-h >= uint64(hc.size) {
+			delete(hc.entries, h)
+		}
+	}
+}
+
+// Hash and previous block hash of a header, nil if the raw header is not available
+func newChainEntry(h *BlockHeader) *chainEntry {
+	raw, err := hex.DecodeString(h.RawHex)
+	if err != nil || len(raw) != headerSize {
+		return nil
+	}
+	return &chainEntry{hash: reverseHex(doubleSHA256(raw)), prev: reverseHex(raw[4:36])}
+}
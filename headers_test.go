@@ -0,0 +1,352 @@
+package electrum
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+const genesisHeader = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c"
+
+func TestParseHeader(t *testing.T) {
+	raw := make([]byte, headerSize)
+	if _, err := fmt.Sscanf(genesisHeader, "%x", &raw); err != nil {
+		t.Fatal(err)
+	}
+	h, err := parseHeader(raw, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != 1 || h.Timestamp != 1231006505 || h.Bits != 0x1d00ffff || h.Nonce != 2083236893 {
+		t.Errorf("unexpected header: %+v", h)
+	}
+	if h.MerkleRoot != "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b" {
+		t.Errorf("unexpected merkle root: %s", h.MerkleRoot)
+	}
+	if _, err := parseHeader(raw[1:], 0); err != ErrInvalidResult {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCompleteHeader(t *testing.T) {
+	// Protocol 1.4 notifications only include the height and raw header
+	modern := &BlockHeader{Height: 0, RawHex: genesisHeader}
+	completeHeader(modern)
+	if modern.Nonce != 2083236893 || modern.RawHex != genesisHeader {
+		t.Errorf("unexpected header: %+v", modern)
+	}
+
+	// Older protocols provide the parsed fields, used to rebuild the raw header
+	legacy := &BlockHeader{
+		BlockHeight:   10,
+		Version:       modern.Version,
+		PrevBlockHash: modern.PrevBlockHash,
+		MerkleRoot:    modern.MerkleRoot,
+		Timestamp:     modern.Timestamp,
+		Bits:          modern.Bits,
+		Nonce:         modern.Nonce,
+	}
+	completeHeader(legacy)
+	if legacy.Height != 10 || legacy.RawHex != genesisHeader {
+		t.Errorf("unexpected header: %+v", legacy)
+	}
+
+	// Incomplete headers are kept as received
+	partial := &BlockHeader{Height: 20}
+	completeHeader(partial)
+	if partial.BlockHeight != 20 || partial.RawHex != "" {
+		t.Errorf("unexpected header: %+v", partial)
+	}
+}
+
+func TestHeaderIterator(t *testing.T) {
+	const tip = 5000
+	srv := mockHeaders(t, tip)
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	it := client.Headers(10, tip+100)
+	n := 0
+	for {
+		h, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.BlockHeight != uint64(10+n) {
+			t.Fatalf("unexpected height %d", h.BlockHeight)
+		}
+		n++
+	}
+	if n != tip-10 {
+		t.Errorf("expected %d headers, got %d", tip-10, n)
+	}
+	requests := 0
+	for _, req := range srv.Requests() {
+		if req.Method == "blockchain.block.headers" {
+			requests++
+		}
+	}
+	if requests != 4 {
+		t.Errorf("expected 4 requests, got %d", requests)
+	}
+	if _, err := it.Next(); err != io.EOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSyncHeaders(t *testing.T) {
+	const tip = 5000
+	client, err := New(&Options{Address: mockHeaders(t, tip).Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reports []*SyncProgress
+	n := 0
+	err = client.SyncHeaders(context.Background(), 100, func(h *BlockHeader) error {
+		n++
+		return nil
+	}, func(p *SyncProgress) {
+		reports = append(reports, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != tip-100 {
+		t.Errorf("expected %d headers, got %d", tip-100, n)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("expected 3 progress reports, got %d", len(reports))
+	}
+	if p := reports[0]; p.Height != 100+headersChunkSize-1 || p.Target != tip-1 || p.Rate <= 0 || p.ETA <= 0 {
+		t.Errorf("unexpected progress: %+v", p)
+	}
+	if p := reports[2]; p.Height != tip-1 || p.ETA != 0 {
+		t.Errorf("unexpected progress: %+v", p)
+	}
+
+	// Handler errors stop the synchronization
+	errStop := errors.New("stop")
+	err = client.SyncHeaders(context.Background(), 0, func(h *BlockHeader) error { return errStop }, nil)
+	if err != errStop {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSyncHeadersCancel(t *testing.T) {
+	// Chunk requests are only answered once the test completes
+	srv := newTestServer(t, map[string]string{"blockchain.headers.subscribe": `{"height":5000}`})
+	unanswered := make(chan struct{})
+	srv.HandleFunc("blockchain.block.headers", func([]json.RawMessage) (interface{}, error) {
+		<-unanswered
+		return nil, nil
+	})
+	t.Cleanup(func() { close(unanswered) })
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = client.SyncHeaders(ctx, 0, func(h *BlockHeader) error { return nil }, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// Test server serving a chain of the provided length made of copies of the genesis header
+func mockHeaders(t *testing.T, tip int) *electrumtest.Server {
+	srv := newTestServer(t, map[string]string{"blockchain.headers.subscribe": fmt.Sprintf(`{"height":%d}`, tip-1)})
+	srv.HandleFunc("blockchain.block.headers", func(params []json.RawMessage) (interface{}, error) {
+		var start, count int
+		if len(params) < 2 || json.Unmarshal(params[0], &start) != nil || json.Unmarshal(params[1], &count) != nil {
+			return nil, &electrumtest.Error{Code: electrumtest.CodeBadRequest, Message: "invalid params"}
+		}
+		if start+count > tip {
+			count = tip - start
+		}
+		return &HeadersChunk{Count: count, Hex: strings.Repeat(genesisHeader, count), Max: 2016}, nil
+	})
+	return srv
+}
+
+func TestBlockHeaders(t *testing.T) {
+	client, err := New(&Options{Address: mockHeaders(t, 100).Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	chunk, err := client.BlockHeaders(90, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.Count != 10 || chunk.Max != 2016 || len(chunk.Hex) != 10*headerSize*2 {
+		t.Errorf("unexpected chunk: %d, %d", chunk.Count, chunk.Max)
+	}
+	headers, err := chunk.Headers(90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 10 || headers[0].BlockHeight != 90 || headers[9].BlockHeight != 99 || headers[9].Nonce != 2083236893 {
+		t.Errorf("unexpected headers: %+v", headers)
+	}
+
+	client.Protocol = Protocol11
+	if _, err := client.BlockHeaders(0, 1); !errors.Is(err, ErrUnavailableMethod) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHeaderCheckpointProof(t *testing.T) {
+	// Merkle tree of 4 headers, proving the one at height 2
+	var raw [][]byte
+	var leaves [][]byte
+	for i := 0; i < 4; i++ {
+		b, _ := hex.DecodeString(genesisHeader)
+		b[79] = byte(i)
+		raw = append(raw, b)
+		leaves = append(leaves, doubleSHA256(b))
+	}
+	left := doubleSHA256(append(append([]byte{}, leaves[0]...), leaves[1]...))
+	right := doubleSHA256(append(append([]byte{}, leaves[2]...), leaves[3]...))
+	root := reverseHex(doubleSHA256(append(append([]byte{}, left...), right...)))
+	branch := []string{reverseHex(leaves[3]), reverseHex(left)}
+	if !verifyHeaderBranch(hex.EncodeToString(raw[2]), 2, branch, root) {
+		t.Fatal("valid proof rejected")
+	}
+	if verifyHeaderBranch(hex.EncodeToString(raw[1]), 2, branch, root) {
+		t.Fatal("invalid proof accepted")
+	}
+
+	proof := fmt.Sprintf(`{"branch":["%s","%s"],"header":"%s","root":"%s"}`,
+		branch[0], branch[1], hex.EncodeToString(raw[2]), root)
+	srv := newTestServer(t, nil)
+
+	// Headers are only provided along with their proof when requesting a checkpoint
+	srv.HandleFunc("blockchain.block.header", func(params []json.RawMessage) (interface{}, error) {
+		if len(params) > 1 {
+			return json.RawMessage(proof), nil
+		}
+		return hex.EncodeToString(raw[2]), nil
+	})
+
+	// Chunks not starting at the proven height carry a header not matching the proof
+	srv.HandleFunc("blockchain.block.headers", func(params []json.RawMessage) (interface{}, error) {
+		header := raw[2]
+		if string(params[0]) != "2" {
+			header = raw[1]
+		}
+		return &HeadersChunk{Count: 1, Hex: hex.EncodeToString(header), Max: 2016, Branch: branch, Root: root}, nil
+	})
+	client, err := New(&Options{
+		Address:         srv.Addr(),
+		Protocol:        Protocol14,
+		VerifyResponses: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	header, err := client.BlockHeaderProof(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.BlockHeight != 2 || header.Root != root || len(header.Branch) != 2 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+	header, err = client.BlockHeaderProof(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.BlockHeight != 2 || header.RawHex != hex.EncodeToString(raw[2]) || header.Root != "" || header.Branch != nil {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	// Plain header requests use the method available on the protocol in use
+	if header, err = client.BlockHeader(2); err != nil || header.RawHex != hex.EncodeToString(raw[2]) {
+		t.Errorf("unexpected header: %+v, %v", header, err)
+	}
+	if req := srv.Requests(); req[len(req)-1].Method != "blockchain.block.header" || len(req[len(req)-1].Params) != 1 {
+		t.Errorf("unexpected request: %+v", req[len(req)-1])
+	}
+	c, err := client.BlockHeadersProof(2, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Root != root || len(c.Branch) != 2 {
+		t.Errorf("unexpected chunk: %+v", c)
+	}
+	if _, err := client.BlockHeadersProof(1, 1, 3); !errors.Is(err, ErrServerMismatch) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Checkpoint proofs require protocol 1.4, and the header method protocol 1.3
+	client.Protocol = Protocol12
+	if _, err := client.BlockHeaderProof(2, 3); !errors.Is(err, ErrUnavailableMethod) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.BlockHeaderProof(2, 0); !errors.Is(err, ErrUnavailableMethod) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.BlockHeadersProof(2, 1, 3); !errors.Is(err, ErrUnavailableMethod) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHeaderChain(t *testing.T) {
+	// Build a header at the given height linked to the provided one
+	next := func(prev *BlockHeader, nonce byte) *BlockHeader {
+		raw, _ := hex.DecodeString(genesisHeader)
+		parent, _ := hex.DecodeString(prev.RawHex)
+		copy(raw[4:36], doubleSHA256(parent))
+		raw[79] = nonce
+		h, _ := parseHeader(raw, prev.BlockHeight+1)
+		return h
+	}
+	raw, _ := hex.DecodeString(genesisHeader)
+	first, _ := parseHeader(raw, 10)
+	second := next(first, 0)
+	third := next(second, 0)
+	competing := next(second, 0xff)
+	unlinked := next(first, 0)
+	unlinked.BlockHeight = 12
+
+	chain := newHeaderChain(2)
+	if !chain.link(first) || !chain.link(third) || !chain.link(second) {
+		t.Fatal("linked headers rejected")
+	}
+	if chain.link(competing) || chain.link(unlinked) {
+		t.Fatal("unlinked header accepted")
+	}
+	if _, ok := chain.entries[10]; ok {
+		t.Error("old header not discarded")
+	}
+
+	// A new tip replaces the known headers it doesn't link to
+	chain.extend(competing)
+	if !chain.link(competing) || chain.link(third) {
+		t.Error("reorganization not applied")
+	}
+	if !(*headerChain)(nil).link(unlinked) {
+		t.Error("header rejected without verification")
+	}
+}
@@ -0,0 +1,34 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Max time to wait for a health check response when the context has no deadline
+const defaultHealthCheckTimeout = 10 * time.Second
+
+// HealthCheck will send a protocol appropriate ping to the server, 'server.ping' or a
+// 'server.version' operation on older protocols, and return the measured round-trip time;
+// suitable for readiness probes and server selection logic. The check is limited to
+// 10 seconds when ctx has no deadline. Error responses still prove the server is alive
+// and are not reported, except the ones signaling an overloaded server. The time spent
+// waiting for an in-flight slot, when 'MaxInflight' is set, is not part of the result
+func (c *Client) HealthCheck(ctx context.Context) (time.Duration, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultHealthCheckTimeout)
+		defer cancel()
+	}
+	res, err := c.roundTrip(ctx, c.keepAliveRequest())
+	if err != nil {
+		return 0, err
+	}
+	if res.Error != nil {
+		if err := c.resError(res); errors.Is(err, ErrServerBusy) || errors.Is(err, ErrExcessiveUsage) {
+			return res.latency, err
+		}
+	}
+	return res.latency, nil
+}
@@ -0,0 +1,72 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+func TestHealthCheck(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if latency, err := client.HealthCheck(context.Background()); err != nil || latency <= 0 {
+		t.Errorf("unexpected result: %s, %v", latency, err)
+	}
+	if reqs := srv.Requests(); len(reqs) != 1 || reqs[0].Method != "server.ping" {
+		t.Errorf("unexpected requests: %+v", reqs)
+	}
+
+	// Overloaded server
+	srv.HandleError("server.ping", CodeServerBusy, "server busy")
+	if _, err := client.HealthCheck(context.Background()); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Other error responses still prove the server is alive
+	srv.HandleError("server.ping", CodeBadRequest, "bad request")
+	if _, err := client.HealthCheck(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	client.Stop()
+	if _, err := client.HealthCheck(context.Background()); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHealthCheckInflight(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+
+	client, err := New(&Options{Address: srv.Addr(), MaxInflight: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// The wait for an in-flight slot is not measured
+	const hold = 100 * time.Millisecond
+	client.inflight <- struct{}{}
+	go func() {
+		time.Sleep(hold)
+		<-client.inflight
+	}()
+	start := time.Now()
+	latency, err := client.HealthCheck(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < hold || latency >= hold {
+		t.Errorf("unexpected latency: %s, elapsed %s", latency, elapsed)
+	}
+}
@@ -0,0 +1,161 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnconfirmedTx is returned when an operation requires a confirmed transaction
+var ErrUnconfirmedTx = errors.New("UNCONFIRMED_TRANSACTION")
+
+// TransactionMerkleByID will synchronously run a 'blockchain.transaction.get_merkle'
+// operation without requiring the confirmation height of the transaction; the height
+// is resolved using the history of the hint addresses provided, if any, or the
+// verbose transaction details otherwise
+func (c *Client) TransactionMerkleByID(txid string, hintAddresses ...string) (*TxMerkle, error) {
+	return c.TransactionMerkleByIDContext(context.Background(), txid, hintAddresses...)
+}
+
+// TransactionMerkleByIDContext is like TransactionMerkleByID but uses the provided context to
+// cancel the operation
+func (c *Client) TransactionMerkleByIDContext(ctx context.Context, txid string, hintAddresses ...string) (*TxMerkle, error) {
+	height, err := c.TxHeightContext(ctx, txid, hintAddresses...)
+	if err != nil {
+		return nil, err
+	}
+	return c.TransactionMerkleContext(ctx, txid, height)
+}
+
+// TxHeight determines the confirmation height of a transaction. The history of the
+// hint addresses, i.e. addresses involved in the transaction, is checked first; if
+// not found there, the height is calculated from the number of confirmations
+// reported on the verbose transaction details and the current chain tip, failing
+// with ErrTipChanged if the tip keeps moving meanwhile. ErrUnconfirmedTx is returned
+// for transactions not yet included in a block
+func (c *Client) TxHeight(txid string, hintAddresses ...string) (int, error) {
+	return c.TxHeightContext(context.Background(), txid, hintAddresses...)
+}
+
+// TxHeightContext is like TxHeight but uses the provided context to cancel the operation
+func (c *Client) TxHeightContext(ctx context.Context, txid string, hintAddresses ...string) (int, error) {
+	for _, addr := range hintAddresses {
+		history, err := c.AddressHistoryContext(ctx, addr)
+		if err != nil || history == nil {
+			continue
+		}
+		for _, tx := range *history {
+			if tx.Hash == txid {
+				if tx.Height <= 0 {
+					return 0, ErrUnconfirmedTx
+				}
+				return int(tx.Height), nil
+			}
+		}
+	}
+
+	// Use the number of confirmations reported by the server's daemon, which is only
+	// consistent with the chain tip if it didn't move while requesting them
+	for i := 0; i < snapshotAttempts; i++ {
+		tip, err := c.tipHeight(ctx)
+		if err != nil {
+			return 0, err
+		}
+		confirmations, err := c.confirmations(ctx, txid)
+		if err != nil {
+			return 0, err
+		}
+		current, err := c.tipHeight(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if current != tip {
+			continue
+		}
+		if confirmations < 1 {
+			return 0, ErrUnconfirmedTx
+		}
+		return tip - confirmations + 1, nil
+	}
+	return 0, ErrTipChanged
+}
+
+// Get the number of confirmations of a transaction from its verbose details
+func (c *Client) confirmations(ctx context.Context, txid string) (int, error) {
+	res, err := c.syncRequest(ctx, c.req("blockchain.transaction.get", txid, true))
+	if err != nil {
+		return 0, err
+	}
+	if res.Error != nil {
+		return 0, c.resError(res)
+	}
+	details, ok := res.Result.(map[string]interface{})
+	if !ok {
+		return 0, ErrUnavailableMethod
+	}
+	confirmations, _ := details["confirmations"].(float64)
+	return int(confirmations), nil
+}
+
+// Get the current height of the chain tip
+func (c *Client) tipHeight(ctx context.Context) (int, error) {
+	res, err := c.syncRequest(ctx, c.req("blockchain.headers.subscribe"))
+	if err != nil {
+		return 0, err
+	}
+	if res.Error != nil {
+		return 0, c.resError(res)
+	}
+	tip, _ := res.Result.(map[string]interface{})
+	for _, k := range []string{"height", "block_height"} {
+		if h, ok := tip[k].(float64); ok {
+			return int(h), nil
+		}
+	}
+	return 0, ErrUnavailableMethod
+}
+
+// FirstSeenHeight returns the earliest confirmed height on the history of an address,
+// useful to bound rescans when restoring wallets; the boolean result is false when
+// the address has no confirmed transactions
+func (c *Client) FirstSeenHeight(address string) (int, bool, error) {
+	return c.FirstSeenHeightContext(context.Background(), address)
+}
+
+// FirstSeenHeightContext is like FirstSeenHeight but uses the provided context to cancel
+// the operation
+func (c *Client) FirstSeenHeightContext(ctx context.Context, address string) (int, bool, error) {
+	history, err := c.AddressHistoryContext(ctx, address)
+	if err != nil || history == nil {
+		return 0, false, err
+	}
+	height, found := firstConfirmed(*history)
+	return height, found, nil
+}
+
+// ScriptHashFirstSeenHeight returns the earliest confirmed height on the history of a
+// script hash; the boolean result is false when it has no confirmed transactions
+func (c *Client) ScriptHashFirstSeenHeight(scripthash string) (int, bool, error) {
+	return c.ScriptHashFirstSeenHeightContext(context.Background(), scripthash)
+}
+
+// ScriptHashFirstSeenHeightContext is like ScriptHashFirstSeenHeight but uses the provided
+// context to cancel the operation
+func (c *Client) ScriptHashFirstSeenHeightContext(ctx context.Context, scripthash string) (int, bool, error) {
+	history, err := c.ScriptHashHistoryContext(ctx, scripthash)
+	if err != nil || history == nil {
+		return 0, false, err
+	}
+	height, found := firstConfirmed(*history)
+	return height, found, nil
+}
+
+// Get the lowest confirmed height from a history list
+func firstConfirmed(history []Tx) (int, bool) {
+	height, found := 0, false
+	for _, tx := range history {
+		if tx.Height > 0 && (!found || int(tx.Height) < height) {
+			height, found = int(tx.Height), true
+		}
+	}
+	return height, found
+}
@@ -0,0 +1,90 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTxHeight(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"blockchain.address.get_history":    `[{"tx_hash":"aa","height":100},{"tx_hash":"bb","height":0},{"tx_hash":"dd","height":-1}]`,
+		"blockchain.transaction.get":        `{"txid":"cc","confirmations":10}`,
+		"blockchain.headers.subscribe":      `{"height":209,"hex":"00"}`,
+		"blockchain.transaction.get_merkle": `{"block_height":100,"pos":1,"merkle":["dd"]}`,
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	cases := []struct {
+		txid   string
+		height int
+		err    error
+	}{
+		{"aa", 100, nil},
+		{"bb", 0, ErrUnconfirmedTx},
+		{"dd", 0, ErrUnconfirmedTx},
+		{"cc", 200, nil},
+	}
+	for _, c := range cases {
+		height, err := client.TxHeight(c.txid, "address")
+		if height != c.height || err != c.err {
+			t.Errorf("%s: unexpected result %d, %v", c.txid, height, err)
+		}
+	}
+
+	m, err := client.TransactionMerkleByID("aa", "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.BlockHeight != 100 || m.Pos != 1 {
+		t.Errorf("unexpected merkle: %+v", m)
+	}
+}
+
+func TestTxHeightTipChanged(t *testing.T) {
+	srv := newTestServer(t, map[string]string{"blockchain.transaction.get": `{"txid":"aa","confirmations":10}`})
+	srv.HandleFunc("blockchain.headers.subscribe", mockMovingTip(100))
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.TxHeight("aa"); err != ErrTipChanged {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// Requests are bound to the provided context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.TxHeightContext(ctx, "aa"); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFirstSeenHeight(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"blockchain.address.get_history":    `[{"tx_hash":"bb","height":0},{"tx_hash":"aa","height":120},{"tx_hash":"cc","height":100}]`,
+		"blockchain.scripthash.get_history": `[{"tx_hash":"dd","height":-1},{"tx_hash":"ee","height":90}]`,
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	height, found, err := client.FirstSeenHeight("address")
+	if err != nil || !found || height != 100 {
+		t.Errorf("unexpected result: %d, %v, %v", height, found, err)
+	}
+	height, found, err = client.ScriptHashFirstSeenHeight("scripthash")
+	if err != nil || !found || height != 90 {
+		t.Errorf("unexpected result: %d, %v, %v", height, found, err)
+	}
+	if _, found := firstConfirmed([]Tx{{Hash: "bb"}}); found {
+		t.Error("unexpected height for unconfirmed history")
+	}
+}
@@ -0,0 +1,95 @@
+package electrum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// JournalEntry records a request/response exchange with the server
+type JournalEntry struct {
+	// Protocol method invoked
+	Method string `json:"method"`
+
+	// SHA-256 digest of the encoded request parameters
+	ParamsHash string `json:"params_hash"`
+
+	// SHA-256 digest of the encoded result, empty if the operation failed
+	ResultHash string `json:"result_hash,omitempty"`
+
+	// Error produced by the operation, if any
+	Error string `json:"error,omitempty"`
+
+	// Address of the server that processed the request
+	Server string `json:"server"`
+
+	// Time the request was sent
+	Sent time.Time `json:"sent"`
+
+	// Time the response was received, or the operation failed
+	Received time.Time `json:"received"`
+}
+
+// Journal is a sink for request/response records; implementations must be safe
+// for concurrent use
+type Journal interface {
+	Record(entry *JournalEntry) error
+}
+
+// WriterJournal records entries as JSON lines on an underlying writer
+type WriterJournal struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewWriterJournal returns a journal writing one JSON document per entry to w
+func NewWriterJournal(w io.Writer) *WriterJournal {
+	return &WriterJournal{w: w}
+}
+
+// Record writes the entry to the underlying writer
+func (j *WriterJournal) Record(entry *JournalEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
+
+// Record an exchange on the client's journal; failures to record are logged
+func (c *Client) journalCall(req *request, start time.Time, res *response, err error) {
+	entry := &JournalEntry{
+		Method:     req.Method,
+		ParamsHash: c.digest(req.Params),
+		Server:     c.transport.address,
+		Sent:       start,
+		Received:   time.Now(),
+	}
+	switch {
+	case err != nil:
+		entry.Error = err.Error()
+	case res.Error != nil:
+		entry.Error = res.Error.Message
+	default:
+		entry.ResultHash = c.digest(res.Result)
+	}
+	if err := c.journal.Record(entry); err != nil && c.log != nil {
+		c.log.Warn("failed to record journal entry", "method", req.Method, "error", err)
+	}
+}
+
+// Hex-encoded SHA-256 digest of a value's encoding
+func (c *Client) digest(v interface{}) string {
+	b, err := c.codec.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,55 @@
+package electrum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	addr := newTestServer(t, map[string]string{
+		"server.banner": `"welcome"`,
+	}).Addr()
+	client, err := New(&Options{Address: addr, Journal: NewWriterJournal(buf)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServerBanner(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServerBanner(); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if _, err := client.ServerBanner(); err == nil {
+		t.Fatal("expected operation to fail")
+	}
+
+	var entries []*JournalEntry
+	s := bufio.NewScanner(buf)
+	for s.Scan() {
+		e := new(JournalEntry)
+		if err := json.Unmarshal(s.Bytes(), e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	first := entries[0]
+	if first.Method != "server.banner" || first.Server != addr || first.ParamsHash == "" || first.Error != "" {
+		t.Errorf("unexpected entry: %+v", first)
+	}
+	if first.Received.Before(first.Sent) {
+		t.Errorf("unexpected timestamps: %+v", first)
+	}
+	if entries[1].ResultHash != first.ResultHash || len(first.ResultHash) != 64 {
+		t.Errorf("unexpected result digests: %s, %s", first.ResultHash, entries[1].ResultHash)
+	}
+	if entries[2].Error == "" || entries[2].ResultHash != "" {
+		t.Errorf("unexpected entry: %+v", entries[2])
+	}
+}
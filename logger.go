@@ -0,0 +1,40 @@
+package electrum
+
+import (
+	"log"
+	"log/slog"
+)
+
+// Logger is the logging sink used by the client; its methods match the ones provided
+// by *slog.Logger, taking alternating key/value pairs as structured fields
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// StdLogger adapts a standard library *log.Logger to the Logger interface, for applications
+// not using log/slog; entries of every level are written using the slog text format
+func StdLogger(l *log.Logger) Logger {
+	return slog.New(slog.NewTextHandler(logWriter{l}, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// Timestamps are already handled by the underlying logger
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+// Writer forwarding formatted entries to a standard library logger
+type logWriter struct {
+	l *log.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.l.Print(string(p))
+	return len(p), nil
+}
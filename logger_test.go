@@ -0,0 +1,62 @@
+package electrum
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Buffer safe for concurrent writes from the client's processing loops
+type syncBuffer struct {
+	buf bytes.Buffer
+	sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+func TestLogger(t *testing.T) {
+	out := &syncBuffer{}
+	client, err := New(&Options{
+		Address: newTestServer(t, map[string]string{"server.banner": `"Welcome"`}).Addr(),
+		Log:     slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServerBanner(); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	for _, expected := range []string{
+		`msg="request sent" method=server.banner id=0`,
+		`msg="request completed" method=server.banner id=0 duration=`,
+		`msg="connection state changed"`,
+		`state=CLOSED`,
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("missing log entry: %s\n%s", expected, out)
+		}
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	StdLogger(log.New(out, "electrum: ", 0)).Debug("request sent", "method", "server.ping", "id", 4)
+	if res := out.String(); res != "electrum: level=DEBUG msg=\"request sent\" method=server.ping id=4\n" {
+		t.Errorf("unexpected result: %q", res)
+	}
+}
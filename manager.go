@@ -0,0 +1,229 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Manager errors
+var (
+	ErrQuotaExceeded = errors.New("QUOTA_EXCEEDED")
+	ErrNoClients     = errors.New("NO_CLIENTS")
+)
+
+// Quota defines the usage limits for a tenant; zero values disable the
+// corresponding limit
+type Quota struct {
+	// Max number of protocol requests per second; every request sent counts, including
+	// the ones of each item on a batch and the ones sent by composite operations, e.g.
+	// SyncHeaders. Subscribe requests are limited by 'MaxSubscriptions' instead
+	RequestRate float64
+
+	// Max number of requests that can be run in a single burst, defaults to 1
+	// when a request rate is set
+	RequestBurst int
+
+	// Max number of simultaneous subscriptions; every subscription counts, including the
+	// ones tracking each key of a SubscriptionSet
+	MaxSubscriptions int
+}
+
+// Manager owns a set of client connections that are shared among multiple
+// tenants, each with its own usage quota
+type Manager struct {
+	clients []*Client
+	tenants map[string]*Tenant
+	next    int
+	mu      sync.Mutex
+}
+
+// TenantClient is the view of a managed connection available to tenants; it provides the
+// protocol operations but not the ones affecting the connection itself or the subscriptions
+// of other tenants sharing it, e.g. Close or UnsubscribeAll
+type TenantClient interface {
+	ServerPingContext(ctx context.Context) error
+	ServerVersionContext(ctx context.Context) (*VersionInfo, error)
+	ServerBannerContext(ctx context.Context) (string, error)
+	ServerDonationAddressContext(ctx context.Context) (string, error)
+	ServerFeaturesContext(ctx context.Context) (*ServerInfo, error)
+	ServerPeersContext(ctx context.Context) ([]*Peer, error)
+	AddressBalanceContext(ctx context.Context, address string) (*Balance, error)
+	AddressHistoryContext(ctx context.Context, address string) (*[]Tx, error)
+	AddressMempoolContext(ctx context.Context, address string) (*[]Tx, error)
+	AddressListUnspentContext(ctx context.Context, address string) (*[]Tx, error)
+	ScriptHashBalanceContext(ctx context.Context, scripthash string) (*Balance, error)
+	ScriptHashHistoryContext(ctx context.Context, scripthash string) (*[]Tx, error)
+	ScriptHashMempoolContext(ctx context.Context, scripthash string) (*[]Tx, error)
+	ScriptHashListUnspentContext(ctx context.Context, scripthash string) (*[]Tx, error)
+	BlockHeaderContext(ctx context.Context, index int) (*BlockHeader, error)
+	BlockHeaderProofContext(ctx context.Context, height, cpHeight int) (*BlockHeader, error)
+	BlockHeadersContext(ctx context.Context, start, count int) (*HeadersChunk, error)
+	BlockHeadersProofContext(ctx context.Context, start, count, cpHeight int) (*HeadersChunk, error)
+	Headers(start, end int) *HeaderIterator
+	HeadersContext(ctx context.Context, start, end int) *HeaderIterator
+	SyncHeaders(ctx context.Context, start int, handler func(*BlockHeader) error, progress func(*SyncProgress)) error
+	BroadcastTransactionContext(ctx context.Context, hex string) (string, error)
+	GetTransactionContext(ctx context.Context, hash string) (string, error)
+	GetTransactionVerboseContext(ctx context.Context, hash string) (*TransactionInfo, error)
+	GetTransactions(ctx context.Context, hashes []string) ([]TransactionResult, error)
+	TransactionMerkleContext(ctx context.Context, tx string, height int) (*TxMerkle, error)
+	TransactionIDFromPosContext(ctx context.Context, height, pos int, withMerkle bool) (string, []string, error)
+	TransactionMerkleByIDContext(ctx context.Context, txid string, hintAddresses ...string) (*TxMerkle, error)
+	TxHeightContext(ctx context.Context, txid string, hintAddresses ...string) (int, error)
+	FirstSeenHeightContext(ctx context.Context, address string) (int, bool, error)
+	ScriptHashFirstSeenHeightContext(ctx context.Context, scripthash string) (int, bool, error)
+	SnapshotContext(ctx context.Context, addresses []string, proofs bool) (*UTXOSnapshot, error)
+	EstimateFeeContext(ctx context.Context, blocks int) (float64, error)
+	EstimateFeeRateContext(ctx context.Context, blocks int) (Amount, error)
+	RelayFeeContext(ctx context.Context) (Amount, error)
+	FeeHistogramContext(ctx context.Context) ([]FeeHistogramEntry, error)
+	NotifyBlockHeaders(ctx context.Context) (<-chan *BlockHeader, *Subscription, error)
+	SubscribeBlockHeaders(ctx context.Context) (*BlockHeader, <-chan *BlockHeader, error)
+	NotifyTipHeight(ctx context.Context) (<-chan int64, error)
+	NotifyPeers(ctx context.Context) (<-chan []*Peer, *Subscription, error)
+	NotifyAddressTransactions(ctx context.Context, address string) (<-chan *AddressStatus, *Subscription, error)
+	SubscribeAddressTransactions(ctx context.Context, address string) (string, <-chan *AddressStatus, error)
+	NotifyAddressHistory(ctx context.Context, address string) (<-chan Tx, *Subscription, error)
+	NotifyScriptHash(ctx context.Context, scripthash string) (<-chan *ScriptHashStatus, *Subscription, error)
+	SubscribeScriptHash(ctx context.Context, scripthash string) (string, <-chan *ScriptHashStatus, error)
+	WatchAddresses(ctx context.Context, addresses ...string) (*SubscriptionSet, error)
+	WatchScriptHashes(ctx context.Context, scripthashes ...string) (*SubscriptionSet, error)
+	WatchConflicts(ctx context.Context, txid string, addresses []string) (<-chan *Conflict, error)
+}
+
+// Tenant provides access to a managed client connection, enforcing the
+// quota assigned to it
+type Tenant struct {
+	// Identifier of the tenant
+	ID string
+
+	client *Client
+	view   *tenantClient
+	quota  Quota
+	tokens float64
+	last   time.Time
+	subs   int
+	mu     sync.Mutex
+}
+
+// NewManager will create a client instance for each of the provided options
+func NewManager(options ...*Options) (*Manager, error) {
+	if len(options) == 0 {
+		return nil, ErrNoClients
+	}
+	m := &Manager{tenants: make(map[string]*Tenant)}
+	for _, o := range options {
+		c, err := New(o)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.clients = append(m.clients, c)
+	}
+	return m, nil
+}
+
+// Tenant returns the handle for the given identifier, creating it with the provided
+// quota if required; tenants are assigned to the managed connections in turns.
+// The quota of an existing tenant is replaced when a new one is provided
+func (m *Manager) Tenant(id string, quota *Quota) *Tenant {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tenants[id]
+	if !ok {
+		c := m.clients[m.next%len(m.clients)]
+		t = &Tenant{
+			ID:     id,
+			client: c,
+			last:   time.Now(),
+		}
+		t.view = &tenantClient{client: c, tenant: t}
+		m.next++
+		m.tenants[id] = t
+	}
+	if quota != nil {
+		t.mu.Lock()
+		t.quota = *quota
+		if t.quota.RequestRate > 0 && t.quota.RequestBurst <= 0 {
+			t.quota.RequestBurst = 1
+		}
+		t.tokens = float64(t.quota.RequestBurst)
+		t.mu.Unlock()
+	}
+	return t
+}
+
+// Close will terminate all managed client instances
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.clients {
+		c.Close()
+	}
+}
+
+// Call runs a synchronous operation on the tenant's connection; every protocol request
+// sent through the provided client is subject to the request rate quota, failing with
+// ErrQuotaExceeded when it doesn't allow it
+func (t *Tenant) Call(fn func(c TenantClient) error) error {
+	return fn(t.view)
+}
+
+// Subscribe runs a subscription setup operation on the tenant's connection; every
+// subscription created through the provided client is subject to the subscription
+// quota, failing with ErrQuotaExceeded when it doesn't allow it. Subscriptions are
+// accounted for until they terminate, e.g. when the provided context is done or when
+// the server drops them
+func (t *Tenant) Subscribe(ctx context.Context, fn func(ctx context.Context, c TenantClient) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return fn(ctx, t.view)
+}
+
+// Subscriptions returns the number of active subscriptions for the tenant
+func (t *Tenant) Subscriptions() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.subs
+}
+
+// Take a slot of the subscription quota, failing with ErrQuotaExceeded if none is left
+func (t *Tenant) acquireSubscription() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.quota.MaxSubscriptions > 0 && t.subs >= t.quota.MaxSubscriptions {
+		return ErrQuotaExceeded
+	}
+	t.subs++
+	return nil
+}
+
+func (t *Tenant) releaseSubscription() {
+	t.mu.Lock()
+	t.subs--
+	t.mu.Unlock()
+}
+
+// Token bucket based check of the request rate quota; the requests sent together,
+// e.g. as a batch, are either all allowed or all rejected
+func (t *Tenant) allowRequests(n int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.quota.RequestRate <= 0 {
+		return true
+	}
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.quota.RequestRate
+	if max := float64(t.quota.RequestBurst); t.tokens > max {
+		t.tokens = max
+	}
+	t.last = now
+	if t.tokens < float64(n) {
+		return false
+	}
+	t.tokens -= float64(n)
+	return true
+}
@@ -0,0 +1,150 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestManager(t *testing.T) {
+	addr := newTestServer(t, map[string]string{
+		"server.banner":                   `"Welcome"`,
+		"blockchain.headers.subscribe":    `{"height":100}`,
+		"blockchain.scripthash.subscribe": `"status"`,
+		"blockchain.transaction.get":      `"00"`,
+	}).Addr()
+	m, err := NewManager(&Options{Address: addr}, &Options{Address: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	t.Run("Assignment", func(t *testing.T) {
+		a := m.Tenant("a", nil)
+		b := m.Tenant("b", nil)
+		if a.client == b.client {
+			t.Error("tenants not distributed among connections")
+		}
+		if m.Tenant("a", nil) != a {
+			t.Error("tenant handle not reused")
+		}
+	})
+
+	t.Run("RequestRate", func(t *testing.T) {
+		tenant := m.Tenant("rate", &Quota{RequestRate: 1, RequestBurst: 2})
+		call := func(c TenantClient) error {
+			if _, ok := c.(*Client); ok {
+				t.Error("client exposed to tenant")
+			}
+			_, err := c.ServerBannerContext(context.Background())
+			return err
+		}
+		for i := 0; i < 2; i++ {
+			if err := tenant.Call(call); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tenant.Call(call); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		// Every request sent by an operation counts, including batch items
+		tenant = m.Tenant("rate-multi", &Quota{RequestRate: 0.01, RequestBurst: 3})
+		sent := 0
+		err := tenant.Call(func(c TenantClient) error {
+			for i := 0; i < 4; i++ {
+				if _, err := c.ServerBannerContext(context.Background()); err != nil {
+					return err
+				}
+				sent++
+			}
+			return nil
+		})
+		if !errors.Is(err, ErrQuotaExceeded) || sent != 3 {
+			t.Errorf("unexpected result: %d requests sent, %v", sent, err)
+		}
+		tenant = m.Tenant("rate-batch", &Quota{RequestRate: 0.01, RequestBurst: 3})
+		err = tenant.Call(func(c TenantClient) error {
+			results, err := c.GetTransactions(context.Background(), []string{"aa", "bb", "cc", "dd"})
+			if err != nil {
+				return err
+			}
+			return results[0].Err
+		})
+		if !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Subscriptions", func(t *testing.T) {
+		tenant := m.Tenant("subs", &Quota{MaxSubscriptions: 1})
+		var sub *Subscription
+		subscribe := func(ctx context.Context, c TenantClient) error {
+			var err error
+			_, sub, err = c.NotifyBlockHeaders(ctx)
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := tenant.Subscribe(ctx, subscribe); err != nil {
+			t.Fatal(err)
+		}
+		if err := tenant.Subscribe(context.Background(), subscribe); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		// Subscriptions opened through synchronous operations count as well
+		err := tenant.Call(func(c TenantClient) error {
+			_, _, err := c.NotifyScriptHash(context.Background(), "scripthash")
+			return err
+		})
+		if !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		cancel()
+		waitReleased(t, tenant)
+
+		// Every subscription opened by an operation counts
+		tenant = m.Tenant("subs-multi", &Quota{MaxSubscriptions: 2})
+		ctx, cancel = context.WithCancel(context.Background())
+		opened := 0
+		err = tenant.Subscribe(ctx, func(ctx context.Context, c TenantClient) error {
+			for _, key := range []string{"a", "b", "c"} {
+				if _, _, err := c.NotifyScriptHash(ctx, key); err != nil {
+					return err
+				}
+				opened++
+			}
+			return nil
+		})
+		if !errors.Is(err, ErrQuotaExceeded) || opened != 2 || tenant.Subscriptions() != 2 {
+			t.Errorf("unexpected result: %d subscriptions opened, %v", opened, err)
+		}
+		set, err := tenant.view.WatchScriptHashes(ctx, "d")
+		if !errors.Is(err, ErrQuotaExceeded) || set != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		cancel()
+		waitReleased(t, tenant)
+		tenant = m.Tenant("subs", nil)
+
+		// Released as well when terminated other than through the context
+		if err := tenant.Subscribe(context.Background(), subscribe); err != nil {
+			t.Fatal(err)
+		}
+		sub.Unsubscribe()
+		waitReleased(t, tenant)
+	})
+}
+
+// Wait for the subscriptions of a tenant to be released
+func waitReleased(t *testing.T, tenant *Tenant) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for tenant.Subscriptions() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription not released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
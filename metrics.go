@@ -0,0 +1,75 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// Metrics receives instrumentation events from the client, e.g. to export request counts,
+// latencies and connectivity indicators to Prometheus; implementations must be safe for
+// concurrent use and must not block. A minimal Prometheus adapter looks like
+//
+//	type promMetrics struct {
+//		latency       *prometheus.HistogramVec // labels: method, code
+//		reconnects    prometheus.Counter
+//		subscriptions prometheus.Gauge
+//	}
+//
+//	func (m *promMetrics) ObserveCall(info *electrum.CallInfo) {
+//		code := "ok"
+//		if info.Err != nil {
+//			code = electrum.ErrorCode(info.Err)
+//		}
+//		m.latency.WithLabelValues(info.Method, code).Observe(info.Latency.Seconds())
+//	}
+//
+//	func (m *promMetrics) ObserveReconnect()           { m.reconnects.Inc() }
+//	func (m *promMetrics) SetSubscriptions(count int) { m.subscriptions.Set(float64(count)) }
+type Metrics interface {
+	// ObserveCall is invoked after every synchronous operation, successful or not
+	ObserveCall(info *CallInfo)
+
+	// ObserveReconnect is invoked every time the connection with the server is recovered
+	ObserveReconnect()
+
+	// SetSubscriptions is invoked with the number of active subscriptions when it changes
+	SetSubscriptions(count int)
+}
+
+// ErrorCode returns a short label identifying the kind of an operation error, suitable to
+// aggregate failures in metrics: the numeric code for errors reported by the server,
+// 'timeout', 'closed' or 'canceled' for the common client side failures and 'other' for
+// anything else; empty for a nil error
+func ErrorCode(err error) string {
+	var rpcErr *RPCError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &rpcErr):
+		return strconv.FormatInt(rpcErr.Code, 10)
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, ErrConnClosed), errors.Is(err, ErrClientClosed):
+		return "closed"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "other"
+	}
+}
+
+// Report the number of active subscriptions to the metrics hook; must be called
+// without holding the client lock. Reports are serialized and the count is read
+// when reporting, so the last value delivered is always the current one
+func (c *Client) reportSubscriptions() {
+	if c.metrics == nil {
+		return
+	}
+	c.reporting.Lock()
+	defer c.reporting.Unlock()
+	c.Lock()
+	count := c.activeSubscriptions()
+	c.Unlock()
+	c.metrics.SetSubscriptions(count)
+}
@@ -0,0 +1,108 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+// Metrics hook keeping the observed events
+type mockMetrics struct {
+	calls         []string
+	reconnects    int
+	subscriptions []int
+	active        []int
+	client        *Client
+	sync.Mutex
+}
+
+func (m *mockMetrics) ObserveCall(info *CallInfo) {
+	m.Lock()
+	defer m.Unlock()
+	m.calls = append(m.calls, info.Method+":"+ErrorCode(info.Err))
+}
+
+func (m *mockMetrics) ObserveReconnect() {
+	m.Lock()
+	defer m.Unlock()
+	m.reconnects++
+}
+
+func (m *mockMetrics) SetSubscriptions(count int) {
+	// Hooks are invoked without holding the client lock, so they can use the client
+	var active int
+	if m.client != nil {
+		active = len(m.client.Subscriptions())
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.subscriptions = append(m.subscriptions, count)
+	m.active = append(m.active, active)
+}
+
+func TestMetrics(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("server.banner", "Welcome")
+	srv.Handle("blockchain.scripthash.subscribe", "status")
+
+	metrics := &mockMetrics{}
+	client, err := New(&Options{Address: srv.Addr(), Metrics: metrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	metrics.Lock()
+	metrics.client = client
+	metrics.Unlock()
+
+	/* #nosec */
+	client.ServerBanner()
+	/* #nosec */
+	client.ServerDonationAddress()
+	ctx, cancel := context.WithCancel(context.Background())
+	statuses, _, err := client.NotifyScriptHash(ctx, "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-statuses
+	cancel()
+	for range statuses {
+	}
+
+	metrics.Lock()
+	defer metrics.Unlock()
+	if fmt.Sprint(metrics.calls) != "[server.banner: server.donation_address:-32601]" {
+		t.Errorf("unexpected calls: %v", metrics.calls)
+	}
+	if fmt.Sprint(metrics.subscriptions) != "[1 0]" {
+		t.Errorf("unexpected subscriptions: %v", metrics.subscriptions)
+	}
+	if fmt.Sprint(metrics.active) != "[1 0]" {
+		t.Errorf("unexpected active subscriptions: %v", metrics.active)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		code string
+	}{
+		{nil, ""},
+		{&CallError{Method: "server.banner", Err: &RPCError{Code: CodeDaemonError}}, "2"},
+		{&CallError{Method: "server.banner", Err: ErrTimeout}, "timeout"},
+		{ErrConnClosed, "closed"},
+		{context.Canceled, "canceled"},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), "timeout"},
+		{errors.New("failure"), "other"},
+	}
+	for _, c := range cases {
+		if code := ErrorCode(c.err); code != c.code {
+			t.Errorf("unexpected code for %v: %s", c.err, code)
+		}
+	}
+}
@@ -2,9 +2,17 @@ package electrum
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,8 +27,89 @@ const (
 	Reconnecting ConnectionState = "RECONNECTING"
 	Reconnected  ConnectionState = "RECONNECTED"
 	Closed       ConnectionState = "CLOSED"
+	Failed       ConnectionState = "FAILED"
 )
 
+// Default delay between reconnection attempts
+const defaultReconnectDelay = 5 * time.Second
+
+// ReconnectOptions define how the connection is recovered when dropped; the delay between
+// attempts starts at 'InitialDelay' and is multiplied on every failed attempt up to 'MaxDelay'
+type ReconnectOptions struct {
+	// Delay before the first reconnection attempt, defaults to 5 seconds
+	InitialDelay time.Duration
+
+	// Max delay between attempts, defaults to 1 minute
+	MaxDelay time.Duration
+
+	// Factor applied to the delay after every failed attempt, defaults to 2
+	Multiplier float64
+
+	// If provided, every delay is increased by a random amount of time within the
+	// window, to prevent clients from reconnecting in lockstep
+	Jitter time.Duration
+
+	// If set, will limit the number of reconnection attempts; the connection enters
+	// the terminal Failed state once exhausted
+	MaxAttempts int
+
+	// If provided, will be used to calculate the delay between attempts instead
+	// of the exponential backoff settings
+	Backoff BackoffStrategy
+}
+
+// Delay before a given reconnection attempt, starting at 1; without options
+// attempts are made every 5 seconds
+func (r *ReconnectOptions) delay(attempt int) time.Duration {
+	if r == nil {
+		return defaultReconnectDelay
+	}
+	if r.Backoff != nil {
+		return r.Backoff.NextDelay(attempt)
+	}
+	b := &ExponentialBackoff{
+		Initial:    r.InitialDelay,
+		Max:        r.MaxDelay,
+		Multiplier: r.Multiplier,
+		Jitter:     r.Jitter,
+	}
+	if b.Initial <= 0 {
+		b.Initial = defaultReconnectDelay
+	}
+	return b.NextDelay(attempt)
+}
+
+// Check if the max number of reconnection attempts was reached
+func (r *ReconnectOptions) exhausted(attempt int) bool {
+	return r != nil && r.MaxAttempts > 0 && attempt >= r.MaxAttempts
+}
+
+// Transport is the network layer used by the client to exchange protocol messages with
+// the server; custom implementations can be provided with the 'Transport' option, e.g.
+// to instrument the traffic or to reach the server over an unsupported medium
+type Transport interface {
+	// SendMessage delivers a single delimiter-terminated message to the server; the
+	// message buffer is reused by the client once the method returns, implementations
+	// must not retain it, or keep a copy when delivery is asynchronous
+	SendMessage(message []byte) error
+
+	// Messages returns the channel used to deliver the messages received from the
+	// server, one per value
+	Messages() <-chan []byte
+
+	// Errors returns the channel used to report non-fatal transport errors
+	Errors() <-chan error
+
+	// States returns the channel used to report connection state changes
+	States() <-chan ConnectionState
+
+	// Close terminates the transport; no values are delivered on its
+	// channels afterwards
+	Close() error
+}
+
+// Default transport, using a single network connection that is automatically
+// recovered when dropped
 type transport struct {
 	conn     net.Conn
 	messages chan []byte
@@ -30,36 +119,168 @@ type transport struct {
 	opts     *transportOptions
 	state    chan ConnectionState
 	r        *bufio.Reader
+	dropErr  error
 	mu       sync.Mutex
 }
 
 type transportOptions struct {
-	address string
-	tls     *tls.Config
+	address   string
+	tls       *tls.Config
+	websocket bool
+	path      string
+	network   string
+	reconnect *ReconnectOptions
+	dial      func(ctx context.Context, network, addr string) (net.Conn, error)
+	timeout   time.Duration
+	proxy     *ProxyOptions
+	idle      time.Duration
+	write     time.Duration
+	keepAlive time.Duration
+	delay     bool
+	local     net.Addr
 }
 
-// Get network connection
-func connect(opts *transportOptions) (net.Conn, error) {
-	conn, err := net.Dial("tcp", opts.address)
-	if err != nil {
-		return nil, err
+// Default period of TCP keep-alive probes
+const defaultTCPKeepAlive = 30 * time.Second
+
+// Supported address schemes
+const (
+	schemeTCP  = "tcp"
+	schemeSSL  = "ssl"
+	schemeTLS  = "tls"
+	schemeWS   = "ws"
+	schemeWSS  = "wss"
+	schemeUnix = "unix"
+)
+
+// Transport setup errors
+var (
+	ErrUnsupportedScheme = errors.New("UNSUPPORTED_SCHEME")
+	ErrInvalidPin        = errors.New("INVALID_PIN")
+	ErrCertMismatch      = errors.New("CERTIFICATE_MISMATCH")
+	ErrIdleTimeout       = errors.New("IDLE_TIMEOUT")
+	ErrKeepAliveFailed   = errors.New("KEEP_ALIVE_FAILED")
+)
+
+// Build the transport options for a server address; addresses can be provided as
+// plain 'host:port' values or using a URL-style scheme: 'tcp://host:port',
+// 'ssl://host:port', 'ws://host:port/path', 'wss://host:port/path' or 'unix:///path' for
+// servers listening on a UNIX domain socket. Secure schemes will use the provided TLS
+// configuration or a default one verifying the server name
+func parseAddress(address string, tlsConf *tls.Config) (*transportOptions, error) {
+	i := strings.Index(address, "://")
+	if i < 0 {
+		return &transportOptions{address: address, tls: tlsConf}, nil
 	}
-	if err := conn.(*net.TCPConn).SetKeepAlive(true); err != nil {
-		return nil, err
+	if strings.ToLower(address[:i]) == schemeUnix {
+		return &transportOptions{address: address[i+3:], network: schemeUnix}, nil
 	}
-	if err := conn.(*net.TCPConn).SetKeepAlivePeriod(30 * time.Second); err != nil {
-		return nil, err
+
+	opts := &transportOptions{address: address[i+3:]}
+	if j := strings.Index(opts.address, "/"); j >= 0 {
+		opts.address, opts.path = opts.address[:j], opts.address[j:]
+	}
+	scheme := strings.ToLower(address[:i])
+	switch scheme {
+	case schemeTCP:
+	case schemeWS:
+		opts.websocket = true
+	case schemeSSL, schemeTLS, schemeWSS:
+		opts.websocket = scheme == schemeWSS
+		opts.tls = tlsConf
+		if opts.tls == nil {
+			host, _, err := net.SplitHostPort(opts.address)
+			if err != nil {
+				return nil, err
+			}
+			opts.tls = &tls.Config{ServerName: host}
+		}
+	default:
+		return nil, ErrUnsupportedScheme
 	}
+	return opts, nil
+}
 
+// Ensure the transport uses its own TLS configuration, so it can be customized without
+// affecting the one provided by the user; the connection will use TLS even if the address
+// doesn't specify a secure scheme
+func (opts *transportOptions) secure() error {
 	if opts.tls != nil {
-		return tls.Client(conn, opts.tls), nil
+		opts.tls = opts.tls.Clone()
+		return nil
+	}
+	host, _, err := net.SplitHostPort(opts.address)
+	if err != nil {
+		return err
+	}
+	opts.tls = &tls.Config{ServerName: host}
+	return nil
+}
+
+// Add a client certificate to the transport's TLS configuration, used to authenticate
+// with servers requiring mutual TLS
+func (opts *transportOptions) setClientCertificate(cert tls.Certificate) error {
+	if err := opts.secure(); err != nil {
+		return err
+	}
+	opts.tls.Certificates = append(opts.tls.Certificates, cert)
+	return nil
+}
+
+// Verify the server certificate against a pinned SHA-256 fingerprint, of either the leaf
+// certificate or its public key info, instead of the system roots; suitable for servers
+// using self-signed certificates. A 'VerifyConnection' callback on the user's configuration
+// still runs once the pin is matched
+func (opts *transportOptions) setPin(pin string) error {
+	fingerprint, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+	if err != nil || len(fingerprint) != sha256.Size {
+		return ErrInvalidPin
+	}
+	if err := opts.secure(); err != nil {
+		return err
+	}
+	/* #nosec, the certificate is verified against the pin instead */
+	opts.tls.InsecureSkipVerify = true
+	verify := opts.tls.VerifyConnection
+	opts.tls.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return ErrCertMismatch
+		}
+		leaf := cs.PeerCertificates[0]
+		for _, raw := range [][]byte{leaf.Raw, leaf.RawSubjectPublicKeyInfo} {
+			if sum := sha256.Sum256(raw); subtle.ConstantTimeCompare(sum[:], fingerprint) == 1 {
+				if verify != nil {
+					return verify(cs)
+				}
+				return nil
+			}
+		}
+		return ErrCertMismatch
 	}
-	return conn, nil
+	return nil
+}
+
+// Resolve the local address used for connections, the port is optional
+func resolveLocalAddr(addr string) (net.Addr, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "0")
+	}
+	return net.ResolveTCPAddr("tcp", addr)
+}
+
+// Get network connection
+func connect(ctx context.Context, opts *transportOptions) (net.Conn, error) {
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	return dialServer(ctx, opts)
 }
 
 // Initialize a proper handler for the underlying network connection
-func getTransport(opts *transportOptions) (*transport, error) {
-	conn, err := connect(opts)
+func getTransport(ctx context.Context, opts *transportOptions) (*transport, error) {
+	conn, err := connect(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -76,87 +297,188 @@ func getTransport(opts *transportOptions) (*transport, error) {
 	return t, nil
 }
 
-// Prepare transport instance for usage with a given network connection
-func (t *transport) setup(conn net.Conn) {
+// Prepare transport instance for usage with a given network connection;
+// returns false if the transport was closed in the meantime
+func (t *transport) setup(conn net.Conn) bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	if t.closed() {
+		/* #nosec */
+		conn.Close()
+		return false
+	}
 	t.conn = conn
 	t.ready = true
 	t.r = bufio.NewReader(t.conn)
+	return true
 }
 
 // Attempt automatic reconnection
 func (t *transport) reconnect() {
+	t.mu.Lock()
 	if err := t.conn.Close(); err != nil {
-		t.errors <- err
+		t.emitError(err)
 	}
-	t.mu.Lock()
 	t.ready = false
 	t.mu.Unlock()
-	t.state <- Reconnecting
+	t.emitState(Reconnecting)
 
-	// Future implementations could include support for a max number of retries
-	// and dynamically increasing the interval
-	rt := time.NewTicker(5 * time.Second)
 	go func() {
-		defer rt.Stop()
-		for range rt.C {
-			conn, err := connect(t.opts)
-			if err == nil {
-				t.setup(conn)
-				t.state <- Reconnected
-				break
+		for attempt := 1; ; attempt++ {
+			wait := time.NewTimer(t.opts.reconnect.delay(attempt))
+			select {
+			case <-wait.C:
+			case <-t.done:
+				wait.Stop()
+				return
+			}
+			conn, err := connect(context.Background(), t.opts)
+			if err != nil {
+				t.emitError(fmt.Errorf("reconnect attempt %d failed: %w", attempt, err))
+				if t.opts.reconnect.exhausted(attempt) {
+					t.emitState(Failed)
+					return
+				}
+				continue
+			}
+			if !t.setup(conn) {
+				return
 			}
+			t.emitState(Reconnected)
+			go t.listen()
+			return
 		}
-		go t.listen()
 	}()
 }
 
-// Send raw bytes across the network
-func (t *transport) sendMessage(message []byte) error {
+// Messages returns the channel used to deliver received messages
+func (t *transport) Messages() <-chan []byte {
+	return t.messages
+}
+
+// Errors returns the channel used to report errors
+func (t *transport) Errors() <-chan error {
+	return t.errors
+}
+
+// States returns the channel used to report connection state changes
+func (t *transport) States() <-chan ConnectionState {
+	return t.state
+}
+
+// SendMessage sends raw bytes across the network
+func (t *transport) SendMessage(message []byte) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	if !t.ready {
 		return ErrUnreachableHost
 	}
 
+	if t.opts.write > 0 {
+		if err := t.conn.SetWriteDeadline(time.Now().Add(t.opts.write)); err != nil {
+			return err
+		}
+	}
 	_, err := t.conn.Write(message)
 	return err
 }
 
-// Finish execution and close network connection
-func (t *transport) close() {
+// Close finishes execution and closes the network connection; closing the connection
+// unblocks any pending read operation on the listening loop. Calling Close more than
+// once has no effect
+func (t *transport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed() {
+		return nil
+	}
 	close(t.done)
+	t.ready = false
+	return t.conn.Close()
+}
+
+// Abort the current connection, reported with the provided error, and recover it
+// through the regular reconnection process
+func (t *transport) drop(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.ready {
+		return
+	}
+	t.dropErr = err
+	t.ready = false
+	/* #nosec */
+	t.conn.SetReadDeadline(time.Unix(1, 0))
+}
+
+// Check if the transport was signaled to stop
+func (t *transport) closed() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Publish a state change, unless the transport is closed
+func (t *transport) emitState(s ConnectionState) {
+	select {
+	case t.state <- s:
+	case <-t.done:
+	}
+}
+
+// Publish an error, unless the transport is closed
+func (t *transport) emitError(err error) {
+	select {
+	case t.errors <- err:
+	case <-t.done:
+	}
 }
 
 // Wait for new messages on the network connection until
 // the instance is signaled to stop
 func (t *transport) listen() {
-	t.state <- Ready
-LOOP:
+	t.emitState(Ready)
 	for {
-		select {
-		case <-t.done:
-			if err := t.conn.Close(); err != nil {
-				t.errors <- err
-			}
-			t.state <- Closed
-			break LOOP
-		default:
-			line, err := t.r.ReadBytes(delimiter)
-
-			// Detect dropped connections
-			if err == io.EOF {
-				t.state <- Disconnected
-				t.reconnect()
-				break LOOP
+		// Connections without any incoming traffic during the idle window are
+		// considered dead, e.g. after a silently dropped NAT mapping; the deadline
+		// must not override the one set when dropping the connection
+		if t.opts.idle > 0 {
+			t.mu.Lock()
+			if t.ready {
+				/* #nosec */
+				t.conn.SetReadDeadline(time.Now().Add(t.opts.idle))
 			}
+			t.mu.Unlock()
+		}
+		line, err := t.r.ReadBytes(delimiter)
+		if t.closed() {
+			return
+		}
 
-			if err != nil {
-				t.errors <- err
-				break
+		// Detect dropped connections
+		if err != nil {
+			t.mu.Lock()
+			if t.dropErr != nil {
+				err, t.dropErr = t.dropErr, nil
+			} else if errors.Is(err, os.ErrDeadlineExceeded) {
+				err = ErrIdleTimeout
+			}
+			t.mu.Unlock()
+			if err != io.EOF {
+				t.emitError(err)
 			}
-			t.messages <- line
+			t.emitState(Disconnected)
+			t.reconnect()
+			return
+		}
+
+		select {
+		case t.messages <- line:
+		case <-t.done:
+			return
 		}
 	}
 }
@@ -0,0 +1,1061 @@
+package electrum
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1" // #nosec
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseAddress(t *testing.T) {
+	cases := []struct {
+		address   string
+		host      string
+		secure    bool
+		websocket bool
+		path      string
+	}{
+		{"electrum.example.com:50002", "electrum.example.com:50002", false, false, ""},
+		{"tcp://electrum.example.com:50001", "electrum.example.com:50001", false, false, ""},
+		{"ssl://electrum.example.com:50002", "electrum.example.com:50002", true, false, ""},
+		{"ws://electrum.example.com:8080", "electrum.example.com:8080", false, true, ""},
+		{"wss://electrum.example.com:50004/rpc", "electrum.example.com:50004", true, true, "/rpc"},
+		{"unix:///var/run/electrs.sock", "/var/run/electrs.sock", false, false, ""},
+	}
+	for _, c := range cases {
+		opts, err := parseAddress(c.address, nil)
+		if err != nil {
+			t.Errorf("%s: %s", c.address, err)
+			continue
+		}
+		if opts.address != c.host || (opts.tls != nil) != c.secure || opts.websocket != c.websocket || opts.path != c.path {
+			t.Errorf("%s: unexpected options %+v", c.address, opts)
+		}
+	}
+	if opts, _ := parseAddress("ssl://electrum.example.com:50002", nil); opts.tls.ServerName != "electrum.example.com" {
+		t.Errorf("unexpected server name: %s", opts.tls.ServerName)
+	}
+	if _, err := parseAddress("udp://electrum.example.com:50001", nil); err != ErrUnsupportedScheme {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + wsGUID))
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		/* #nosec */
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(h[:]) + "\r\n\r\n")
+		rw.Flush()
+
+		ws := &wsConn{Conn: conn, r: rw.Reader}
+		lines := bufio.NewReader(ws)
+		for {
+			line, err := lines.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			req := &request{}
+			if err := json.Unmarshal(line, req); err != nil {
+				return
+			}
+			for _, res := range mockResult(req) {
+				if _, err := ws.Write([]byte(res)); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	defer srv.Close()
+
+	client, err := New(&Options{Address: strings.Replace(srv.URL, "http://", "ws://", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	info, err := client.ServerVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Software != "ElectrumX 1.8.5" {
+		t.Errorf("unexpected version info: %+v", info)
+	}
+}
+
+func TestWebSocketMessageSize(t *testing.T) {
+	half := make([]byte, maxMessageSize/2)
+	for _, frames := range [][]byte{
+		// Frames announcing an oversized payload are rejected before reading it
+		{0x81, 127, 0, 0, 1, 0, 0, 0, 0, 0},
+
+		// Fragmented messages are limited on their total size
+		append(append(append([]byte{0x01, 127, 0, 0, 0, 0, 0x01, 0, 0, 0}, half...),
+			0x80, 127, 0, 0, 0, 0, 0x01, 0, 0, 0x01), append(half, 0)...),
+	} {
+		server, conn := net.Pipe()
+		go func(b []byte) {
+			/* #nosec */
+			server.Write(b)
+		}(frames)
+		ws := &wsConn{Conn: conn, r: bufio.NewReader(conn)}
+		if _, err := ws.Read(make([]byte, 10)); err != ErrMessageTooLarge {
+			t.Errorf("unexpected error: %v", err)
+		}
+		server.Close()
+		conn.Close()
+	}
+}
+
+// Generate a self-signed certificate valid for the loopback address
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverCert, serverCA := selfSignedCert(t)
+	clientCert, clientCA := selfSignedCert(t)
+	clients := x509.NewCertPool()
+	clients.AddCert(clientCA)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clients,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					req := &request{}
+					if err := json.Unmarshal(line, req); err != nil {
+						return
+					}
+					for _, res := range mockResult(req) {
+						if _, err := conn.Write([]byte(res + "\n")); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA)
+	opts := &Options{
+		Address:           "ssl://" + ln.Addr().String(),
+		TLS:               &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"},
+		ClientCertificate: &clientCert,
+	}
+	client, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.ServerVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.TLS.Certificates) != 0 {
+		t.Error("provided TLS configuration was modified")
+	}
+
+	// Connections without the client certificate are dropped
+	anonymous, err := New(&Options{Address: opts.Address, TLS: opts.TLS})
+	if err != nil {
+		return
+	}
+	defer anonymous.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		dropped := false
+		for _, e := range anonymous.Events() {
+			dropped = dropped || e.State == Disconnected
+		}
+		if dropped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected connection without client certificate to fail")
+		}
+	}
+}
+
+var _ net.Conn = (*wsConn)(nil)
+
+func TestPendingRequestsOnDrop(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			// Drop the connection once a request is received, without answering it
+			go func() {
+				defer conn.Close()
+				bufio.NewReader(conn).ReadBytes('\n')
+			}()
+		}
+	}()
+
+	client, err := New(&Options{Address: ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	done := make(chan error)
+	go func() {
+		_, err := client.ServerBanner()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrConnClosed) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending request not released")
+	}
+}
+
+func TestStateListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				bufio.NewReader(conn).ReadBytes('\n')
+			}()
+		}
+	}()
+
+	client, err := NewClient(&Options{Address: ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.State() != Closed || client.IsConnected() {
+		t.Error("unexpected state before start")
+	}
+	states := make(chan ConnectionState, 10)
+	client.OnStateChange(func(s ConnectionState) {
+		if current := client.State(); current != s {
+			t.Errorf("unexpected current state: %s, notified %s", current, s)
+		}
+		states <- s
+	})
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !client.IsConnected() {
+		t.Error("expected client to be connected")
+	}
+	client.ServerPing()
+
+	var got []ConnectionState
+	for s := range states {
+		got = append(got, s)
+		if s == Reconnecting {
+			client.Close()
+		}
+		if s == Closed {
+			break
+		}
+	}
+	if client.State() != Closed || client.IsConnected() {
+		t.Error("unexpected state after close")
+	}
+	want := []ConnectionState{Ready, Disconnected, Reconnecting, Closed}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("unexpected states: %v", got)
+	}
+}
+
+func TestStateListenerCancel(t *testing.T) {
+	client, err := New(&Options{Address: newTestServer(t, bannerResult).Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var mu sync.Mutex
+	var kept, removed []ConnectionState
+	client.OnStateChange(func(s ConnectionState) {
+		mu.Lock()
+		defer mu.Unlock()
+		kept = append(kept, s)
+	})
+	cancel := client.OnStateChange(func(s ConnectionState) {
+		mu.Lock()
+		defer mu.Unlock()
+		removed = append(removed, s)
+	})
+	cancel()
+	cancel()
+
+	// The Closed state is reported on the goroutine calling Stop
+	client.Stop()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(kept) == 0 || kept[len(kept)-1] != Closed || len(removed) != 0 {
+		t.Errorf("unexpected states: %v, %v", kept, removed)
+	}
+}
+
+func TestReconnectOptions(t *testing.T) {
+	r := &ReconnectOptions{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	for attempt, d := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second} {
+		if got := r.delay(attempt); got != d {
+			t.Errorf("attempt %d: unexpected delay %s", attempt, got)
+		}
+	}
+	if d := (*ReconnectOptions)(nil).delay(3); d != defaultReconnectDelay {
+		t.Errorf("unexpected default delay: %s", d)
+	}
+	r.Jitter = time.Second
+	if d := r.delay(1); d < time.Second || d >= 2*time.Second {
+		t.Errorf("delay out of jitter window: %s", d)
+	}
+
+	// Connection enters the terminal state once attempts are exhausted
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	client, err := NewClient(&Options{
+		Address:   ln.Addr().String(),
+		Reconnect: &ReconnectOptions{InitialDelay: time.Millisecond, MaxAttempts: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := make(chan struct{})
+	client.OnStateChange(func(s ConnectionState) {
+		if s == Failed {
+			close(failed)
+		}
+	})
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ln.Close()
+	(<-accepted).Close()
+
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected failed state")
+	}
+	if client.State() != Failed || client.IsConnected() {
+		t.Errorf("unexpected state: %s", client.State())
+	}
+}
+
+func TestCustomDial(t *testing.T) {
+	server := newTestServer(t, bannerResult).Addr()
+	var dialed string
+	client, err := New(&Options{
+		Address: "electrum.example:50001",
+		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = addr
+			conn, err := new(net.Dialer).DialContext(ctx, network, server)
+			if err != nil {
+				return nil, err
+			}
+
+			// Hide the concrete connection type
+			return struct{ net.Conn }{conn}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if dialed != "electrum.example:50001" {
+		t.Errorf("unexpected dialed address: %s", dialed)
+	}
+	if _, err := client.ServerBanner(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSocketOptions(t *testing.T) {
+	server := newTestServer(t, bannerResult).Addr()
+
+	// Forward connections to the server, recording the client address
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	remote := make(chan net.Addr, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		remote <- conn.RemoteAddr()
+		upstream, err := net.Dial("tcp", server)
+		if err != nil {
+			return
+		}
+		defer upstream.Close()
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}()
+
+	client, err := New(&Options{
+		Address:      ln.Addr().String(),
+		LocalAddr:    "127.0.0.1",
+		TCPKeepAlive: time.Minute,
+		TCPDelay:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.ServerBanner(); err != nil {
+		t.Error(err)
+	}
+	if addr := (<-remote).(*net.TCPAddr); !addr.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("unexpected local address: %s", addr)
+	}
+
+	_, err = New(&Options{Address: ln.Addr().String(), LocalAddr: "invalid:address:0"})
+	if err == nil {
+		t.Error("invalid local address accepted")
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	// Server accepting connections without ever completing the TLS handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = New(&Options{Address: "ssl://" + ln.Addr().String(), ConnectTimeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = NewWithContext(ctx, &Options{Address: "ssl://" + ln.Addr().String()})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("connection setup not aborted")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	server := newTestServer(t, bannerResult).Addr()
+	path := filepath.Join(t.TempDir(), "electrum.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				upstream, err := net.Dial("tcp", server)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	client, err := New(&Options{Address: "unix://" + path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.ServerBanner(); err != nil {
+		t.Error(err)
+	}
+}
+
+// In-memory transport answering requests with the provided handler
+type mockTransport struct {
+	handler  func(req *request) []string
+	messages chan []byte
+	states   chan ConnectionState
+	done     chan struct{}
+}
+
+func newMockTransport(handler func(req *request) []string) *mockTransport {
+	return &mockTransport{
+		handler:  handler,
+		messages: make(chan []byte),
+		states:   make(chan ConnectionState),
+		done:     make(chan struct{}),
+	}
+}
+
+func (m *mockTransport) SendMessage(message []byte) error {
+	req := &request{}
+	if err := json.Unmarshal(message, req); err != nil {
+		return err
+	}
+	go func() {
+		for _, res := range m.handler(req) {
+			select {
+			case m.messages <- []byte(res + "\n"):
+			case <-m.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *mockTransport) Messages() <-chan []byte        { return m.messages }
+func (m *mockTransport) Errors() <-chan error           { return nil }
+func (m *mockTransport) States() <-chan ConnectionState { return m.states }
+func (m *mockTransport) Close() error                   { close(m.done); return nil }
+
+func TestCustomTransport(t *testing.T) {
+	var created int
+	var current *mockTransport
+	client, err := New(&Options{
+		Transport: func(ctx context.Context) (Transport, error) {
+			created++
+			current = newMockTransport(mockMethods(map[string]string{"server.banner": `"in-memory"`}))
+			return current, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if banner, err := client.ServerBanner(); err != nil || banner != "in-memory" {
+		t.Errorf("unexpected result: %s, %v", banner, err)
+	}
+	current.states <- Disconnected
+	for i := 0; client.IsConnected() && i < 100; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if client.State() != Disconnected {
+		t.Errorf("unexpected state: %s", client.State())
+	}
+	if err := client.Restart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if created != 2 {
+		t.Errorf("unexpected number of transports: %d", created)
+	}
+}
+
+// Tunnel dialing every connection to a fixed server
+type mockTunnel struct {
+	server string
+	addrs  []string
+}
+
+func (m *mockTunnel) Dial(network, addr string) (net.Conn, error) {
+	m.addrs = append(m.addrs, addr)
+	return net.Dial(network, m.server)
+}
+
+func TestDialTunnel(t *testing.T) {
+	tunnel := &mockTunnel{server: newTestServer(t, bannerResult).Addr()}
+	client, err := New(&Options{Address: "127.0.0.1:50001", Dial: DialTunnel(tunnel)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.ServerBanner(); err != nil {
+		t.Error(err)
+	}
+	if len(tunnel.addrs) != 1 || tunnel.addrs[0] != "127.0.0.1:50001" {
+		t.Errorf("unexpected tunnel connections: %v", tunnel.addrs)
+	}
+}
+
+// Start a local SSH server accepting any client, forwarding 'direct-tcpip' channels to
+// the provided server regardless of the destination requested; the destinations are
+// reported on the returned channel
+func mockSSHServer(t *testing.T, server string) (string, <-chan string) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &ssh.ServerConfig{NoClientAuth: true}
+	conf.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	dests := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				sc, chans, reqs, err := ssh.NewServerConn(conn, conf)
+				if err != nil {
+					return
+				}
+				defer sc.Close()
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					var dest struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					if nc.ChannelType() != "direct-tcpip" || ssh.Unmarshal(nc.ExtraData(), &dest) != nil {
+						nc.Reject(ssh.UnknownChannelType, "unsupported channel")
+						continue
+					}
+					dests <- net.JoinHostPort(dest.Host, strconv.Itoa(int(dest.Port)))
+					ch, creqs, err := nc.Accept()
+					if err != nil {
+						continue
+					}
+					go ssh.DiscardRequests(creqs)
+					go func() {
+						defer ch.Close()
+						upstream, err := net.Dial("tcp", server)
+						if err != nil {
+							return
+						}
+						defer upstream.Close()
+						go io.Copy(upstream, ch)
+						io.Copy(ch, upstream)
+					}()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), dests
+}
+
+func TestSSHTunnel(t *testing.T) {
+	jump, dests := mockSSHServer(t, newTestServer(t, bannerResult).Addr())
+	tunnel := NewSSHTunnel(jump, &ssh.ClientConfig{HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	defer tunnel.Close()
+
+	client, err := New(&Options{Address: "127.0.0.1:50001", Dial: tunnel.DialContext})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.ServerBanner(); err != nil {
+		t.Error(err)
+	}
+	if dest := <-dests; dest != "127.0.0.1:50001" {
+		t.Errorf("unexpected tunnel destination: %s", dest)
+	}
+
+	// The SSH connection is established again once lost
+	tunnel.mu.Lock()
+	/* #nosec */
+	tunnel.conn.Close()
+	tunnel.mu.Unlock()
+	conn, err := tunnel.DialContext(context.Background(), "tcp", "127.0.0.1:50002")
+	for i := 0; err != nil && i < 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+		conn, err = tunnel.DialContext(context.Background(), "tcp", "127.0.0.1:50002")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* #nosec */
+	conn.Close()
+
+	// No connections are established once closed
+	/* #nosec */
+	tunnel.Close()
+	if _, err := tunnel.DialContext(context.Background(), "tcp", "127.0.0.1:50001"); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// Start a local TLS server with the provided configuration, forwarding every
+// connection to a mock server
+func mockTLSServer(t *testing.T, conf *tls.Config) string {
+	server := newTestServer(t, bannerResult).Addr()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				upstream, err := net.Dial("tcp", server)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestTLSPin(t *testing.T) {
+	cert, leaf := selfSignedCert(t)
+	address := mockTLSServer(t, &tls.Config{Certificates: []tls.Certificate{cert}})
+	certPin := sha256.Sum256(leaf.Raw)
+	keyPin := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	for _, pin := range []string{hex.EncodeToString(certPin[:]), hex.EncodeToString(keyPin[:])} {
+		client, err := New(&Options{Address: "ssl://" + address, TLSPin: pin})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.ServerBanner(); err != nil {
+			t.Error(err)
+		}
+		client.Close()
+	}
+
+	wrong := sha256.Sum256([]byte("other"))
+	if _, err := New(&Options{Address: "ssl://" + address, TLSPin: hex.EncodeToString(wrong[:])}); !errors.Is(err, ErrCertMismatch) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Verification callbacks provided by the user run once the pin is matched, and are
+	// able to reject the connection
+	errRejected := errors.New("rejected")
+	verified := 0
+	conf := &tls.Config{VerifyConnection: func(cs tls.ConnectionState) error {
+		verified++
+		if verified > 1 {
+			return errRejected
+		}
+		return nil
+	}}
+	client, err := New(&Options{Address: "ssl://" + address, TLS: conf, TLSPin: hex.EncodeToString(certPin[:])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if verified != 1 {
+		t.Errorf("user callback invoked %d times", verified)
+	}
+	if _, err := New(&Options{Address: "ssl://" + address, TLS: conf, TLSPin: hex.EncodeToString(certPin[:])}); !errors.Is(err, errRejected) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := New(&Options{Address: "ssl://" + address, TLS: conf, TLSPin: hex.EncodeToString(wrong[:])}); !errors.Is(err, ErrCertMismatch) || verified != 2 {
+		t.Errorf("unexpected error: %v, %d", err, verified)
+	}
+	if _, err := New(&Options{Address: "ssl://" + address, TLSPin: "invalid"}); err != ErrInvalidPin {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTrustStore(t *testing.T) {
+	cert, _ := selfSignedCert(t)
+	address := "ssl://" + mockTLSServer(t, &tls.Config{Certificates: []tls.Certificate{cert}})
+	store := NewMemoryStore()
+	for i := 0; i < 2; i++ {
+		client, err := New(&Options{Address: address, TrustStore: store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+	}
+	if keys, _ := store.Keys(trustPrefix); len(keys) != 1 {
+		t.Errorf("unexpected recorded certificates: %v", keys)
+	}
+
+	// Server presenting a different certificate
+	other, _ := selfSignedCert(t)
+	address = "ssl://" + mockTLSServer(t, &tls.Config{Certificates: []tls.Certificate{other}})
+	key := trustPrefix + strings.TrimPrefix(address, "ssl://")
+	store.Put(key, []byte(strings.Repeat("00", 32)))
+	if _, err := New(&Options{Address: address, TrustStore: store}); !errors.Is(err, ErrCertChanged) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReadIdleTimeout(t *testing.T) {
+	// Server accepting connections without ever sending any data
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client, err := NewClient(&Options{Address: ln.Addr().String(), ReadIdleTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped := make(chan struct{}, 1)
+	client.OnStateChange(func(s ConnectionState) {
+		if s == Disconnected {
+			select {
+			case dropped <- struct{}{}:
+			default:
+			}
+		}
+	})
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	select {
+	case <-dropped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection not detected")
+	}
+	found := false
+	for i := 0; !found && i < 100; i++ {
+		for _, e := range client.Events() {
+			found = found || errors.Is(e.Err, ErrIdleTimeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !found {
+		t.Errorf("idle timeout not reported: %v", client.Events())
+	}
+}
+
+func TestKeepAliveFailures(t *testing.T) {
+	// Server never answering keep-alive operations
+	srv := newTestServer(t, nil)
+	unanswered := make(chan struct{})
+	t.Cleanup(func() { close(unanswered) })
+	srv.HandleFunc("server.ping", func([]json.RawMessage) (interface{}, error) {
+		<-unanswered
+		return nil, nil
+	})
+	client, err := NewClient(&Options{
+		Address:           srv.Addr(),
+		KeepAlive:         true,
+		KeepAliveInterval: 20 * time.Millisecond,
+		KeepAliveFailures: 2,
+		RequestTimeout:    10 * time.Millisecond,
+		Reconnect:         &ReconnectOptions{InitialDelay: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(chan ConnectionState, 10)
+	client.OnStateChange(func(s ConnectionState) {
+		select {
+		case states <- s:
+		default:
+		}
+	})
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	timeout := time.After(5 * time.Second)
+	expected := []ConnectionState{Disconnected, Reconnecting, Reconnected}
+	for len(expected) > 0 {
+		select {
+		case s := <-states:
+			if s == Ready {
+				continue
+			}
+			if s != expected[0] {
+				t.Fatalf("unexpected state: %v", s)
+			}
+			expected = expected[1:]
+		case <-timeout:
+			t.Fatalf("dead connection not recovered, waiting for state: %v", expected[0])
+		}
+	}
+	found := false
+	for i := 0; !found && i < 100; i++ {
+		for _, e := range client.Events() {
+			found = found || errors.Is(e.Err, ErrKeepAliveFailed)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !found {
+		t.Errorf("keep-alive failure not reported: %v", client.Events())
+	}
+}
+
+func TestKeepAliveBusyClient(t *testing.T) {
+	var pings atomic.Int32
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("server.ping", func([]json.RawMessage) (interface{}, error) {
+		pings.Add(1)
+		return nil, nil
+	})
+	var mu sync.Mutex
+	var calls []string
+	client, err := New(&Options{
+		Address:           srv.Addr(),
+		Protocol:          Protocol12,
+		KeepAlive:         true,
+		KeepAliveInterval: 5 * time.Millisecond,
+		KeepAliveFailures: 1,
+		MaxInflight:       1,
+		FailWhenBusy:      true,
+		OnCall: func(info *CallInfo) {
+			mu.Lock()
+			calls = append(calls, info.Method)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Keep-alive operations don't need a free slot and are not reported as calls
+	client.inflight <- struct{}{}
+	for i := 0; pings.Load() < 5 && i < 1000; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	<-client.inflight
+	if pings.Load() < 5 {
+		t.Fatalf("keep-alive operations not sent: %d", pings.Load())
+	}
+	for _, e := range client.Events() {
+		if errors.Is(e.Err, ErrKeepAliveFailed) {
+			t.Errorf("busy connection dropped: %v", e)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, method := range calls {
+		if method == "server.ping" {
+			t.Errorf("keep-alive operation reported: %v", calls)
+			break
+		}
+	}
+}
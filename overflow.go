@@ -0,0 +1,70 @@
+package electrum
+
+// OverflowPolicy determines what happens when a notification can't be delivered because
+// the subscription's channel is full, i.e. the consumer is not keeping up
+type OverflowPolicy int
+
+// Overflow policies
+const (
+	// OverflowBlock waits for the consumer to receive the notification; as notifications
+	// are delivered in order, a slow consumer holds back the processing of incoming messages
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest discards the oldest notification on the channel to make room
+	// for the new one
+	OverflowDropOldest
+
+	// OverflowDropNewest discards the new notification
+	OverflowDropNewest
+
+	// OverflowClose terminates the subscription with ErrSlowConsumer
+	OverflowClose
+)
+
+// Deliver a value to the consumer of a subscription according to the client's overflow
+// policy; must only be called from the subscription's processing loop, its single sender
+func emit[T any](c *Client, sub *subscription, ch chan T, v T) {
+	if c.overflow == OverflowBlock {
+		select {
+		case ch <- v:
+		case <-sub.ctx.Done():
+		}
+		return
+	}
+
+	select {
+	case ch <- v:
+		return
+	default:
+	}
+	switch c.overflow {
+	case OverflowDropOldest:
+		if cap(ch) == 0 {
+			c.dropped(sub)
+			return
+		}
+		for {
+			select {
+			case <-ch:
+				c.dropped(sub)
+			default:
+			}
+			select {
+			case ch <- v:
+				return
+			default:
+			}
+		}
+	case OverflowClose:
+		c.dropped(sub)
+		sub.cancel(ErrSlowConsumer)
+	default:
+		c.dropped(sub)
+	}
+}
+
+// Count a notification discarded due to a slow consumer
+func (c *Client) dropped(sub *subscription) {
+	sub.dropped.Add(1)
+	c.stats.dropped.Add(1)
+}
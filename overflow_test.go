@@ -0,0 +1,74 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+func TestOverflowPolicy(t *testing.T) {
+	cases := []struct {
+		policy   OverflowPolicy
+		received []string
+		dropped  uint64
+		err      error
+	}{
+		{OverflowDropNewest, []string{"status-0"}, 3, nil},
+		{OverflowDropOldest, []string{"status-3"}, 3, nil},
+		{OverflowClose, []string{"status-0"}, 1, ErrSlowConsumer},
+	}
+	for _, c := range cases {
+		srv := electrumtest.NewServer()
+		srv.Handle("blockchain.scripthash.subscribe", "status-0")
+		client, err := New(&Options{
+			Address:            srv.Addr(),
+			SubscriptionBuffer: 1,
+			OverflowPolicy:     c.policy,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		statuses, sub, err := client.NotifyScriptHash(context.Background(), "scripthash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; sub.Messages() == 0 && i < 1000; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		for i := 1; i <= 3; i++ {
+			/* #nosec */
+			srv.Notify("blockchain.scripthash.subscribe", "scripthash", fmt.Sprintf("status-%d", i))
+		}
+		for i := 0; sub.Dropped() < c.dropped && i < 1000; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		if c.err != nil {
+			<-sub.Done()
+		}
+
+		var received []string
+		if c.err == nil {
+			received = append(received, (<-statuses).Status)
+		} else {
+			for s := range statuses {
+				received = append(received, s.Status)
+			}
+		}
+		if fmt.Sprint(received) != fmt.Sprint(c.received) || sub.Dropped() != c.dropped {
+			t.Errorf("unexpected result for policy %d: %v, %d dropped", c.policy, received, sub.Dropped())
+		}
+		if !errors.Is(sub.Err(), c.err) {
+			t.Errorf("unexpected error for policy %d: %v", c.policy, sub.Err())
+		}
+		if stats := client.Stats(); stats.NotificationsDropped != c.dropped {
+			t.Errorf("unexpected stats for policy %d: %d", c.policy, stats.NotificationsDropped)
+		}
+		client.Close()
+		srv.Close()
+	}
+}
@@ -0,0 +1,132 @@
+package electrum
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default ports used by peers announcing a connection type without an explicit port
+const (
+	defaultTCPPort = 50001
+	defaultSSLPort = 50002
+)
+
+// ErrNoPeerPorts is returned when a peer doesn't announce any supported connection type
+var ErrNoPeerPorts = errors.New("NO_PEER_PORTS")
+
+// ParseFeatures returns the parsed values of the peer's feature flags; unknown
+// or malformed flags are ignored
+func (p *Peer) ParseFeatures() *PeerFeatures {
+	pf := &PeerFeatures{}
+	for _, f := range p.Features {
+		if f == "" {
+			continue
+		}
+		val := f[1:]
+		switch f[0] {
+		case 'v':
+			pf.Version = val
+		case 's':
+			pf.SSLPort = parsePort(val, defaultSSLPort)
+		case 't':
+			pf.TCPPort = parsePort(val, defaultTCPPort)
+		case 'p':
+			if n, err := strconv.ParseUint(val, 10, 64); err == nil {
+				pf.Pruning = n
+			}
+		}
+	}
+	return pf
+}
+
+// Options returns the configuration required to connect to the peer, preferring
+// TLS connections when available; the peer's host name is used for certificate
+// verification, a custom TLS configuration must be set on the returned options
+// to connect to servers using self-signed certificates
+func (p *Peer) Options() (*Options, error) {
+	host := p.Name
+	if host == "" {
+		host = p.Address
+	}
+	pf := p.ParseFeatures()
+	switch {
+	case pf.SSLPort != 0:
+		return &Options{Address: fmt.Sprintf("ssl://%s", net.JoinHostPort(host, strconv.Itoa(int(pf.SSLPort))))}, nil
+	case pf.TCPPort != 0:
+		return &Options{Address: fmt.Sprintf("tcp://%s", net.JoinHostPort(host, strconv.Itoa(int(pf.TCPPort))))}, nil
+	default:
+		return nil, ErrNoPeerPorts
+	}
+}
+
+// Parse a port value from a feature flag, using the default value when omitted
+func parsePort(val string, def uint) uint {
+	if strings.TrimSpace(val) == "" {
+		return def
+	}
+	n, err := strconv.ParseUint(val, 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint(n)
+}
+
+// Entry on the servers list distributed with the Electrum wallet
+type serverListEntry struct {
+	Pruning string `json:"pruning"`
+	SSL     string `json:"s"`
+	TCP     string `json:"t"`
+	Version string `json:"version"`
+}
+
+// LoadServers parses a server list in the 'servers.json' format distributed with
+// the Electrum wallet, i.e. a map of host names to their ports and version, returning
+// the entries as peers sorted by name
+//
+// https://github.com/spesmilo/electrum/blob/master/electrum/servers.json
+func LoadServers(r io.Reader) ([]*Peer, error) {
+	list := make(map[string]*serverListEntry)
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var peers []*Peer
+	for host, e := range list {
+		p := &Peer{Address: host, Name: host}
+		if e.Version != "" {
+			p.Features = append(p.Features, "v"+e.Version)
+		}
+		if e.SSL != "" {
+			p.Features = append(p.Features, "s"+e.SSL)
+		}
+		if e.TCP != "" {
+			p.Features = append(p.Features, "t"+e.TCP)
+		}
+		if e.Pruning != "" && e.Pruning != "-" {
+			p.Features = append(p.Features, "p"+e.Pruning)
+		}
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Name < peers[j].Name
+	})
+	return peers, nil
+}
+
+// LoadServersFile parses a server list file in the Electrum wallet 'servers.json' format
+func LoadServersFile(path string) ([]*Peer, error) {
+	/* #nosec */
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadServers(f)
+}
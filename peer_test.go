@@ -0,0 +1,52 @@
+package electrum
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPeerOptions(t *testing.T) {
+	p := &Peer{Address: "83.212.111.114", Name: "electrum.example.com", Features: []string{"v1.4", "s", "t50011", "p10000"}}
+	pf := p.ParseFeatures()
+	if pf.Version != "1.4" || pf.SSLPort != defaultSSLPort || pf.TCPPort != 50011 || pf.Pruning != 10000 {
+		t.Errorf("unexpected features: %+v", pf)
+	}
+	opts, err := p.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Address != "ssl://electrum.example.com:50002" {
+		t.Errorf("unexpected address: %s", opts.Address)
+	}
+
+	p = &Peer{Address: "83.212.111.114", Features: []string{"v1.4", "t"}}
+	if opts, _ := p.Options(); opts.Address != "tcp://83.212.111.114:50001" {
+		t.Errorf("unexpected address: %s", opts.Address)
+	}
+
+	p = &Peer{Address: "83.212.111.114", Features: []string{"v1.4"}}
+	if _, err := p.Options(); err != ErrNoPeerPorts {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadServers(t *testing.T) {
+	list := `{
+		"electrum.example.com": {"pruning": "-", "s": "50002", "t": "50001", "version": "1.4"},
+		"another.example.org": {"pruning": "-", "s": "50012", "version": "1.4.2"}
+	}`
+	peers, err := LoadServers(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0].Name != "another.example.org" {
+		t.Fatalf("unexpected peers: %+v", peers)
+	}
+	pf := peers[0].ParseFeatures()
+	if pf.Version != "1.4.2" || pf.SSLPort != 50012 || pf.TCPPort != 0 {
+		t.Errorf("unexpected features: %+v", pf)
+	}
+	if opts, _ := peers[1].Options(); opts.Address != "ssl://electrum.example.com:50002" {
+		t.Errorf("unexpected address: %s", opts.Address)
+	}
+}
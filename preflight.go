@@ -0,0 +1,163 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Preflight validation errors
+var (
+	ErrTxTooLarge      = errors.New("TRANSACTION_TOO_LARGE")
+	ErrDustOutput      = errors.New("DUST_OUTPUT")
+	ErrInsufficientFee = errors.New("INSUFFICIENT_FEE")
+)
+
+// Default preflight validation limits, matching the standardness rules of Bitcoin Core
+const (
+	defaultMaxTxSize = 100000
+
+	// Dust relay fee in satoshis per virtual byte
+	dustRelayFee = 3
+)
+
+// PreflightOptions define the local validation performed on transactions before
+// submitting them to the server
+type PreflightOptions struct {
+	// Max virtual size of a transaction in bytes, defaults to 100000
+	MaxSize int
+
+	// Min value of any transaction output; by default each output is checked against the
+	// dust threshold of its script type, as calculated by Bitcoin Core, e.g. 546 satoshis
+	// for P2PKH, 294 for P2WPKH and 330 for P2WSH and taproot outputs
+	DustLimit Amount
+
+	// If set to true, the fee paid by the transaction is calculated, retrieving its
+	// inputs from the server, and checked against the server's relay fee
+	CheckFee bool
+}
+
+// PreflightError is returned when a transaction fails local validation before being
+// broadcast; errors.Is will match it with the specific validation error and
+// ErrRejectedTx
+type PreflightError struct {
+	// Validation error
+	Err error
+
+	// Details about the validation failure
+	Detail string
+}
+
+// Error returns the validation error, including the failure details
+func (e *PreflightError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("preflight: %s", e.Err)
+	}
+	return fmt.Sprintf("preflight: %s: %s", e.Err, e.Detail)
+}
+
+// Unwrap returns the validation error
+func (e *PreflightError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrRejectedTx
+func (e *PreflightError) Is(target error) bool {
+	return target == ErrRejectedTx
+}
+
+// Validate a hex-encoded transaction according to the preflight options
+func (c *Client) validateTx(ctx context.Context, txHex string) error {
+	opts := c.preflight
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxTxSize
+	}
+	tx, err := parseTx(txHex)
+	if err != nil {
+		return &PreflightError{Err: err}
+	}
+	if tx.vsize > maxSize {
+		return &PreflightError{Err: ErrTxTooLarge, Detail: fmt.Sprintf("%d bytes, max %d", tx.vsize, maxSize)}
+	}
+
+	var out Amount
+	for i, o := range tx.outputs {
+		dust := opts.DustLimit
+		if dust <= 0 {
+			dust = dustThreshold(o.script)
+		}
+
+		// Provably unspendable, i.e. OP_RETURN, outputs are exempt
+		if o.value < dust && !(len(o.script) > 0 && o.script[0] == 0x6a) {
+			return &PreflightError{Err: ErrDustOutput, Detail: fmt.Sprintf("output %d value %s, min %s", i, o.value, dust)}
+		}
+		out += o.value
+	}
+	if !opts.CheckFee {
+		return nil
+	}
+
+	var in Amount
+	for _, prev := range tx.inputs {
+		raw, err := c.GetTransactionContext(ctx, prev.Hash)
+		if err != nil {
+			return err
+		}
+		ptx, err := parseTx(raw)
+		if err != nil {
+			return err
+		}
+		if int(prev.Index) >= len(ptx.outputs) {
+			return &PreflightError{Err: ErrInvalidTx, Detail: fmt.Sprintf("unknown output %s:%d", prev.Hash, prev.Index)}
+		}
+		in += ptx.outputs[prev.Index].value
+	}
+	relayFee, err := c.RelayFeeContext(ctx)
+	if err != nil {
+		return err
+	}
+	fee := in - out
+	if min := relayFee * Amount(tx.vsize) / 1000; fee < min {
+		return &PreflightError{Err: ErrInsufficientFee, Detail: fmt.Sprintf("fee %s, min %s", fee, min)}
+	}
+	return nil
+}
+
+// Dust threshold of an output, following Bitcoin Core: the fee required to relay the
+// output and the input eventually spending it at the dust relay fee; spending witness
+// programs is cheaper, as the witness data is discounted
+func dustThreshold(script []byte) Amount {
+	size := 8 + varIntSize(len(script)) + len(script)
+	if isWitnessProgram(script) {
+		size += 32 + 4 + 1 + 107/4 + 4
+	} else {
+		size += 32 + 4 + 1 + 107 + 4
+	}
+	return Amount(size * dustRelayFee)
+}
+
+// Check if an output script is a segwit witness program, i.e. a version opcode followed
+// by a single push of 2 to 40 bytes
+func isWitnessProgram(script []byte) bool {
+	if len(script) < 4 || len(script) > 42 {
+		return false
+	}
+	if script[0] != 0x00 && (script[0] < 0x51 || script[0] > 0x60) {
+		return false
+	}
+	return int(script[1])+2 == len(script)
+}
+
+// Size of the variable length integer encoding of a value
+func varIntSize(n int) int {
+	switch {
+	case n < 0xfd:
+		return 1
+	case n <= 0xffff:
+		return 3
+	case n <= 0xffffffff:
+		return 5
+	}
+	return 9
+}
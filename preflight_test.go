@@ -0,0 +1,85 @@
+package electrum
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	prevHash := strings.Repeat("22", 32)
+	prev := mockTx(strings.Repeat("11", 32), 0, 10000)
+	srv := newTestServer(t, map[string]string{"blockchain.relayfee": `0.00001`})
+	srv.Handle("blockchain.transaction.get", prev)
+	srv.HandleFunc("blockchain.transaction.broadcast", func(params []json.RawMessage) (interface{}, error) {
+		var tx string
+		if err := json.Unmarshal(params[0], &tx); err != nil {
+			return nil, err
+		}
+		return TxID(tx)
+	})
+	client, err := New(&Options{
+		Address:   srv.Addr(),
+		Preflight: &PreflightOptions{CheckFee: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	cases := []struct {
+		tx  string
+		err error
+	}{
+		{"zz", ErrInvalidTx},
+		{mockTx(prevHash, 0, 100), ErrDustOutput},
+		{mockTx(prevHash, 1, 9000), ErrInvalidTx},
+		{mockTx(prevHash, 0, 9990), ErrInsufficientFee},
+	}
+	for _, c := range cases {
+		_, err := client.BroadcastTransaction(c.tx)
+		var pe *PreflightError
+		if !errors.As(err, &pe) || !errors.Is(err, c.err) || !errors.Is(err, ErrRejectedTx) {
+			t.Errorf("%s: unexpected error: %v", c.tx, err)
+		}
+	}
+	if _, err := client.BroadcastTransaction(mockTx(prevHash, 0, 9000)); err != nil {
+		t.Error(err)
+	}
+	broadcasts := 0
+	for _, req := range srv.Requests() {
+		if req.Method == "blockchain.transaction.broadcast" {
+			broadcasts++
+		}
+	}
+	if broadcasts != 1 {
+		t.Errorf("expected a single broadcast, got %d", broadcasts)
+	}
+
+	client.preflight = &PreflightOptions{MaxSize: 50}
+	if _, err := client.BroadcastTransaction(mockTx(prevHash, 0, 9000)); !errors.Is(err, ErrTxTooLarge) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDustThreshold(t *testing.T) {
+	hash20, hash32 := strings.Repeat("ab", 20), strings.Repeat("ab", 32)
+	cases := []struct {
+		script string
+		dust   Amount
+	}{
+		{"76a914" + hash20 + "88ac", 546}, // P2PKH
+		{"a914" + hash20 + "87", 540},     // P2SH
+		{"0014" + hash20, 294},            // P2WPKH
+		{"0020" + hash32, 330},            // P2WSH
+		{"5120" + hash32, 330},            // P2TR
+	}
+	for _, c := range cases {
+		script, _ := hex.DecodeString(c.script)
+		if dust := dustThreshold(script); dust != c.dust {
+			t.Errorf("%s: unexpected threshold %d, expected %d", c.script, dust, c.dust)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package electrum
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidProtocolVersion is returned when a protocol version string can't be parsed
+var ErrInvalidProtocolVersion = errors.New("INVALID_PROTOCOL_VERSION")
+
+// ProtocolVersion is a parsed protocol version, e.g. "1.4.2"; missing components
+// are considered zero
+type ProtocolVersion [3]int
+
+// ParseProtocolVersion decodes a protocol version string of the form "major.minor[.patch]"
+func ParseProtocolVersion(s string) (ProtocolVersion, error) {
+	var v ProtocolVersion
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) < 2 || len(parts) > len(v) {
+		return v, ErrInvalidProtocolVersion
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, ErrInvalidProtocolVersion
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if the version is lower, equal or greater than the other one
+func (v ProtocolVersion) Compare(other ProtocolVersion) int {
+	for i := range v {
+		switch {
+		case v[i] < other[i]:
+			return -1
+		case v[i] > other[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// AtLeast reports whether the version is equal or greater than the other one
+func (v ProtocolVersion) AtLeast(other ProtocolVersion) bool {
+	return v.Compare(other) >= 0
+}
+
+// String returns the version in its canonical form, omitting a zero patch component
+func (v ProtocolVersion) String() string {
+	s := strconv.Itoa(v[0]) + "." + strconv.Itoa(v[1])
+	if v[2] != 0 {
+		s += "." + strconv.Itoa(v[2])
+	}
+	return s
+}
+
+// Protocol range a method is available on; methods removed from the protocol
+// set the version where that happened
+type methodRange struct {
+	since   ProtocolVersion
+	removed ProtocolVersion
+}
+
+// Capability table mapping protocol methods to the versions supporting them; methods
+// not listed are considered available on all versions
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-changes.html
+var capabilities = map[string]methodRange{
+	"server.features":                    {since: ProtocolVersion{1, 1}},
+	"server.add_peer":                    {since: ProtocolVersion{1, 1}},
+	"server.ping":                        {since: ProtocolVersion{1, 2}},
+	"blockchain.address.get_balance":     {removed: ProtocolVersion{1, 3}},
+	"blockchain.address.get_history":     {removed: ProtocolVersion{1, 3}},
+	"blockchain.address.get_mempool":     {removed: ProtocolVersion{1, 3}},
+	"blockchain.address.listunspent":     {removed: ProtocolVersion{1, 3}},
+	"blockchain.address.subscribe":       {removed: ProtocolVersion{1, 3}},
+	"blockchain.scripthash.get_balance":  {since: ProtocolVersion{1, 1}},
+	"blockchain.scripthash.get_history":  {since: ProtocolVersion{1, 1}},
+	"blockchain.scripthash.get_mempool":  {since: ProtocolVersion{1, 1}},
+	"blockchain.scripthash.listunspent":  {since: ProtocolVersion{1, 1}},
+	"blockchain.scripthash.subscribe":    {since: ProtocolVersion{1, 1}},
+	"blockchain.scripthash.unsubscribe":  {since: ProtocolVersion{1, 4, 2}},
+	"blockchain.block.get_header":        {removed: ProtocolVersion{1, 4}},
+	"blockchain.block.get_chunk":         {removed: ProtocolVersion{1, 4}},
+	"blockchain.block.header":            {since: ProtocolVersion{1, 3}},
+	"blockchain.block.headers":           {since: ProtocolVersion{1, 2}},
+	"blockchain.transaction.id_from_pos": {since: ProtocolVersion{1, 4}},
+	"mempool.get_fee_histogram":          {since: ProtocolVersion{1, 2}},
+}
+
+// Check if a method is supported by a protocol version, returning ErrUnavailableMethod
+// for methods introduced on later versions and ErrDeprecatedMethod for removed ones;
+// unknown versions are not checked
+func methodSupported(method, protocol string) error {
+	r, ok := capabilities[method]
+	if !ok {
+		return nil
+	}
+	v, err := ParseProtocolVersion(protocol)
+	if err != nil {
+		return nil
+	}
+	if !v.AtLeast(r.since) {
+		return ErrUnavailableMethod
+	}
+	if r.removed != (ProtocolVersion{}) && v.AtLeast(r.removed) {
+		return ErrDeprecatedMethod
+	}
+	return nil
+}
+
+// Check if a method is supported by the protocol version in use
+func (c *Client) supports(method string) error {
+	return methodSupported(method, c.protocol())
+}
+
+// Protocol version introducing checkpoint proofs on header requests
+var checkpointProtocol = ProtocolVersion{1, 4}
+
+// Check if single headers are requested using 'blockchain.block.header', available
+// since protocol 1.3; unknown versions use 'blockchain.block.get_header'
+func (c *Client) usesHeaderMethod() bool {
+	v, err := ParseProtocolVersion(c.protocol())
+	return err == nil && v.AtLeast(capabilities["blockchain.block.header"].since)
+}
+
+// Check if the protocol version in use supports checkpoint proofs on header requests,
+// returning ErrUnavailableMethod otherwise; unknown versions are not checked
+func (c *Client) supportsCheckpoints() error {
+	v, err := ParseProtocolVersion(c.protocol())
+	if err != nil || v.AtLeast(checkpointProtocol) {
+		return nil
+	}
+	return ErrUnavailableMethod
+}
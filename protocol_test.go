@@ -0,0 +1,60 @@
+package electrum
+
+import "testing"
+
+func TestParseProtocolVersion(t *testing.T) {
+	cases := []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1.4.2", "1.4", 1},
+		{"1.4", "1.4.0", 0},
+		{"1.10", "1.9", 1},
+		{"1.2", "1.4", -1},
+		{"2.0", "1.99.99", 1},
+	}
+	for _, c := range cases {
+		a, err := ParseProtocolVersion(c.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseProtocolVersion(c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := a.Compare(b); r != c.cmp {
+			t.Errorf("%s vs %s: expected %d, got %d", c.a, c.b, c.cmp, r)
+		}
+	}
+	for _, invalid := range []string{"", "1", "1.x", "1.2.3.4", "-1.2"} {
+		if _, err := ParseProtocolVersion(invalid); err != ErrInvalidProtocolVersion {
+			t.Errorf("%q: unexpected error %v", invalid, err)
+		}
+	}
+	if v, _ := ParseProtocolVersion("1.4.0"); v.String() != "1.4" {
+		t.Errorf("unexpected string: %s", v)
+	}
+}
+
+func TestMethodSupported(t *testing.T) {
+	cases := []struct {
+		method   string
+		protocol string
+		err      error
+	}{
+		{"server.version", Protocol10, nil},
+		{"server.ping", Protocol11, ErrUnavailableMethod},
+		{"server.ping", "1.4.2", nil},
+		{"blockchain.address.get_balance", Protocol12, nil},
+		{"blockchain.address.get_balance", Protocol13, ErrDeprecatedMethod},
+		{"blockchain.scripthash.unsubscribe", Protocol14, ErrUnavailableMethod},
+		{"blockchain.scripthash.unsubscribe", "1.4.2", nil},
+		{"blockchain.block.get_header", Protocol14, ErrDeprecatedMethod},
+		{"blockchain.block.headers", "unknown", nil},
+	}
+	for _, c := range cases {
+		if err := methodSupported(c.method, c.protocol); err != c.err {
+			t.Errorf("%s on %s: unexpected error %v", c.method, c.protocol, err)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package electrum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Entry of a recording; either a request with the result or error produced by the
+// server, or a notification received after the preceding request
+type recordedMessage struct {
+	Method       string          `json:"method,omitempty"`
+	Params       json.RawMessage `json:"params,omitempty"`
+	Result       json.RawMessage `json:"result,omitempty"`
+	Error        json.RawMessage `json:"error,omitempty"`
+	Notification json.RawMessage `json:"notification,omitempty"`
+}
+
+// Generic protocol message, used to inspect the traffic regardless of its direction
+type wireMessage struct {
+	ID     *int            `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// Decode a single message or the items of a batch, keeping the raw encoding of each
+func decodeWireMessages(m []byte) ([]json.RawMessage, []*wireMessage, error) {
+	var raw []json.RawMessage
+	if isBatch(m) {
+		if err := json.Unmarshal(m, &raw); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		raw = []json.RawMessage{bytes.TrimSpace(m)}
+	}
+	msgs := make([]*wireMessage, len(raw))
+	for i, r := range raw {
+		msgs[i] = &wireMessage{}
+		if err := json.Unmarshal(r, msgs[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return raw, msgs, nil
+}
+
+// RecordTransport returns a function, suitable for the 'Transport' option, wrapping the
+// transports created by next to record every exchange with the server on w, one JSON
+// document per line; the recording can be replayed later with ReplayTransport, e.g.
+//
+//	f, _ := os.Create("testdata/session.jsonl")
+//	client, _ := electrum.New(&electrum.Options{
+//		Transport: electrum.RecordTransport(f, electrum.DefaultTransport(&electrum.Options{
+//			Address: "electrum.example.com:50002",
+//			TLS:     &tls.Config{},
+//		})),
+//	})
+//
+// Writing to w is synchronized across all the created transports; write failures are
+// reported on the transport's Errors channel
+func RecordTransport(w io.Writer, next func(ctx context.Context) (Transport, error)) func(ctx context.Context) (Transport, error) {
+	mu := &sync.Mutex{}
+	return func(ctx context.Context) (Transport, error) {
+		t, err := next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r := &recorder{
+			Transport: t,
+			w:         w,
+			wmu:       mu,
+			pending:   make(map[int]*recordedMessage),
+			messages:  make(chan []byte),
+			errors:    make(chan error),
+			done:      make(chan struct{}),
+		}
+		go r.listen()
+		return r, nil
+	}
+}
+
+// Transport recording the traffic of an underlying one
+type recorder struct {
+	Transport
+	w        io.Writer
+	wmu      *sync.Mutex
+	pending  map[int]*recordedMessage
+	messages chan []byte
+	errors   chan error
+	done     chan struct{}
+	once     sync.Once
+	sync.Mutex
+}
+
+// SendMessage registers the outbound requests and forwards the message
+func (r *recorder) SendMessage(message []byte) error {
+	if _, msgs, err := decodeWireMessages(message); err == nil {
+		r.Lock()
+		for _, m := range msgs {
+			if m.ID != nil {
+				r.pending[*m.ID] = &recordedMessage{Method: m.Method, Params: m.Params}
+			}
+		}
+		r.Unlock()
+	}
+	return r.Transport.SendMessage(message)
+}
+
+// Messages returns the channel used to deliver the messages received from the server
+func (r *recorder) Messages() <-chan []byte {
+	return r.messages
+}
+
+// Errors returns the channel used to report errors of the underlying transport,
+// and failures to write the recording
+func (r *recorder) Errors() <-chan error {
+	return r.errors
+}
+
+// Close terminates the underlying transport
+func (r *recorder) Close() error {
+	r.once.Do(func() { close(r.done) })
+	return r.Transport.Close()
+}
+
+// Record and forward inbound traffic until closed
+func (r *recorder) listen() {
+	for {
+		select {
+		case m := <-r.Transport.Messages():
+			r.emitError(r.record(m))
+			select {
+			case r.messages <- m:
+			case <-r.done:
+				return
+			}
+		case err := <-r.Transport.Errors():
+			r.emitError(err)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Report a non-nil error, unless closed
+func (r *recorder) emitError(err error) {
+	if err == nil {
+		return
+	}
+	select {
+	case r.errors <- err:
+	case <-r.done:
+	}
+}
+
+// Write the entries produced by an inbound message
+func (r *recorder) record(m []byte) error {
+	raw, msgs, err := decodeWireMessages(m)
+	if err != nil {
+		return nil
+	}
+	var entries []*recordedMessage
+	r.Lock()
+	for i, msg := range msgs {
+		if msg.ID == nil {
+			if msg.Method != "" {
+				entries = append(entries, &recordedMessage{Notification: raw[i]})
+			}
+			continue
+		}
+		if entry, ok := r.pending[*msg.ID]; ok {
+			delete(r.pending, *msg.ID)
+			entry.Result, entry.Error = msg.Result, msg.Error
+			if string(entry.Error) == "null" {
+				entry.Error = nil
+			}
+			entries = append(entries, entry)
+		}
+	}
+	r.Unlock()
+
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	for _, entry := range entries {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err := r.w.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recorded request, along with the notifications received after its response
+type replayExchange struct {
+	*recordedMessage
+	notifications []json.RawMessage
+}
+
+// ReplayTransport reads a recording produced by RecordTransport and returns a function,
+// suitable for the 'Transport' option, creating transports that answer requests with the
+// recorded results without any network activity, e.g. to run hermetic tests.
+//
+// Requests are matched by method and parameters; repeated requests receive the recorded
+// responses in order, the last one being reused once exhausted. Every transport replays
+// the recording from the start, and requests not found on it fail with an RPC error
+func ReplayTransport(r io.Reader) (func(ctx context.Context) (Transport, error), error) {
+	var exchanges []*replayExchange
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			entry := &recordedMessage{}
+			if err := json.Unmarshal(line, entry); err != nil {
+				return nil, err
+			}
+			switch {
+			case entry.Notification == nil:
+				exchanges = append(exchanges, &replayExchange{recordedMessage: entry})
+			case len(exchanges) > 0:
+				last := exchanges[len(exchanges)-1]
+				last.notifications = append(last.notifications, entry.Notification)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return func(ctx context.Context) (Transport, error) {
+		t := &replayer{
+			exchanges: exchanges,
+			used:      make([]bool, len(exchanges)),
+			messages:  make(chan []byte),
+			wake:      make(chan struct{}, 1),
+			done:      make(chan struct{}),
+		}
+		go t.deliver()
+		return t, nil
+	}, nil
+}
+
+// Transport answering requests from a recording
+type replayer struct {
+	exchanges []*replayExchange
+	used      []bool
+	queue     [][]byte
+	messages  chan []byte
+	wake      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+	sync.Mutex
+}
+
+// SendMessage queues the recorded responses for the requests on the message
+func (t *replayer) SendMessage(message []byte) error {
+	_, msgs, err := decodeWireMessages(message)
+	if err != nil {
+		return err
+	}
+
+	t.Lock()
+	var results []json.RawMessage
+	var notifications []json.RawMessage
+	for _, m := range msgs {
+		if m.ID == nil {
+			continue
+		}
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": *m.ID}
+		if ex := t.match(m); ex != nil {
+			if ex.Error != nil {
+				res["error"] = ex.Error
+			} else {
+				res["result"] = ex.Result
+			}
+			notifications = append(notifications, ex.notifications...)
+		} else {
+			res["error"] = &rpcError{
+				Code:    CodeBadRequest,
+				Message: fmt.Sprintf("request not recorded: %s %s", m.Method, m.Params),
+			}
+		}
+		b, err := json.Marshal(res)
+		if err != nil {
+			t.Unlock()
+			return err
+		}
+		results = append(results, b)
+	}
+	if len(results) > 0 {
+		if isBatch(message) {
+			b, _ := json.Marshal(results)
+			t.queue = append(t.queue, b)
+		} else {
+			for _, res := range results {
+				t.queue = append(t.queue, res)
+			}
+		}
+	}
+	for _, n := range notifications {
+		t.queue = append(t.queue, n)
+	}
+	t.Unlock()
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Find the recorded exchange for a request; must be called with the lock held
+func (t *replayer) match(m *wireMessage) *replayExchange {
+	last := -1
+	for i, ex := range t.exchanges {
+		if ex.Method != m.Method || !sameJSON(ex.Params, m.Params) {
+			continue
+		}
+		if !t.used[i] {
+			t.used[i] = true
+			return ex
+		}
+		last = i
+	}
+	if last < 0 {
+		return nil
+	}
+	return t.exchanges[last]
+}
+
+// Deliver queued messages, in order, until closed
+func (t *replayer) deliver() {
+	for {
+		select {
+		case <-t.wake:
+		case <-t.done:
+			return
+		}
+		for {
+			t.Lock()
+			if len(t.queue) == 0 {
+				t.Unlock()
+				break
+			}
+			m := t.queue[0]
+			t.queue = t.queue[1:]
+			t.Unlock()
+			select {
+			case t.messages <- append(m, delimiter):
+			case <-t.done:
+				return
+			}
+		}
+	}
+}
+
+// Messages returns the channel used to deliver the replayed messages
+func (t *replayer) Messages() <-chan []byte { return t.messages }
+
+// Errors returns a nil channel, replayed sessions don't produce transport errors
+func (t *replayer) Errors() <-chan error { return nil }
+
+// States returns a nil channel, replayed sessions are always connected
+func (t *replayer) States() <-chan ConnectionState { return nil }
+
+// Close stops the delivery of messages
+func (t *replayer) Close() error {
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
+
+// Compare JSON documents regardless of their formatting
+func sameJSON(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
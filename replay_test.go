@@ -0,0 +1,58 @@
+package electrum
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	server := newTestServer(t, map[string]string{
+		"server.banner":                     `"Welcome"`,
+		"blockchain.scripthash.get_balance": `{"confirmed":1200,"unconfirmed":-200}`,
+	}).Addr()
+	recording := &bytes.Buffer{}
+	client, err := New(&Options{
+		Transport: RecordTransport(recording, DefaultTransport(&Options{Address: server})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServerBanner(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ScriptHashBalanceContext(context.Background(), "scripthash"); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if lines := strings.Count(recording.String(), "\n"); lines != 2 {
+		t.Fatalf("unexpected recording: %s", recording)
+	}
+
+	// Replay without a server
+	replay, err := ReplayTransport(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err = New(&Options{Transport: replay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		if banner, err := client.ServerBanner(); err != nil || banner != "Welcome" {
+			t.Errorf("unexpected result: %q, %v", banner, err)
+		}
+	}
+	balance, err := client.ScriptHashBalanceContext(context.Background(), "scripthash")
+	if err != nil || balance.Confirmed != 1200 || balance.Unconfirmed != -200 {
+		t.Errorf("unexpected result: %+v, %v", balance, err)
+	}
+
+	// Requests not recorded
+	if _, err := client.ScriptHashBalanceContext(context.Background(), "other"); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package electrum
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Default retry policy settings
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = 500 * time.Millisecond
+	maxRetryBackoff      = 30 * time.Second
+)
+
+// Methods not retried automatically, since repeating them has side effects
+var nonIdempotent = map[string]bool{
+	"blockchain.transaction.broadcast": true,
+	"server.add_peer":                  true,
+}
+
+// RetryPolicy defines how synchronous operations failing with a transient error are
+// retried; operations with side effects, e.g. broadcasting a transaction, are never
+// retried automatically
+type RetryPolicy struct {
+	// Max number of attempts for each operation, including the first one; defaults to 3
+	MaxAttempts int
+
+	// Delay before the first retry, doubled on every subsequent attempt up to a max
+	// of 30 seconds; defaults to 500 milliseconds
+	Backoff time.Duration
+
+	// If provided, will be used to calculate the delay between attempts instead
+	// of the default exponential backoff
+	Strategy BackoffStrategy
+
+	// If provided, will be used to decide if a failed operation should be retried;
+	// defaults to IsTransient
+	Retryable func(error) bool
+}
+
+// IsTransient reports whether an error is likely caused by a momentary condition, like
+// a dropped connection or an overloaded server, and the operation may succeed if retried
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrConnClosed) ||
+		errors.Is(err, ErrUnreachableHost) ||
+		errors.Is(err, ErrTimeout) ||
+		errors.Is(err, ErrServerBusy)
+}
+
+// Delay before a given retry attempt, starting at 1
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	if p.Strategy != nil {
+		return p.Strategy.NextDelay(attempt)
+	}
+	b := &ExponentialBackoff{Initial: p.Backoff, Max: maxRetryBackoff}
+	if b.Initial <= 0 {
+		b.Initial = defaultRetryBackoff
+	}
+	return b.NextDelay(attempt)
+}
+
+// Check if a failed attempt should be retried
+func (p *RetryPolicy) retryable(attempt int, err error) bool {
+	max := p.MaxAttempts
+	if max <= 0 {
+		max = defaultRetryAttempts
+	}
+	if attempt >= max {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// Dispatch a synchronous request, retrying it according to the client's retry
+// policy; every attempt is submitted as a new request
+func (c *Client) retryRequest(ctx context.Context, req *request) (*response, error) {
+	res, err := c.roundTrip(ctx, req)
+	for attempt := 1; ; attempt++ {
+		cause := err
+		if cause == nil && res.Error != nil {
+			cause = c.resError(res)
+		}
+		if cause == nil || !c.retry.retryable(attempt, cause) {
+			return res, err
+		}
+
+		wait := time.NewTimer(c.retry.delay(attempt))
+		select {
+		case <-wait.C:
+		case <-ctx.Done():
+			wait.Stop()
+			return res, err
+		}
+		if c.log != nil {
+			c.log.Info("retrying request", "method", req.Method, "attempt", attempt+1, "error", cause)
+		}
+		res, err = c.roundTrip(ctx, c.req(req.Method, req.Params...))
+	}
+}
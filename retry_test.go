@@ -0,0 +1,71 @@
+package electrum
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	var banners, broadcasts int32
+	busy := &electrumtest.Error{Code: -102, Message: "server busy"}
+	srv := newTestServer(t, nil)
+	srv.HandleFunc("server.banner", func([]json.RawMessage) (interface{}, error) {
+		if atomic.AddInt32(&banners, 1) < 3 {
+			return nil, busy
+		}
+		return "Welcome", nil
+	})
+	srv.HandleFunc("blockchain.transaction.broadcast", func([]json.RawMessage) (interface{}, error) {
+		atomic.AddInt32(&broadcasts, 1)
+		return nil, busy
+	})
+	srv.HandleError("server.donation_address", 1, "bad request")
+	client, err := New(&Options{
+		Address: srv.Addr(),
+		Retry:   &RetryPolicy{Backoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.ServerBanner(); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&banners); n != 3 {
+		t.Errorf("unexpected number of attempts: %d", n)
+	}
+
+	// Operations with side effects are not retried
+	if _, err := client.BroadcastTransaction(genesisCoinbase); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&broadcasts); n != 1 {
+		t.Errorf("unexpected number of attempts: %d", n)
+	}
+
+	// Permanent errors are returned immediately
+	if _, err := client.ServerDonationAddress(); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{Backoff: time.Second}
+	for attempt, d := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: maxRetryBackoff} {
+		if got := p.delay(attempt); got != d {
+			t.Errorf("attempt %d: unexpected delay %s", attempt, got)
+		}
+	}
+	if p.retryable(defaultRetryAttempts, ErrTimeout) {
+		t.Error("expected attempts to be exhausted")
+	}
+	if !p.retryable(1, ErrTimeout) || p.retryable(1, ErrRejectedTx) {
+		t.Error("unexpected error classification")
+	}
+}
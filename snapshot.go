@@ -0,0 +1,137 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+)
+
+// ErrTipChanged is returned when the chain tip keeps moving while a snapshot is taken
+var ErrTipChanged = errors.New("TIP_CHANGED")
+
+// Number of attempts to capture a snapshot at a stable chain tip
+const snapshotAttempts = 3
+
+// SnapshotVersion identifies the serialization format of UTXO snapshots
+const SnapshotVersion = 1
+
+// UTXO describes an unspent output owned by an address
+type UTXO struct {
+	Address string    `json:"address"`
+	TxHash  string    `json:"tx_hash"`
+	Pos     uint64    `json:"tx_pos"`
+	Height  int64     `json:"height"`
+	Value   Amount    `json:"value"`
+	Proof   *TxMerkle `json:"proof,omitempty"`
+}
+
+// UTXOSnapshot captures the unspent outputs of a set of addresses at a given chain tip
+type UTXOSnapshot struct {
+	Version int    `json:"version"`
+	Tip     int    `json:"tip"`
+	UTXOs   []UTXO `json:"utxos"`
+}
+
+// Snapshot captures the full set of unspent outputs for the provided addresses at the
+// current chain tip; if the tip moves while collecting the outputs the process is
+// restarted, failing with ErrTipChanged after a few attempts. When proofs are requested
+// the merkle branch of every confirmed output is included
+func (c *Client) Snapshot(addresses []string, proofs bool) (*UTXOSnapshot, error) {
+	return c.SnapshotContext(context.Background(), addresses, proofs)
+}
+
+// SnapshotContext is like Snapshot but uses the provided context to cancel the operation
+func (c *Client) SnapshotContext(ctx context.Context, addresses []string, proofs bool) (*UTXOSnapshot, error) {
+	for i := 0; i < snapshotAttempts; i++ {
+		tip, err := c.tipHeight(ctx)
+		if err != nil {
+			return nil, err
+		}
+		snap := &UTXOSnapshot{Version: SnapshotVersion, Tip: tip, UTXOs: []UTXO{}}
+		for _, address := range addresses {
+			list, err := c.AddressListUnspentContext(ctx, address)
+			if err != nil {
+				return nil, err
+			}
+			if list == nil {
+				continue
+			}
+			for _, tx := range *list {
+				snap.UTXOs = append(snap.UTXOs, UTXO{
+					Address: address,
+					TxHash:  tx.Hash,
+					Pos:     tx.Pos,
+					Height:  tx.Height,
+					Value:   tx.Value,
+				})
+			}
+		}
+		if proofs {
+			for i, u := range snap.UTXOs {
+				if u.Height <= 0 {
+					continue
+				}
+				if snap.UTXOs[i].Proof, err = c.TransactionMerkleContext(ctx, u.TxHash, int(u.Height)); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		current, err := c.tipHeight(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if current == tip {
+			snap.sort()
+			return snap, nil
+		}
+	}
+	return nil, ErrTipChanged
+}
+
+// Order outputs by address, transaction hash and position, producing a stable
+// serialization regardless of the order returned by the server
+func (s *UTXOSnapshot) sort() {
+	sort.Slice(s.UTXOs, func(i, j int) bool {
+		a, b := s.UTXOs[i], s.UTXOs[j]
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		if a.TxHash != b.TxHash {
+			return a.TxHash < b.TxHash
+		}
+		return a.Pos < b.Pos
+	})
+}
+
+// Total returns the aggregated value of all outputs on the snapshot
+func (s *UTXOSnapshot) Total() Amount {
+	var total Amount
+	for _, u := range s.UTXOs {
+		total += u.Value
+	}
+	return total
+}
+
+// Export writes the snapshot to the provided writer as JSON; outputs are sorted so
+// that equivalent snapshots always produce identical output
+func (s *UTXOSnapshot) Export(w io.Writer) error {
+	s.sort()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// ImportSnapshot reads a snapshot previously produced with Export
+func ImportSnapshot(r io.Reader) (*UTXOSnapshot, error) {
+	s := new(UTXOSnapshot)
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	if s.Version != SnapshotVersion {
+		return nil, ErrInvalidResult
+	}
+	return s, nil
+}
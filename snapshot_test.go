@@ -0,0 +1,89 @@
+package electrum
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+func TestSnapshot(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"blockchain.headers.subscribe":      `{"height":700000}`,
+		"blockchain.address.listunspent":    `[{"tx_hash":"bb","tx_pos":1,"height":10,"value":500},{"tx_hash":"aa","tx_pos":0,"height":0,"value":250}]`,
+		"blockchain.transaction.get_merkle": `{"block_height":10,"pos":3,"merkle":["cc"]}`,
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	snap, err := client.Snapshot([]string{"addr2", "addr1"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Tip != 700000 || len(snap.UTXOs) != 4 || snap.Total() != 1500 {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+	if u := snap.UTXOs[0]; u.Address != "addr1" || u.TxHash != "aa" || u.Proof != nil {
+		t.Errorf("unexpected output: %+v", u)
+	}
+	if u := snap.UTXOs[1]; u.TxHash != "bb" || u.Proof == nil || u.Proof.Pos != 3 || u.Proof.BlockHeight != 10 {
+		t.Errorf("unexpected output: %+v", u)
+	}
+
+	// Proofs are requested at the confirmation height of every output
+	for _, req := range srv.Requests() {
+		if req.Method == "blockchain.transaction.get_merkle" && string(req.Params[1]) != `"10"` {
+			t.Errorf("unexpected proof request: %s", req.Params)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := snap.Export(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"block_height": 10`)) {
+		t.Errorf("unexpected export: %s", buf)
+	}
+	imported, err := ImportSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snap, imported) {
+		t.Errorf("snapshot mismatch: %+v", imported)
+	}
+}
+
+func TestSnapshotTipChanged(t *testing.T) {
+	srv := newTestServer(t, map[string]string{"blockchain.address.listunspent": `[]`})
+	srv.HandleFunc("blockchain.headers.subscribe", mockMovingTip(0))
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Snapshot([]string{"addr"}, false); err != ErrTipChanged {
+		t.Errorf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.SnapshotContext(ctx, []string{"addr"}, false); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// Handler for 'blockchain.headers.subscribe' reporting a new tip on every request,
+// starting after the provided height
+func mockMovingTip(height int64) electrumtest.HandlerFunc {
+	return func([]json.RawMessage) (interface{}, error) {
+		return map[string]int64{"height": atomic.AddInt64(&height, 1)}, nil
+	}
+}
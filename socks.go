@@ -0,0 +1,187 @@
+package electrum
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SOCKS5 protocol values
+// https://tools.ietf.org/html/rfc1928
+const (
+	socksVersion      = 0x05
+	socksNoAuth       = 0x00
+	socksUserPass     = 0x02
+	socksNoAcceptable = 0xFF
+	socksConnect      = 0x01
+	socksIPv4         = 0x01
+	socksDomain       = 0x03
+	socksIPv6         = 0x04
+)
+
+// Default address of a local Tor client SOCKS port
+const defaultTorProxy = "127.0.0.1:9050"
+
+// ErrProxy is returned when a connection can't be established through the SOCKS proxy
+var ErrProxy = errors.New("PROXY_ERROR")
+
+// ProxyOptions define a SOCKS5 proxy used to reach the server, e.g. a Tor client. Server
+// host names are resolved by the proxy, never locally
+type ProxyOptions struct {
+	// Address of the SOCKS5 proxy, defaults to a local Tor client on '127.0.0.1:9050'
+	Address string
+
+	// Credentials used to authenticate with the proxy, if required
+	Username string
+	Password string
+
+	// If set to true, random credentials are generated for every client instance; Tor
+	// uses a separate circuit for each set of credentials, preventing the activity of
+	// different clients from being correlated. Ignored if credentials are provided
+	IsolateStreams bool
+}
+
+// Check if an address refers to a Tor onion service
+func isOnion(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return strings.HasSuffix(strings.ToLower(host), ".onion")
+}
+
+// Resolve the proxy settings for a client instance; onion services are always
+// reached through a proxy, using a local Tor client by default
+func resolveProxy(opts *ProxyOptions, address string) (*ProxyOptions, error) {
+	if opts == nil {
+		if !isOnion(address) {
+			return nil, nil
+		}
+		opts = &ProxyOptions{}
+	}
+	p := *opts
+	if p.Address == "" {
+		p.Address = defaultTorProxy
+	}
+	if p.IsolateStreams && p.Username == "" && p.Password == "" {
+		nonce := make([]byte, 8)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		p.Username, p.Password = hex.EncodeToString(nonce), "electrum"
+	}
+	return &p, nil
+}
+
+// Request the proxy to establish a connection with the target address
+func socksHandshake(conn net.Conn, target string, p *ProxyOptions) error {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	// Negotiate the authentication method
+	method := byte(socksNoAuth)
+	if p.Username != "" || p.Password != "" {
+		method = socksUserPass
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return err
+	}
+	res := make([]byte, 2)
+	if _, err := io.ReadFull(conn, res); err != nil {
+		return err
+	}
+	if res[0] != socksVersion || res[1] == socksNoAcceptable || res[1] != method {
+		return fmt.Errorf("%w: authentication method not accepted", ErrProxy)
+	}
+	if method == socksUserPass {
+		if err := socksAuthenticate(conn, p.Username, p.Password); err != nil {
+			return err
+		}
+	}
+
+	// Request the connection; host names are sent as is to be resolved by the proxy
+	req := []byte{socksVersion, socksConnect, 0}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		if len(host) > 255 {
+			return fmt.Errorf("%w: host name too long", ErrProxy)
+		}
+		req = append(req, socksDomain, byte(len(host)))
+		req = append(req, host...)
+	case ip.To4() != nil:
+		req = append(req, socksIPv4)
+		req = append(req, ip.To4()...)
+	default:
+		req = append(req, socksIPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	// Read the reply, including the bound address
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("%w: invalid reply", ErrProxy)
+	}
+	if reply[1] != 0 {
+		return fmt.Errorf("%w: connection failed with code %d", ErrProxy, reply[1])
+	}
+	var size int
+	switch reply[3] {
+	case socksIPv4:
+		size = net.IPv4len
+	case socksIPv6:
+		size = net.IPv6len
+	case socksDomain:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return err
+		}
+		size = int(l[0])
+	default:
+		return fmt.Errorf("%w: invalid address type", ErrProxy)
+	}
+	_, err = io.ReadFull(conn, make([]byte, size+2))
+	return err
+}
+
+// Authenticate with the proxy using a username and password
+// https://tools.ietf.org/html/rfc1929
+func socksAuthenticate(conn net.Conn, username, password string) error {
+	if len(username) > 255 || len(password) > 255 {
+		return fmt.Errorf("%w: credentials too long", ErrProxy)
+	}
+	req := []byte{0x01, byte(len(username))}
+	req = append(req, username...)
+	req = append(req, byte(len(password)))
+	req = append(req, password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	res := make([]byte, 2)
+	if _, err := io.ReadFull(conn, res); err != nil {
+		return err
+	}
+	if res[1] != 0 {
+		return fmt.Errorf("%w: authentication failed", ErrProxy)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package electrum
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Start a local SOCKS5 proxy forwarding every connection to the provided server;
+// the requested targets and usernames are recorded
+func mockProxy(t *testing.T, server string) (string, *[]string, *[]string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	var targets, users []string
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 512)
+				if _, err := io.ReadFull(conn, buf[:3]); err != nil {
+					return
+				}
+				conn.Write([]byte{socksVersion, buf[2]})
+				if buf[2] == socksUserPass {
+					io.ReadFull(conn, buf[:2])
+					user := make([]byte, buf[1])
+					io.ReadFull(conn, user)
+					io.ReadFull(conn, buf[:1])
+					io.ReadFull(conn, buf[:buf[0]])
+					mu.Lock()
+					users = append(users, string(user))
+					mu.Unlock()
+					conn.Write([]byte{0x01, 0})
+				}
+				if _, err := io.ReadFull(conn, buf[:5]); err != nil || buf[3] != socksDomain {
+					return
+				}
+				host := make([]byte, buf[4])
+				io.ReadFull(conn, host)
+				io.ReadFull(conn, buf[:2])
+				mu.Lock()
+				targets = append(targets, net.JoinHostPort(string(host), strconv.Itoa(int(binary.BigEndian.Uint16(buf)))))
+				mu.Unlock()
+				conn.Write([]byte{socksVersion, 0, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+
+				upstream, err := net.Dial("tcp", server)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String(), &targets, &users
+}
+
+func TestProxy(t *testing.T) {
+	proxy, targets, users := mockProxy(t, newTestServer(t, bannerResult).Addr())
+	onion := "electrumx3jfdkgyxq3xcszqhoglgxafzsyfwn2ma4m2iaiqmlxzuj7id.onion:50001"
+	for i := 0; i < 2; i++ {
+		client, err := New(&Options{
+			Address: onion,
+			Proxy:   &ProxyOptions{Address: proxy, IsolateStreams: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.ServerBanner(); err != nil {
+			t.Error(err)
+		}
+		client.Close()
+	}
+	if len(*targets) != 2 || (*targets)[0] != onion {
+		t.Errorf("unexpected proxy targets: %v", *targets)
+	}
+	if len(*users) != 2 || (*users)[0] == (*users)[1] {
+		t.Errorf("streams not isolated: %v", *users)
+	}
+}
+
+func TestResolveProxy(t *testing.T) {
+	if p, _ := resolveProxy(nil, "electrum.example:50002"); p != nil {
+		t.Errorf("unexpected proxy: %+v", p)
+	}
+	p, err := resolveProxy(nil, "abc.onion:50001")
+	if err != nil || p == nil || p.Address != defaultTorProxy {
+		t.Errorf("unexpected proxy: %+v, %v", p, err)
+	}
+	p, _ = resolveProxy(&ProxyOptions{Username: "user", IsolateStreams: true}, "abc.onion:50001")
+	if p.Username != "user" {
+		t.Errorf("provided credentials replaced: %+v", p)
+	}
+}
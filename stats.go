@@ -0,0 +1,114 @@
+package electrum
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the client's runtime counters; counters are accumulated
+// over the lifetime of the client instance, across restarts and reconnections
+type Stats struct {
+	// Number of requests sent to the server, counting every item of a batch
+	RequestsSent uint64
+
+	// Number of responses received from the server
+	ResponsesReceived uint64
+
+	// Number of subscription notifications received from the server
+	NotificationsReceived uint64
+
+	// Number of notifications discarded due to slow consumers, according to the
+	// client's overflow policy
+	NotificationsDropped uint64
+
+	// Bytes written to the transport
+	BytesSent uint64
+
+	// Bytes received from the transport
+	BytesReceived uint64
+
+	// Number of times the connection with the server was recovered
+	Reconnects uint64
+
+	// Number of active subscriptions
+	Subscriptions int
+
+	// Last error produced by an operation or reported by the transport, if any
+	LastError error
+
+	// Time the last error was produced
+	LastErrorTime time.Time
+
+	// Time elapsed since the connection with the server was established, zero
+	// when not connected
+	Uptime time.Duration
+}
+
+// Runtime counters of a client instance
+type clientStats struct {
+	requests      atomic.Uint64
+	responses     atomic.Uint64
+	notifications atomic.Uint64
+	dropped       atomic.Uint64
+	bytesOut      atomic.Uint64
+	bytesIn       atomic.Uint64
+	reconnects    atomic.Uint64
+	lastErr       error
+	lastErrTime   time.Time
+	connected     time.Time
+	mu            sync.Mutex
+}
+
+// Count an outbound message carrying the given number of requests
+func (s *clientStats) sent(requests, size int) {
+	s.requests.Add(uint64(requests))
+	s.bytesOut.Add(uint64(size))
+}
+
+// Register the last error produced
+func (s *clientStats) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err
+	s.lastErrTime = time.Now()
+}
+
+// Track the time the connection was established, reset when it's lost
+func (s *clientStats) setConnected(connected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !connected {
+		s.connected = time.Time{}
+	} else if s.connected.IsZero() {
+		s.connected = time.Now()
+	}
+}
+
+// Stats returns a snapshot of the client's runtime counters, e.g. to introspect the
+// health of the connection without a metrics system
+func (c *Client) Stats() *Stats {
+	c.Lock()
+	subs := c.activeSubscriptions()
+	c.Unlock()
+
+	s := &c.stats
+	stats := &Stats{
+		RequestsSent:          s.requests.Load(),
+		ResponsesReceived:     s.responses.Load(),
+		NotificationsReceived: s.notifications.Load(),
+		NotificationsDropped:  s.dropped.Load(),
+		BytesSent:             s.bytesOut.Load(),
+		BytesReceived:         s.bytesIn.Load(),
+		Reconnects:            s.reconnects.Load(),
+		Subscriptions:         subs,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.LastError = s.lastErr
+	stats.LastErrorTime = s.lastErrTime
+	if !s.connected.IsZero() {
+		stats.Uptime = time.Since(s.connected)
+	}
+	return stats
+}
@@ -0,0 +1,41 @@
+package electrum
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+func TestStats(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("server.banner", "Welcome")
+
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	/* #nosec */
+	client.ServerBanner()
+	/* #nosec */
+	client.ServerDonationAddress()
+
+	stats := client.Stats()
+	if stats.RequestsSent != 2 || stats.ResponsesReceived != 2 {
+		t.Errorf("unexpected counters: %+v", stats)
+	}
+	if stats.BytesSent == 0 || stats.BytesReceived == 0 || stats.Uptime <= 0 {
+		t.Errorf("unexpected counters: %+v", stats)
+	}
+	if !errors.Is(stats.LastError, ErrMethodNotFound) || stats.LastErrorTime.IsZero() {
+		t.Errorf("unexpected last error: %v", stats.LastError)
+	}
+
+	client.Stop()
+	if stats := client.Stats(); stats.Uptime != 0 || stats.RequestsSent != 2 {
+		t.Errorf("unexpected counters after stop: %+v", stats)
+	}
+}
@@ -0,0 +1,157 @@
+package electrum
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned by stores when the requested key doesn't exist
+var ErrNotFound = errors.New("NOT_FOUND")
+
+// Store provides persistence for state that must survive process restarts,
+// like queued transactions; keys are namespaced by the features using them
+type Store interface {
+	// Put saves the value for the given key, replacing any existing value
+	Put(key string, value []byte) error
+
+	// Get returns the value for the given key, or ErrNotFound
+	Get(key string) ([]byte, error)
+
+	// Delete removes the given key, deleting a missing key is not an error
+	Delete(key string) error
+
+	// Keys returns the sorted list of existing keys with the given prefix
+	Keys(prefix string) ([]string, error)
+}
+
+// MemoryStore is a volatile store, useful for testing or when persistence is not required
+type MemoryStore struct {
+	data map[string][]byte
+	mu   sync.Mutex
+}
+
+// NewMemoryStore returns a new empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+// Put saves the value for the given key, replacing any existing value
+func (s *MemoryStore) Put(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Get returns the value for the given key, or ErrNotFound
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// Delete removes the given key
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+// Keys returns the sorted list of existing keys with the given prefix
+func (s *MemoryStore) Keys(prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// FileStore persists every entry as an individual file inside a local directory
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore returns a store using the provided directory, it will be created
+// if required
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Keys are encoded to get valid file names
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, base64.RawURLEncoding.EncodeToString([]byte(key)))
+}
+
+// Put saves the value for the given key, replacing any existing value; the file is
+// written atomically
+func (s *FileStore) Put(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := s.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, value, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(key))
+}
+
+// Get returns the value for the given key, or ErrNotFound
+func (s *FileStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return v, err
+}
+
+// Delete removes the given key
+func (s *FileStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Keys returns the sorted list of existing keys with the given prefix
+func (s *FileStore) Keys(prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, f := range files {
+		k, err := base64.RawURLEncoding.DecodeString(f.Name())
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(string(k), prefix) {
+			keys = append(keys, string(k))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
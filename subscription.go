@@ -2,78 +2,646 @@ package electrum
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
 )
 
+// Subscription is a handle to an active subscription, allowing callers to manage its
+// lifecycle explicitly instead of relying solely on context cancellation
+type Subscription struct {
+	sub *subscription
+}
+
+// Method returns the protocol method used to register the subscription
+func (s *Subscription) Method() string {
+	return s.sub.method
+}
+
+// Params returns the parameters used to register the subscription
+func (s *Subscription) Params() []interface{} {
+	return append([]interface{}(nil), s.sub.params...)
+}
+
+// Created returns the time the subscription was setup
+func (s *Subscription) Created() time.Time {
+	return s.sub.created
+}
+
+// Messages returns the number of results and notifications received for the subscription
+func (s *Subscription) Messages() uint64 {
+	return s.sub.received.Load()
+}
+
+// Dropped returns the number of notifications discarded because the consumer was not
+// keeping up, according to the client's overflow policy
+func (s *Subscription) Dropped() uint64 {
+	return s.sub.dropped.Load()
+}
+
+// Done returns a channel closed once the subscription is terminated and its
+// notifications channel closed
+func (s *Subscription) Done() <-chan struct{} {
+	return s.sub.done
+}
+
+// Err returns nil while the subscription is active; afterwards it reports the reason
+// of the termination, e.g. the context error when cancelled by the consumer,
+// ErrUnsubscribed, ErrClientClosed, ErrSlowConsumer, the error returned by the server
+// when rejecting the subscribe request, or the error preventing the subscription from
+// being registered again after a reconnection. Subscriptions are preserved while the
+// connection is down, and when the client is stopped, to be resumed afterwards
+func (s *Subscription) Err() error {
+	if s.sub.ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(s.sub.ctx)
+}
+
+// Unsubscribe terminates the subscription, asking the server to stop sending its
+// notifications when supported; returns once the notifications channel is closed
+func (s *Subscription) Unsubscribe() {
+	s.sub.cancel(ErrUnsubscribed)
+	<-s.sub.done
+}
+
+// SubscriptionEvent flags changes on the delivery of a subscription's notifications
+type SubscriptionEvent string
+
+// Subscription events
+const (
+	// Notifications are not received while the connection with the server is down
+	SubscriptionSuspended SubscriptionEvent = "SUSPENDED"
+
+	// The subscription was accepted again by the server after a reconnection or restart,
+	// notifications are delivered again
+	SubscriptionResumed SubscriptionEvent = "RESUMED"
+
+	// The subscription couldn't be registered again and is terminated
+	SubscriptionFailed SubscriptionEvent = "FAILED"
+
+	// Notifications were missed while the connection with the server was down and couldn't
+	// be delivered afterwards, e.g. block headers on servers not supporting the required
+	// methods; the subscription remains active
+	SubscriptionGap SubscriptionEvent = "GAP"
+)
+
+// OnSubscriptionEvent registers a function to be notified when subscriptions are suspended
+// due to a dropped connection, resumed afterwards or fail to resume, e.g. to know when the
+// received notifications are trustworthy again. Events missed while suspended are delivered
+// on resumption: the current status of addresses and script hashes when changed, and the
+// block headers found meanwhile; listeners must not block
+func (c *Client) OnSubscriptionEvent(fn func(sub *Subscription, event SubscriptionEvent, err error)) {
+	c.Lock()
+	defer c.Unlock()
+	c.subWatchers = append(c.subWatchers, fn)
+}
+
+// Run the registered subscription event listeners
+func (c *Client) notifySubscription(sub *subscription, event SubscriptionEvent, err error) {
+	c.Lock()
+	watchers := c.subWatchers
+	c.Unlock()
+	for _, w := range watchers {
+		w(&Subscription{sub}, event, err)
+	}
+}
+
+// Report all the active subscriptions as suspended
+func (c *Client) suspendSubscriptions() {
+	for _, s := range c.Subscriptions() {
+		c.notifySubscription(s.sub, SubscriptionSuspended, nil)
+	}
+}
+
+// Subscriptions returns the subscriptions currently registered on the client, oldest
+// first; useful to verify what the server is tracking, e.g. after reconnections
+func (c *Client) Subscriptions() []*Subscription {
+	c.Lock()
+	defer c.Unlock()
+	var list []*Subscription
+	for _, sub := range c.subs {
+		if sub.handler != nil {
+			list = append(list, &Subscription{sub})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i].sub, list[j].sub
+		if !a.created.Equal(b.created) {
+			return a.created.Before(b.created)
+		}
+		return a.id < b.id
+	})
+	return list
+}
+
+// UnsubscribeAll terminates every active subscription with ErrUnsubscribed, asking the server
+// to stop sending their notifications when supported; unlike Close, the client remains
+// available for synchronous requests and new subscriptions. Returns once the notifications
+// channel of every subscription is closed
+func (c *Client) UnsubscribeAll() {
+	subs := c.Subscriptions()
+	for _, s := range subs {
+		s.sub.cancel(ErrUnsubscribed)
+	}
+	for _, s := range subs {
+		<-s.sub.done
+	}
+}
+
 // NotifyBlockHeaders will setup a subscription for the method 'blockchain.headers.subscribe'
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-headers-subscribe
-func (c *Client) NotifyBlockHeaders(ctx context.Context) (<-chan *BlockHeader, error) {
-	headers := make(chan *BlockHeader)
-	sub := &subscription{
-		ctx:      ctx,
-		method:   "blockchain.headers.subscribe",
-		messages: make(chan *response),
-		handler: func(m *response) {
-			if m.Result != nil {
+func (c *Client) NotifyBlockHeaders(ctx context.Context) (<-chan *BlockHeader, *Subscription, error) {
+	sub := newSubscription(ctx)
+	headers, _, err := c.notifyBlockHeaders(sub)
+	if err != nil {
+		return nil, nil, err
+	}
+	return headers, &Subscription{sub}, nil
+}
+
+// SubscribeBlockHeaders will setup a subscription for the method 'blockchain.headers.subscribe',
+// returning the current chain tip along with the channel receiving subsequent notifications;
+// no notification is missed between both
+func (c *Client) SubscribeBlockHeaders(ctx context.Context) (*BlockHeader, <-chan *BlockHeader, error) {
+	sub := newSubscription(ctx)
+	sub.snapshot = make(chan *response, 1)
+	headers, last, err := c.notifyBlockHeaders(sub)
+	if err != nil {
+		return nil, nil, err
+	}
+	tip := new(BlockHeader)
+	if err := c.waitSnapshot(sub, tip); err != nil {
+		sub.cancel(err)
+		return nil, nil, err
+	}
+	completeHeader(tip)
+	c.chain.extend(tip)
+	last.CompareAndSwap(nil, tip)
+	return tip, headers, nil
+}
+
+// NotifyTipHeight will setup a subscription for the method 'blockchain.headers.subscribe',
+// delivering only the height of the chain tip; the channel receives the current height
+// followed by every change, and is closed once the subscription terminates. Replaces the
+// deprecated 'blockchain.numblocks.subscribe' method
+func (c *Client) NotifyTipHeight(ctx context.Context) (<-chan int64, error) {
+	sub := newSubscription(ctx)
+	headers, _, err := c.notifyBlockHeaders(sub)
+	if err != nil {
+		return nil, err
+	}
+	heights := make(chan int64, c.subBuffer)
+	go func() {
+		defer close(heights)
+		last := int64(-1)
+		for h := range headers {
+			if int64(h.Height) == last {
+				continue
+			}
+			last = int64(h.Height)
+			select {
+			case heights <- last:
+			case <-sub.ctx.Done():
+			}
+		}
+	}()
+	return heights, nil
+}
+
+// Setup a headers subscription; along with the channel, returns the last header delivered to
+// the consumer, used to detect and backfill the headers missed while the connection was down
+func (c *Client) notifyBlockHeaders(sub *subscription) (<-chan *BlockHeader, *atomic.Pointer[BlockHeader], error) {
+	headers := make(chan *BlockHeader, c.subBuffer)
+	sub.method = "blockchain.headers.subscribe"
+	sub.onClose = func() {
+		close(headers)
+	}
+
+	// The tip is skipped when reported again on resumption
+	last := new(atomic.Pointer[BlockHeader])
+	sub.backfill = func() error {
+		return c.backfillHeaders(sub, last.Load())
+	}
+	sub.handler = func(m *response) {
+		if m.Result != nil {
+			h := &BlockHeader{}
+			var b []byte
+			var err error
+			if b, err = c.codec.Marshal(m.Result); err != nil {
+				return
+			}
+			if err = c.codec.Unmarshal(b, h); err == nil {
+				completeHeader(h)
+				c.chain.extend(h)
+				if prev := last.Load(); sub.resumed && prev != nil && prev.Height == h.Height && prev.RawHex == h.RawHex {
+					return
+				}
+				last.Store(h)
+				emit(c, sub, headers, h)
+			}
+		}
+
+		if m.Params != nil {
+			for _, i := range m.Params.([]interface{}) {
 				h := &BlockHeader{}
 				var b []byte
 				var err error
-				if b, err = json.Marshal(m.Result); err != nil {
-					return
+				if b, err = c.codec.Marshal(i); err != nil {
+					continue
 				}
-				if err = json.Unmarshal(b, h); err == nil {
-					headers <- h
+				if err = c.codec.Unmarshal(b, h); err == nil {
+					completeHeader(h)
+					c.chain.extend(h)
+					last.Store(h)
+					emit(c, sub, headers, h)
 				}
 			}
+		}
+	}
+	if err := c.startSubscription(sub); err != nil {
+		return nil, nil, err
+	}
+	return headers, last, nil
+}
 
-			if m.Params != nil {
-				for _, i := range m.Params.([]interface{}) {
-					h := &BlockHeader{}
-					var b []byte
-					var err error
-					if b, err = json.Marshal(i); err != nil {
-						continue
-					}
-					if err = json.Unmarshal(b, h); err == nil {
-						headers <- h
-					}
-				}
+// Deliver to a headers subscription the headers found after the last one it received, up
+// to the current chain tip; requires protocol 1.2 or newer
+func (c *Client) backfillHeaders(sub *subscription, last *BlockHeader) error {
+	if last == nil {
+		return nil
+	}
+	tip, err := c.tipHeight(sub.ctx)
+	if err != nil {
+		return err
+	}
+	it := c.Headers(int(last.Height)+1, tip+1)
+	for {
+		h, err := it.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.deliver(sub, &response{Result: h}, nil)
+		if err := sub.ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// NotifyPeers will setup a subscription for the method 'server.peers.subscribe'; the channel
+// receives the list of peers currently known to the server followed by the updated list
+// every time the server reports a change
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#server-peers-subscribe
+func (c *Client) NotifyPeers(ctx context.Context) (<-chan []*Peer, *Subscription, error) {
+	sub := newSubscription(ctx)
+	peers := make(chan []*Peer, c.subBuffer)
+	sub.method = "server.peers.subscribe"
+	sub.handler = func(m *response) {
+		if params, ok := m.Params.([]interface{}); ok {
+			if len(params) > 0 {
+				list, _ := params[0].([]interface{})
+				emit(c, sub, peers, parsePeers(list))
 			}
-		},
+			return
+		}
+		if list, ok := m.Result.([]interface{}); ok {
+			emit(c, sub, peers, parsePeers(list))
+		}
+	}
+	sub.onClose = func() {
+		close(peers)
 	}
 	if err := c.startSubscription(sub); err != nil {
-		close(headers)
-		return nil, err
+		return nil, nil, err
 	}
-	return headers, nil
+	return peers, &Subscription{sub}, nil
 }
 
 // NotifyAddressTransactions will setup a subscription for the method 'blockchain.address.subscribe'
 //
 // https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-address-subscribe
-func (c *Client) NotifyAddressTransactions(ctx context.Context, address string) (<-chan string, error) {
-	txs := make(chan string)
-	sub := &subscription{
-		ctx:      ctx,
-		method:   "blockchain.address.subscribe",
-		params:   []string{address},
-		messages: make(chan *response),
-		handler: func(m *response) {
-			if m.Result != nil {
-				txs <- m.Result.(string)
-			}
+func (c *Client) NotifyAddressTransactions(ctx context.Context, address string) (<-chan *AddressStatus, *Subscription, error) {
+	sub := newSubscription(ctx)
+	txs, err := c.notifyAddressTransactions(sub, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	return txs, &Subscription{sub}, nil
+}
+
+// SubscribeAddressTransactions will setup a subscription for the method 'blockchain.address.subscribe',
+// returning the current status of the address, empty for unused addresses, along with the channel
+// receiving subsequent notifications; no notification is missed between both
+func (c *Client) SubscribeAddressTransactions(ctx context.Context, address string) (string, <-chan *AddressStatus, error) {
+	sub := newSubscription(ctx)
+	sub.snapshot = make(chan *response, 1)
+	txs, err := c.notifyAddressTransactions(sub, address)
+	if err != nil {
+		return "", nil, err
+	}
+	var status *string
+	if err := c.waitSnapshot(sub, &status); err != nil {
+		sub.cancel(err)
+		return "", nil, err
+	}
+	if status == nil {
+		return "", txs, nil
+	}
+	return *status, txs, nil
+}
 
-			if m.Params != nil {
-				for _, i := range m.Params.([]interface{}) {
-					txs <- i.(string)
+// NotifyAddressHistory will setup a subscription for the method 'blockchain.address.subscribe',
+// delivering transactions instead of statuses: on every status change the history and mempool
+// of the address are fetched, and only the entries not delivered before, or whose height
+// changed, e.g. once confirmed, are sent. The channel receives the existing history first
+func (c *Client) NotifyAddressHistory(ctx context.Context, address string) (<-chan Tx, *Subscription, error) {
+	sub := newSubscription(ctx)
+	statuses, err := c.notifyAddressTransactions(sub, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	txs := make(chan Tx, c.subBuffer)
+	go func() {
+		defer close(txs)
+		seen := make(map[string]int64)
+		for s := range statuses {
+			if s.Status == "" && len(seen) == 0 {
+				continue
+			}
+			list, err := c.addressTransactions(sub.ctx, address)
+			if err != nil {
+				if c.log != nil && sub.ctx.Err() == nil {
+					c.log.Warn("failed to fetch address history", "server", c.Address, "error", err)
 				}
+				continue
 			}
-		},
+			current := make(map[string]int64, len(list))
+			for _, tx := range list {
+				current[tx.Hash] = tx.Height
+				if height, ok := seen[tx.Hash]; ok && height == tx.Height {
+					continue
+				}
+				select {
+				case txs <- tx:
+				case <-sub.ctx.Done():
+				}
+			}
+			seen = current
+		}
+	}()
+	return txs, &Subscription{sub}, nil
+}
+
+// Get the history of an address along with mempool entries not reported on it yet
+func (c *Client) addressTransactions(ctx context.Context, address string) ([]Tx, error) {
+	history, err := c.AddressHistoryContext(ctx, address)
+	if err != nil {
+		return nil, err
 	}
-	if err := c.startSubscription(sub); err != nil {
+	mempool, err := c.AddressMempoolContext(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	var list []Tx
+	known := make(map[string]bool)
+	for _, entries := range []*[]Tx{history, mempool} {
+		if entries == nil {
+			continue
+		}
+		for _, tx := range *entries {
+			if !known[tx.Hash] {
+				known[tx.Hash] = true
+				list = append(list, tx)
+			}
+		}
+	}
+	return list, nil
+}
+
+func (c *Client) notifyAddressTransactions(sub *subscription, address string) (<-chan *AddressStatus, error) {
+	txs := make(chan *AddressStatus, c.subBuffer)
+	sub.method = "blockchain.address.subscribe"
+	sub.unsubscribe = "blockchain.address.unsubscribe"
+	sub.params = []interface{}{address}
+	sub.poll = func() (interface{}, error) {
+		history, err := c.AddressHistoryContext(sub.ctx, address)
+		if err != nil || history == nil {
+			return nil, err
+		}
+		return addressStatus(*history), nil
+	}
+	send := newStatusSender(sub, func(status string) {
+		emit(c, sub, txs, &AddressStatus{Address: address, Status: status})
+	})
+	sub.handler = func(m *response) {
+		if status, ok := notificationStatus(m); ok {
+			send(status)
+		}
+	}
+	sub.onClose = func() {
 		close(txs)
+	}
+	if err := c.startSubscription(sub); err != nil {
 		return nil, err
 	}
 	return txs, nil
 }
+
+// NotifyScriptHash will setup a subscription for the method 'blockchain.scripthash.subscribe';
+// the channel receives the initial status of the script hash, empty if it has no history,
+// followed by the status reported on every subsequent change; use SubscribeScriptHash to
+// receive the initial status separately
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-subscribe
+func (c *Client) NotifyScriptHash(ctx context.Context, scripthash string) (<-chan *ScriptHashStatus, *Subscription, error) {
+	sub := newSubscription(ctx)
+	statuses, err := c.notifyScriptHash(sub, scripthash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return statuses, &Subscription{sub}, nil
+}
+
+// SubscribeScriptHash will setup a subscription for the method 'blockchain.scripthash.subscribe',
+// returning the current status of the script hash, empty if it has no history, along with the
+// channel receiving subsequent notifications; no notification is missed between both
+func (c *Client) SubscribeScriptHash(ctx context.Context, scripthash string) (string, <-chan *ScriptHashStatus, error) {
+	sub := newSubscription(ctx)
+	sub.snapshot = make(chan *response, 1)
+	statuses, err := c.notifyScriptHash(sub, scripthash)
+	if err != nil {
+		return "", nil, err
+	}
+	var status *string
+	if err := c.waitSnapshot(sub, &status); err != nil {
+		sub.cancel(err)
+		return "", nil, err
+	}
+	if status == nil {
+		return "", statuses, nil
+	}
+	return *status, statuses, nil
+}
+
+func (c *Client) notifyScriptHash(sub *subscription, scripthash string) (<-chan *ScriptHashStatus, error) {
+	statuses := make(chan *ScriptHashStatus, c.subBuffer)
+	sub.method = "blockchain.scripthash.subscribe"
+	sub.unsubscribe = "blockchain.scripthash.unsubscribe"
+	sub.params = []interface{}{scripthash}
+	sub.poll = func() (interface{}, error) {
+		history, err := c.ScriptHashHistoryContext(sub.ctx, scripthash)
+		if err != nil || history == nil {
+			return nil, err
+		}
+		return addressStatus(*history), nil
+	}
+	send := newStatusSender(sub, func(status string) {
+		emit(c, sub, statuses, &ScriptHashStatus{ScriptHash: scripthash, Status: status})
+	})
+	sub.handler = func(m *response) {
+		if status, ok := notificationStatus(m); ok {
+			send(status)
+		}
+	}
+	sub.onClose = func() {
+		close(statuses)
+	}
+	if err := c.startSubscription(sub); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// UnsubscribeScriptHash will synchronously run a 'blockchain.scripthash.unsubscribe' operation;
+// once confirmed by the server, local subscriptions for the script hash are terminated and their
+// channels closed. The result reports whether the server had an active subscription
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-methods.html#blockchain-scripthash-unsubscribe
+func (c *Client) UnsubscribeScriptHash(scripthash string) (bool, error) {
+	return c.UnsubscribeScriptHashContext(context.Background(), scripthash)
+}
+
+// UnsubscribeScriptHashContext is like UnsubscribeScriptHash but uses the provided context to cancel the operation
+func (c *Client) UnsubscribeScriptHashContext(ctx context.Context, scripthash string) (bool, error) {
+	return c.unsubscribe(ctx, "blockchain.scripthash.subscribe", "blockchain.scripthash.unsubscribe", scripthash)
+}
+
+// UnsubscribeAddress will synchronously run a 'blockchain.address.unsubscribe' operation;
+// once confirmed by the server, local subscriptions for the address are terminated and their
+// channels closed. The result reports whether the server had an active subscription
+func (c *Client) UnsubscribeAddress(address string) (bool, error) {
+	return c.UnsubscribeAddressContext(context.Background(), address)
+}
+
+// UnsubscribeAddressContext is like UnsubscribeAddress but uses the provided context to cancel the operation
+func (c *Client) UnsubscribeAddressContext(ctx context.Context, address string) (bool, error) {
+	return c.unsubscribe(ctx, "blockchain.address.subscribe", "blockchain.address.unsubscribe", address)
+}
+
+// Request the server to stop sending notifications for a subscription method and parameter,
+// terminating the matching local subscriptions when successful
+func (c *Client) unsubscribe(ctx context.Context, method, unsubscribe, param string) (bool, error) {
+	res, err := c.syncRequest(ctx, c.req(unsubscribe, param))
+	if err != nil {
+		return false, err
+	}
+	if res.Error != nil {
+		return false, c.resError(res)
+	}
+	var active bool
+	if err := c.decode(res, &active); err != nil {
+		return false, err
+	}
+
+	// Subscriptions are removed before being reaped, preventing a second
+	// unsubscribe request for them
+	c.Lock()
+	defer c.Unlock()
+	for id, sub := range c.subs {
+		if sub.method == method && len(sub.params) > 0 && sub.params[0] == param {
+			sub.cancel(ErrUnsubscribed)
+			c.removeSubscriptionLocked(id)
+		}
+	}
+	return active, nil
+}
+
+// Wait for the initial result of a subscription and decode it into the provided value;
+// fails if the subscription terminates in the meantime
+func (c *Client) waitSnapshot(sub *subscription, v interface{}) error {
+	res, ok := <-sub.snapshot
+	if !ok {
+		return ErrConnClosed
+	}
+	if res.Error != nil {
+		return c.resError(res)
+	}
+	return c.decode(res, v)
+}
+
+// Periodically run the subscription's poll function and deliver changed results to its
+// handler; used as fallback when the server rejects the subscribe request
+func (c *Client) pollSubscription(sub *subscription) {
+	c.Lock()
+	if sub.polling {
+		c.Unlock()
+		return
+	}
+	sub.polling = true
+	c.Unlock()
+
+	var last interface{}
+	t := time.NewTicker(c.pollInterval)
+	defer t.Stop()
+	for {
+		if r, err := sub.poll(); err == nil && !reflect.DeepEqual(r, last) {
+			last = r
+			c.deliver(sub, &response{Result: r}, nil)
+		}
+		select {
+		case <-t.C:
+		case <-sub.ctx.Done():
+			return
+		}
+	}
+}
+
+// Wrap the delivery of statuses for a subscription, skipping the status reported on
+// resumption when it didn't change while the connection was down; must only be used
+// from the subscription's processing loop
+func newStatusSender(sub *subscription, send func(string)) func(string) {
+	var last *string
+	return func(status string) {
+		if sub.resumed && last != nil && *last == status {
+			return
+		}
+		last = &status
+		send(status)
+	}
+}
+
+// Calculate the status of an address from its history, as reported by the server
+// on 'blockchain.address.subscribe' notifications; returns nil for unused addresses
+//
+// https://electrumx.readthedocs.io/en/latest/protocol-basics.html#status
+func addressStatus(history []Tx) interface{} {
+	if len(history) == 0 {
+		return nil
+	}
+	status := ""
+	for _, tx := range history {
+		status += fmt.Sprintf("%s:%d:", tx.Hash, tx.Height)
+	}
+	h := sha256.Sum256([]byte(status))
+	return hex.EncodeToString(h[:])
+}
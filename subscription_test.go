@@ -0,0 +1,646 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+func TestSubscriptionHandle(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("blockchain.scripthash.subscribe", "status")
+	srv.Handle("blockchain.scripthash.unsubscribe", true)
+
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	statuses, sub, err := client.NotifyScriptHash(context.Background(), "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Method() != "blockchain.scripthash.subscribe" || len(sub.Params()) != 1 || sub.Params()[0] != "scripthash" {
+		t.Errorf("unexpected subscription: %s %v", sub.Method(), sub.Params())
+	}
+	<-statuses
+	if sub.Err() != nil {
+		t.Errorf("unexpected error for active subscription: %v", sub.Err())
+	}
+
+	sub.Unsubscribe()
+	if _, ok := <-statuses; ok {
+		t.Error("channel not closed")
+	}
+	select {
+	case <-sub.Done():
+	default:
+		t.Error("subscription not done")
+	}
+	if !errors.Is(sub.Err(), ErrUnsubscribed) {
+		t.Errorf("unexpected error: %v", sub.Err())
+	}
+
+	// Context cancellation and client termination
+	ctx, cancel := context.WithCancel(context.Background())
+	_, byContext, err := client.NotifyScriptHash(ctx, "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, byClient, err := client.NotifyBlockHeaders(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-byContext.Done()
+	if !errors.Is(byContext.Err(), context.Canceled) {
+		t.Errorf("unexpected error: %v", byContext.Err())
+	}
+	client.Close()
+	<-byClient.Done()
+	if !errors.Is(byClient.Err(), ErrClientClosed) {
+		t.Errorf("unexpected error: %v", byClient.Err())
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("blockchain.scripthash.subscribe", "status")
+	srv.Handle("blockchain.headers.subscribe", map[string]interface{}{"height": 100, "hex": "00"})
+
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	statuses, _, err := client.NotifyScriptHash(context.Background(), "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, _, err := client.NotifyBlockHeaders(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-statuses
+	<-headers
+
+	subs := client.Subscriptions()
+	if len(subs) != 2 {
+		t.Fatalf("unexpected subscriptions: %d", len(subs))
+	}
+	if subs[0].Method() != "blockchain.scripthash.subscribe" || subs[1].Method() != "blockchain.headers.subscribe" {
+		t.Errorf("unexpected order: %s, %s", subs[0].Method(), subs[1].Method())
+	}
+	for _, sub := range subs {
+		if sub.Messages() != 1 || sub.Created().IsZero() {
+			t.Errorf("unexpected details for %s: %d, %s", sub.Method(), sub.Messages(), sub.Created())
+		}
+	}
+
+	subs[0].Unsubscribe()
+	if subs := client.Subscriptions(); len(subs) != 1 || subs[0].Method() != "blockchain.headers.subscribe" {
+		t.Errorf("unexpected subscriptions after unsubscribe: %d", len(subs))
+	}
+}
+
+func TestSubscriptionError(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.HandleError("blockchain.scripthash.subscribe", CodeExcessiveResourceUsage, "too many subscriptions")
+
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	statuses, sub, err := client.NotifyScriptHash(context.Background(), "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-statuses; ok {
+		t.Error("channel not closed")
+	}
+	<-sub.Done()
+	if !errors.Is(sub.Err(), ErrExcessiveUsage) {
+		t.Errorf("unexpected error: %v", sub.Err())
+	}
+	if len(client.Subscriptions()) != 0 {
+		t.Error("rejected subscription still registered")
+	}
+}
+
+func TestSubscriptionEvents(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("blockchain.scripthash.subscribe", "status-0")
+
+	client, err := New(&Options{
+		Address:   srv.Addr(),
+		Reconnect: &ReconnectOptions{InitialDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	events := make(chan string, 10)
+	client.OnSubscriptionEvent(func(sub *Subscription, event SubscriptionEvent, err error) {
+		events <- fmt.Sprintf("%s %s %v", sub.Params()[0], event, err)
+	})
+	statuses, sub, err := client.NotifyScriptHash(context.Background(), "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-statuses
+
+	// Resumed on reconnection, the channel handed to the consumer is preserved and the
+	// unchanged status is not delivered again
+	srv.Disconnect()
+	for _, expected := range []string{"first SUSPENDED <nil>", "first RESUMED <nil>"} {
+		if e := <-events; e != expected {
+			t.Errorf("unexpected event: %s", e)
+		}
+	}
+	/* #nosec */
+	srv.Notify("blockchain.scripthash.subscribe", "first", "status-1")
+	if s := <-statuses; s.Status != "status-1" {
+		t.Errorf("unexpected status: %s", s.Status)
+	}
+
+	// Rejected after reconnection
+	srv.HandleError("blockchain.scripthash.subscribe", CodeExcessiveResourceUsage, "too many subscriptions")
+	srv.Disconnect()
+	for _, expected := range []string{"first SUSPENDED <nil>", "first FAILED too many subscriptions"} {
+		if e := <-events; e != expected {
+			t.Errorf("unexpected event: %s", e)
+		}
+	}
+	<-sub.Done()
+	if !errors.Is(sub.Err(), ErrExcessiveUsage) {
+		t.Errorf("unexpected error: %v", sub.Err())
+	}
+}
+
+func TestNotificationRouting(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("blockchain.address.subscribe", nil)
+
+	client, err := New(&Options{Address: srv.Addr(), SubscriptionBuffer: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	first, _, err := client.NotifyAddressTransactions(context.Background(), "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, sub, err := client.NotifyAddressTransactions(context.Background(), "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; sub.Messages() == 0 && i < 1000; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Both start with the empty status of an unused address
+	if s := <-first; s.Address != "first" || s.Status != "" {
+		t.Errorf("unexpected initial status: %+v", s)
+	}
+	if s := <-second; s.Address != "second" || s.Status != "" {
+		t.Errorf("unexpected initial status: %+v", s)
+	}
+
+	/* #nosec */
+	srv.Notify("blockchain.address.subscribe", "first", "status-1")
+	/* #nosec */
+	srv.Notify("blockchain.address.subscribe", "second", "status-2")
+	if s := <-first; s.Address != "first" || s.Status != "status-1" {
+		t.Errorf("unexpected status: %+v", s)
+	}
+	if s := <-second; s.Address != "second" || s.Status != "status-2" {
+		t.Errorf("unexpected status: %+v", s)
+	}
+	select {
+	case s := <-first:
+		t.Errorf("unexpected notification: %+v", s)
+	default:
+	}
+}
+
+func TestNotifyTipHeight(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("blockchain.headers.subscribe", map[string]interface{}{"height": 100, "hex": genesisHeader})
+
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	heights, err := client.NotifyTipHeight(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := <-heights; h != 100 {
+		t.Errorf("unexpected height: %d", h)
+	}
+
+	// Headers at the same height are not reported again
+	for _, height := range []int{100, 101} {
+		/* #nosec */
+		srv.Notify("blockchain.headers.subscribe", map[string]interface{}{"height": height, "hex": genesisHeader})
+	}
+	if h := <-heights; h != 101 {
+		t.Errorf("unexpected height: %d", h)
+	}
+
+	cancel()
+	for range heights {
+	}
+}
+
+func TestNotifyPeers(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("server.peers.subscribe", []interface{}{
+		[]interface{}{"1.2.3.4", "a.example.com", []string{"v1.4", "s50002"}},
+	})
+
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	peers, sub, err := client.NotifyPeers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := <-peers; len(list) != 1 || list[0].Name != "a.example.com" || len(list[0].Features) != 2 {
+		t.Errorf("unexpected peers: %+v", list)
+	}
+
+	/* #nosec */
+	srv.Notify("server.peers.subscribe", []interface{}{
+		[]interface{}{"1.2.3.4", "a.example.com", []string{"v1.4"}},
+		[]interface{}{"5.6.7.8", "b.example.com", []string{"v1.4", "t50001"}},
+		[]interface{}{"malformed"},
+	})
+	if list := <-peers; len(list) != 2 || list[1].Address != "5.6.7.8" {
+		t.Errorf("unexpected peers: %+v", list)
+	}
+
+	sub.Unsubscribe()
+	if _, ok := <-peers; ok {
+		t.Error("channel not closed")
+	}
+}
+
+func TestNotifyAddressHistory(t *testing.T) {
+	var mu sync.Mutex
+	history := []Tx{{Hash: "aa", Height: 10}}
+	mempool := []Tx{{Hash: "bb"}}
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("blockchain.address.subscribe", "status-0")
+	srv.HandleFunc("blockchain.address.get_history", func([]json.RawMessage) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Tx(nil), history...), nil
+	})
+	srv.HandleFunc("blockchain.address.get_mempool", func([]json.RawMessage) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Tx(nil), mempool...), nil
+	})
+
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	txs, sub, err := client.NotifyAddressHistory(context.Background(), "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"aa:10", "bb:0"} {
+		if tx := <-txs; fmt.Sprintf("%s:%d", tx.Hash, tx.Height) != expected {
+			t.Errorf("unexpected transaction: %+v", tx)
+		}
+	}
+
+	// Only new and confirmed entries are delivered on status changes
+	mu.Lock()
+	history = []Tx{{Hash: "aa", Height: 10}, {Hash: "bb", Height: 11}}
+	mempool = []Tx{{Hash: "cc", Height: -1}}
+	mu.Unlock()
+	/* #nosec */
+	srv.Notify("blockchain.address.subscribe", "address", "status-1")
+	for _, expected := range []string{"bb:11", "cc:-1"} {
+		if tx := <-txs; fmt.Sprintf("%s:%d", tx.Hash, tx.Height) != expected {
+			t.Errorf("unexpected transaction: %+v", tx)
+		}
+	}
+
+	sub.Unsubscribe()
+	for range txs {
+	}
+}
+
+func TestSubscriptionBackfill(t *testing.T) {
+	var mu sync.Mutex
+	tip := 100
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.HandleFunc("blockchain.headers.subscribe", func([]json.RawMessage) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return map[string]interface{}{"height": tip, "hex": genesisHeader}, nil
+	})
+	srv.HandleFunc("blockchain.block.headers", func(params []json.RawMessage) (interface{}, error) {
+		var count int
+		if err := json.Unmarshal(params[1], &count); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"count": count, "hex": strings.Repeat(genesisHeader, count), "max": 2016}, nil
+	})
+
+	client, err := New(&Options{
+		Address:   srv.Addr(),
+		Reconnect: &ReconnectOptions{InitialDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	events := make(chan string, 10)
+	client.OnSubscriptionEvent(func(sub *Subscription, event SubscriptionEvent, err error) {
+		if event != SubscriptionSuspended {
+			events <- fmt.Sprintf("%s %v", event, err)
+		}
+	})
+	current, headers, err := client.SubscribeBlockHeaders(context.Background())
+	if err != nil || current.Height != 100 {
+		t.Fatalf("unexpected result: %+v, %v", current, err)
+	}
+
+	// Headers found while disconnected are delivered in order, without repeating the tip
+	mu.Lock()
+	tip = 103
+	mu.Unlock()
+	srv.Disconnect()
+	for _, expected := range []uint64{101, 102, 103} {
+		if h := <-headers; h.Height != expected {
+			t.Errorf("unexpected header height: %d, expecting %d", h.Height, expected)
+		}
+	}
+	if e := <-events; e != "RESUMED <nil>" {
+		t.Errorf("unexpected event: %s", e)
+	}
+	select {
+	case h := <-headers:
+		t.Errorf("unexpected header: %+v", h)
+	default:
+	}
+
+	// Servers unable to provide the missing headers report the gap
+	srv.HandleError("blockchain.block.headers", CodeBadRequest, "not supported")
+	mu.Lock()
+	tip = 110
+	mu.Unlock()
+	srv.Disconnect()
+	if e := <-events; !strings.HasPrefix(e, "GAP") || !strings.Contains(e, "not supported") {
+		t.Errorf("unexpected event: %s", e)
+	}
+	if e := <-events; e != "RESUMED <nil>" {
+		t.Errorf("unexpected event: %s", e)
+	}
+	if h := <-headers; h.Height != 110 {
+		t.Errorf("unexpected header height: %d", h.Height)
+	}
+}
+
+func TestUnsubscribeAll(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("server.version", []string{"electrumtest", "1.4.2"})
+	srv.Handle("blockchain.scripthash.subscribe", "status")
+	srv.Handle("blockchain.scripthash.unsubscribe", true)
+	srv.Handle("blockchain.headers.subscribe", map[string]interface{}{"height": 100, "hex": genesisHeader})
+
+	client, err := New(&Options{Address: srv.Addr(), Protocol: "1.4.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	statuses, byScriptHash, err := client.NotifyScriptHash(context.Background(), "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, byHeaders, err := client.NotifyBlockHeaders(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-statuses
+	<-headers
+
+	client.UnsubscribeAll()
+	for _, sub := range []*Subscription{byScriptHash, byHeaders} {
+		if !errors.Is(sub.Err(), ErrUnsubscribed) {
+			t.Errorf("unexpected error: %v", sub.Err())
+		}
+	}
+	if _, ok := <-statuses; ok {
+		t.Error("channel not closed")
+	}
+	if len(client.Subscriptions()) != 0 {
+		t.Error("subscriptions still registered")
+	}
+
+	// The server is asked to stop sending notifications, the client remains usable
+	if err := client.ServerPing(); err != nil {
+		t.Fatal(err)
+	}
+	unsubscribed := false
+	for _, req := range srv.Requests() {
+		unsubscribed = unsubscribed || req.Method == "blockchain.scripthash.unsubscribe"
+	}
+	if !unsubscribed {
+		t.Error("no unsubscribe request received")
+	}
+}
+
+func TestPollingFallback(t *testing.T) {
+	var mu sync.Mutex
+	history := []Tx{{Hash: "aa", Height: 10}}
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	for _, kind := range []string{"address", "scripthash"} {
+		srv.HandleError("blockchain."+kind+".subscribe", CodeExcessiveResourceUsage, "too many subscriptions")
+		srv.HandleFunc("blockchain."+kind+".get_history", func([]json.RawMessage) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]Tx(nil), history...), nil
+		})
+	}
+
+	client, err := New(&Options{Address: srv.Addr(), PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	txs, _, err := client.NotifyAddressTransactions(ctx, "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, _, err := client.NotifyScriptHash(ctx, "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := addressStatus(history).(string)
+	if s := <-txs; s.Status != expected {
+		t.Errorf("unexpected address status: %s", s.Status)
+	}
+	if s := <-statuses; s.Status != expected {
+		t.Errorf("unexpected script hash status: %s", s.Status)
+	}
+
+	// Changes are detected on the next poll
+	mu.Lock()
+	history = append(history, Tx{Hash: "bb"})
+	expected = addressStatus(history).(string)
+	mu.Unlock()
+	if s := <-txs; s.Status != expected {
+		t.Errorf("unexpected address status: %s", s.Status)
+	}
+	if s := <-statuses; s.Status != expected {
+		t.Errorf("unexpected script hash status: %s", s.Status)
+	}
+}
+
+func TestPollingCancel(t *testing.T) {
+	srv := newTestServer(t, nil)
+	srv.HandleError("blockchain.scripthash.subscribe", CodeExcessiveResourceUsage, "too many subscriptions")
+	polled := make(chan struct{}, 1)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	srv.HandleFunc("blockchain.scripthash.get_history", func([]json.RawMessage) (interface{}, error) {
+		polled <- struct{}{}
+		<-release
+		return []Tx{}, nil
+	})
+
+	calls := make(chan *CallInfo, 10)
+	client, err := New(&Options{
+		Address:      srv.Addr(),
+		PollInterval: time.Millisecond,
+		OnCall: func(info *CallInfo) {
+			if info.Method == "blockchain.scripthash.get_history" {
+				calls <- info
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// A poll in progress is abandoned once the subscription is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, _, err := client.NotifyScriptHash(ctx, "scripthash"); err != nil {
+		t.Fatal(err)
+	}
+	<-polled
+	cancel()
+	select {
+	case info := <-calls:
+		if !errors.Is(info.Err, context.Canceled) {
+			t.Errorf("unexpected error: %v", info.Err)
+		}
+	case <-time.After(time.Second):
+		t.Error("poll not cancelled")
+	}
+}
+
+func TestSubscriptionChannelsClosed(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.Handle("blockchain.scripthash.subscribe", "status")
+	srv.Handle("blockchain.headers.subscribe", map[string]interface{}{"height": 100, "hex": genesisHeader})
+	srv.HandleError("blockchain.address.subscribe", CodeExcessiveResourceUsage, "too many subscriptions")
+	srv.Handle("blockchain.address.get_history", []Tx{{Hash: "aa", Height: 10}})
+
+	client, err := New(&Options{Address: srv.Addr(), PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Channels are closed once the context is done, even with deliveries pending on
+	// consumers not receiving anymore, including the ones produced by polling
+	ctx, cancel := context.WithCancel(context.Background())
+	statuses, _, err := client.NotifyScriptHash(ctx, "scripthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, _, err := client.NotifyBlockHeaders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heights, err := client.NotifyTipHeight(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, _, err := client.NotifyAddressTransactions(ctx, "address")
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* #nosec */
+	srv.Notify("blockchain.scripthash.subscribe", "scripthash", "changed")
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if !drained(statuses) || !drained(headers) || !drained(heights) || !drained(txs) {
+		t.Error("channel not closed")
+	}
+	if len(client.Subscriptions()) != 0 {
+		t.Error("subscriptions still registered")
+	}
+}
+
+// Receive from a channel until it's closed, returns false if it's still open after a second
+func drained[T any](ch <-chan T) bool {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
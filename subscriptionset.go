@@ -0,0 +1,295 @@
+package electrum
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// StatusUpdate reports a change on the status of an address or script hash tracked by
+// a SubscriptionSet
+type StatusUpdate struct {
+	// Address or script hash
+	Key string
+
+	// Status reported by the server, empty for keys without history
+	Status string
+
+	// Reason the subscription for the key was terminated, e.g. rejected by the server;
+	// the key is no longer part of the set
+	Err error
+}
+
+// SubscriptionSet tracks the status of a dynamic set of addresses or script hashes,
+// delivering the changes for all of them on a single channel, e.g. to monitor deposits
+// on a large number of addresses. Subscribe requests for keys added together are sent
+// to the server in batches, and the subscriptions are registered again automatically
+// after reconnections; only actual status changes are reported. It's safe for
+// concurrent use
+type SubscriptionSet struct {
+	client   *Client
+	method   string
+	unsub    string
+	history  func(string) (*[]Tx, error)
+	ctx      context.Context
+	cancel   context.CancelFunc
+	updates  chan *StatusUpdate
+	subs     map[string]*subscription
+	statuses map[string]string
+	closed   bool
+	closing  sync.RWMutex
+	done     chan struct{}
+	mu       sync.Mutex
+}
+
+// WatchAddresses returns a set tracking the status of the provided addresses using the
+// method 'blockchain.address.subscribe'; the set is closed when the context is done
+func (c *Client) WatchAddresses(ctx context.Context, addresses ...string) (*SubscriptionSet, error) {
+	s := c.newSubscriptionSet(ctx, "blockchain.address.subscribe", "blockchain.address.unsubscribe", c.AddressHistory)
+	if err := s.Add(addresses...); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// WatchScriptHashes returns a set tracking the status of the provided script hashes using
+// the method 'blockchain.scripthash.subscribe'; the set is closed when the context is done
+func (c *Client) WatchScriptHashes(ctx context.Context, scripthashes ...string) (*SubscriptionSet, error) {
+	s := c.newSubscriptionSet(ctx, "blockchain.scripthash.subscribe", "blockchain.scripthash.unsubscribe", c.ScriptHashHistory)
+	if err := s.Add(scripthashes...); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *Client) newSubscriptionSet(ctx context.Context, method, unsub string, history func(string) (*[]Tx, error)) *SubscriptionSet {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := &SubscriptionSet{
+		client:   c,
+		method:   method,
+		unsub:    unsub,
+		history:  history,
+		updates:  make(chan *StatusUpdate, c.subBuffer),
+		subs:     make(map[string]*subscription),
+		statuses: make(map[string]string),
+		done:     make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	go s.teardown()
+	return s
+}
+
+// Updates returns the channel receiving the initial status of every key added to the
+// set, followed by its subsequent changes; closed once the set is closed
+func (s *SubscriptionSet) Updates() <-chan *StatusUpdate {
+	return s.updates
+}
+
+// Add subscribes to the provided keys, ignoring the ones already on the set; on failure
+// the keys that couldn't be registered are not added
+func (s *SubscriptionSet) Add(keys ...string) error {
+	s.mu.Lock()
+	var subs []*subscription
+	for _, key := range keys {
+		if _, ok := s.subs[key]; !ok {
+			subs = append(subs, s.newSubscription(key))
+		}
+	}
+	s.mu.Unlock()
+	for _, sub := range subs {
+		if err := s.client.runSubscription(sub); err != nil {
+			for _, sub := range subs {
+				sub.cancel(err)
+			}
+			return err
+		}
+	}
+
+	// Keys added concurrently are only registered once
+	s.mu.Lock()
+	if err := s.ctx.Err(); err != nil {
+		s.mu.Unlock()
+		for _, sub := range subs {
+			sub.cancel(err)
+		}
+		return err
+	}
+	var added []*subscription
+	for _, sub := range subs {
+		key := sub.params[0].(string)
+		if _, ok := s.subs[key]; ok {
+			sub.cancel(nil)
+			continue
+		}
+		s.subs[key] = sub
+		added = append(added, sub)
+	}
+	s.mu.Unlock()
+
+	var first error
+	for i, err := range s.client.subscribeBatch(added) {
+		if err == nil {
+			continue
+		}
+		s.drop(added[i])
+		added[i].cancel(err)
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Remove stops tracking the provided keys, asking the server to stop sending their
+// notifications when supported
+func (s *SubscriptionSet) Remove(keys ...string) {
+	for _, key := range keys {
+		s.mu.Lock()
+		sub, ok := s.subs[key]
+		s.mu.Unlock()
+		if ok {
+			s.drop(sub)
+			sub.cancel(ErrUnsubscribed)
+		}
+	}
+}
+
+// Keys returns the keys currently on the set, sorted
+func (s *SubscriptionSet) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.subs))
+	for key := range s.subs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Status returns the last status received for a key; the boolean result is false if
+// the key is not on the set or its initial status was not received yet
+func (s *SubscriptionSet) Status(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[key]; !ok {
+		return "", false
+	}
+	status, ok := s.statuses[key]
+	return status, ok
+}
+
+// Close terminates the subscriptions for every key on the set; returns once the updates
+// channel is closed
+func (s *SubscriptionSet) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// Create the subscription for a key on the set, sharing the updates channel
+func (s *SubscriptionSet) newSubscription(key string) *subscription {
+	sub := newSubscription(s.ctx)
+	sub.method = s.method
+	sub.unsubscribe = s.unsub
+	sub.params = []interface{}{key}
+	sub.poll = func() (interface{}, error) {
+		history, err := s.history(key)
+		if err != nil || history == nil {
+			return nil, err
+		}
+		return addressStatus(*history), nil
+	}
+	sub.handler = func(m *response) {
+		status, ok := notificationStatus(m)
+		if !ok {
+			return
+		}
+		s.mu.Lock()
+		if s.subs[key] != sub {
+			s.mu.Unlock()
+			return
+		}
+		prev, seen := s.statuses[key]
+		s.statuses[key] = status
+		s.mu.Unlock()
+		if !seen || prev != status {
+			s.send(func() { emit(s.client, sub, s.updates, &StatusUpdate{Key: key, Status: status}) })
+		}
+	}
+
+	// Subscriptions terminated by the client or the server, rather than by the set,
+	// are reported to the consumer; delivery must not hold back the client
+	sub.onClose = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.ctx.Err() != nil || s.subs[key] != sub {
+			return
+		}
+		delete(s.subs, key)
+		delete(s.statuses, key)
+		go s.send(func() {
+			select {
+			case s.updates <- &StatusUpdate{Key: key, Err: context.Cause(sub.ctx)}:
+			case <-s.ctx.Done():
+			}
+		})
+	}
+	return sub
+}
+
+// Run a delivery on the updates channel unless the set is closed; deliveries must return
+// once the set's context is done, the channel is only closed when none is in progress
+func (s *SubscriptionSet) send(deliver func()) {
+	s.closing.RLock()
+	defer s.closing.RUnlock()
+	if !s.closed {
+		deliver()
+	}
+}
+
+// Remove a subscription from the set, if still tracked
+func (s *SubscriptionSet) drop(sub *subscription) {
+	key := sub.params[0].(string)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs[key] == sub {
+		delete(s.subs, key)
+		delete(s.statuses, key)
+	}
+}
+
+// Terminate every subscription once the set is closed, waiting for pending deliveries
+// before closing the updates channel; subscriptions no longer tracked by the set, e.g.
+// removed or rejected, may still be running their handlers
+func (s *SubscriptionSet) teardown() {
+	<-s.ctx.Done()
+	s.mu.Lock()
+	subs := s.subs
+	s.subs = make(map[string]*subscription)
+	s.mu.Unlock()
+	for _, sub := range subs {
+		<-sub.done
+	}
+	s.closing.Lock()
+	s.closed = true
+	close(s.updates)
+	s.closing.Unlock()
+	close(s.done)
+}
+
+// Status carried by the result of an address or script hash subscribe request, or by
+// its notifications; the status is empty for keys without history
+func notificationStatus(m *response) (string, bool) {
+	if params, ok := m.Params.([]interface{}); ok {
+		if len(params) != 2 {
+			return "", false
+		}
+		status, _ := params[1].(string)
+		return status, true
+	}
+	status, _ := m.Result.(string)
+	return status, true
+}
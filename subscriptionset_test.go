@@ -0,0 +1,126 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fairbank-io/electrum/electrumtest"
+)
+
+func TestSubscriptionSet(t *testing.T) {
+	srv := electrumtest.NewServer()
+	defer srv.Close()
+	srv.HandleFunc("blockchain.scripthash.subscribe", func(params []json.RawMessage) (interface{}, error) {
+		var key string
+		if err := json.Unmarshal(params[0], &key); err != nil || key == "rejected" {
+			return nil, &electrumtest.Error{Code: CodeExcessiveResourceUsage, Message: "too many subscriptions"}
+		}
+		return "status-" + key, nil
+	})
+
+	client, err := New(&Options{
+		Address:   srv.Addr(),
+		Reconnect: &ReconnectOptions{InitialDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	resumed := make(chan string, 10)
+	client.OnSubscriptionEvent(func(sub *Subscription, event SubscriptionEvent, err error) {
+		if event == SubscriptionResumed {
+			resumed <- fmt.Sprint(sub.Params()[0])
+		}
+	})
+
+	set, err := client.WatchScriptHashes(context.Background(), "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := map[string]string{}
+	for len(initial) < 2 {
+		u := <-set.Updates()
+		initial[u.Key] = u.Status
+	}
+	if initial["a"] != "status-a" || initial["b"] != "status-b" {
+		t.Errorf("unexpected initial statuses: %v", initial)
+	}
+	if status, ok := set.Status("a"); !ok || status != "status-a" {
+		t.Errorf("unexpected status: %q, %v", status, ok)
+	}
+
+	// Only actual changes are reported
+	/* #nosec */
+	srv.Notify("blockchain.scripthash.subscribe", "a", "status-a")
+	/* #nosec */
+	srv.Notify("blockchain.scripthash.subscribe", "b", "changed")
+	if u := <-set.Updates(); u.Key != "b" || u.Status != "changed" || u.Err != nil {
+		t.Errorf("unexpected update: %+v", u)
+	}
+
+	// Keys rejected by the server are reported and removed
+	if err := set.Add("rejected"); err != nil {
+		t.Fatal(err)
+	}
+	if u := <-set.Updates(); u.Key != "rejected" || !errors.Is(u.Err, ErrExcessiveUsage) {
+		t.Errorf("unexpected update: %+v", u)
+	}
+	set.Remove("a")
+	if keys := set.Keys(); len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+
+	// Registered again after a reconnection, reporting changes missed meanwhile
+	srv.Disconnect()
+	if key := <-resumed; key != "b" {
+		t.Errorf("unexpected subscription resumed: %s", key)
+	}
+	if u := <-set.Updates(); u.Key != "b" || u.Status != "status-b" {
+		t.Errorf("unexpected update: %+v", u)
+	}
+	/* #nosec */
+	srv.Notify("blockchain.scripthash.subscribe", "b", "status-b")
+	/* #nosec */
+	srv.Notify("blockchain.scripthash.subscribe", "b", "final")
+	if u := <-set.Updates(); u.Key != "b" || u.Status != "final" {
+		t.Errorf("unexpected update: %+v", u)
+	}
+
+	set.Close()
+	if _, ok := <-set.Updates(); ok {
+		t.Error("updates channel not closed")
+	}
+	if len(client.Subscriptions()) != 0 {
+		t.Error("subscriptions still registered")
+	}
+}
+
+func TestSubscriptionSetClose(t *testing.T) {
+	// Notifications keep arriving for every subscription while the set is closed
+	srv := newTestServer(t, map[string]string{"blockchain.scripthash.subscribe": `"status"`})
+	for _, key := range []string{"a", "b", "c"} {
+		notifyRepeatedly(t, srv, "blockchain.scripthash.subscribe", key, "status-"+key)
+	}
+	client, err := New(&Options{Address: srv.Addr(), SubscriptionBuffer: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 20; i++ {
+		set, err := client.WatchScriptHashes(context.Background(), "a", "b", "c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.Remove("a", "b")
+		time.Sleep(time.Millisecond)
+		set.Close()
+		for range set.Updates() {
+		}
+	}
+}
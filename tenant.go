@@ -0,0 +1,228 @@
+package electrum
+
+import "context"
+
+// Context key for the tenant on whose behalf an operation is run
+type tenantKey struct{}
+
+// View of a managed connection handed to tenants; every operation is bound to the
+// tenant, so its quota is enforced on each protocol request and subscription the
+// operation produces. It also prevents tenants from recovering the underlying client
+type tenantClient struct {
+	client *Client
+	tenant *Tenant
+}
+
+// Tenant on whose behalf an operation is run, if any
+func tenantFromContext(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return t
+}
+
+// Charge requests about to be sent to the quota of the tenant bound to the context, if any
+func chargeRequests(ctx context.Context, n int) error {
+	if t := tenantFromContext(ctx); t != nil && !t.allowRequests(n) {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Bind the context to the tenant
+func (v *tenantClient) bind(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, tenantKey{}, v.tenant)
+}
+
+func (v *tenantClient) ServerPingContext(ctx context.Context) error {
+	return v.client.ServerPingContext(v.bind(ctx))
+}
+
+func (v *tenantClient) ServerVersionContext(ctx context.Context) (*VersionInfo, error) {
+	return v.client.ServerVersionContext(v.bind(ctx))
+}
+
+func (v *tenantClient) ServerBannerContext(ctx context.Context) (string, error) {
+	return v.client.ServerBannerContext(v.bind(ctx))
+}
+
+func (v *tenantClient) ServerDonationAddressContext(ctx context.Context) (string, error) {
+	return v.client.ServerDonationAddressContext(v.bind(ctx))
+}
+
+func (v *tenantClient) ServerFeaturesContext(ctx context.Context) (*ServerInfo, error) {
+	return v.client.ServerFeaturesContext(v.bind(ctx))
+}
+
+func (v *tenantClient) ServerPeersContext(ctx context.Context) ([]*Peer, error) {
+	return v.client.ServerPeersContext(v.bind(ctx))
+}
+
+func (v *tenantClient) AddressBalanceContext(ctx context.Context, address string) (*Balance, error) {
+	return v.client.AddressBalanceContext(v.bind(ctx), address)
+}
+
+func (v *tenantClient) AddressHistoryContext(ctx context.Context, address string) (*[]Tx, error) {
+	return v.client.AddressHistoryContext(v.bind(ctx), address)
+}
+
+func (v *tenantClient) AddressMempoolContext(ctx context.Context, address string) (*[]Tx, error) {
+	return v.client.AddressMempoolContext(v.bind(ctx), address)
+}
+
+func (v *tenantClient) AddressListUnspentContext(ctx context.Context, address string) (*[]Tx, error) {
+	return v.client.AddressListUnspentContext(v.bind(ctx), address)
+}
+
+func (v *tenantClient) ScriptHashBalanceContext(ctx context.Context, scripthash string) (*Balance, error) {
+	return v.client.ScriptHashBalanceContext(v.bind(ctx), scripthash)
+}
+
+func (v *tenantClient) ScriptHashHistoryContext(ctx context.Context, scripthash string) (*[]Tx, error) {
+	return v.client.ScriptHashHistoryContext(v.bind(ctx), scripthash)
+}
+
+func (v *tenantClient) ScriptHashMempoolContext(ctx context.Context, scripthash string) (*[]Tx, error) {
+	return v.client.ScriptHashMempoolContext(v.bind(ctx), scripthash)
+}
+
+func (v *tenantClient) ScriptHashListUnspentContext(ctx context.Context, scripthash string) (*[]Tx, error) {
+	return v.client.ScriptHashListUnspentContext(v.bind(ctx), scripthash)
+}
+
+func (v *tenantClient) BlockHeaderContext(ctx context.Context, index int) (*BlockHeader, error) {
+	return v.client.BlockHeaderContext(v.bind(ctx), index)
+}
+
+func (v *tenantClient) BlockHeaderProofContext(ctx context.Context, height, cpHeight int) (*BlockHeader, error) {
+	return v.client.BlockHeaderProofContext(v.bind(ctx), height, cpHeight)
+}
+
+func (v *tenantClient) BlockHeadersContext(ctx context.Context, start, count int) (*HeadersChunk, error) {
+	return v.client.BlockHeadersContext(v.bind(ctx), start, count)
+}
+
+func (v *tenantClient) BlockHeadersProofContext(ctx context.Context, start, count, cpHeight int) (*HeadersChunk, error) {
+	return v.client.BlockHeadersProofContext(v.bind(ctx), start, count, cpHeight)
+}
+
+func (v *tenantClient) Headers(start, end int) *HeaderIterator {
+	return v.client.HeadersContext(v.bind(context.Background()), start, end)
+}
+
+func (v *tenantClient) HeadersContext(ctx context.Context, start, end int) *HeaderIterator {
+	return v.client.HeadersContext(v.bind(ctx), start, end)
+}
+
+func (v *tenantClient) SyncHeaders(ctx context.Context, start int, handler func(*BlockHeader) error, progress func(*SyncProgress)) error {
+	return v.client.SyncHeaders(v.bind(ctx), start, handler, progress)
+}
+
+func (v *tenantClient) BroadcastTransactionContext(ctx context.Context, hex string) (string, error) {
+	return v.client.BroadcastTransactionContext(v.bind(ctx), hex)
+}
+
+func (v *tenantClient) GetTransactionContext(ctx context.Context, hash string) (string, error) {
+	return v.client.GetTransactionContext(v.bind(ctx), hash)
+}
+
+func (v *tenantClient) GetTransactionVerboseContext(ctx context.Context, hash string) (*TransactionInfo, error) {
+	return v.client.GetTransactionVerboseContext(v.bind(ctx), hash)
+}
+
+func (v *tenantClient) GetTransactions(ctx context.Context, hashes []string) ([]TransactionResult, error) {
+	return v.client.GetTransactions(v.bind(ctx), hashes)
+}
+
+func (v *tenantClient) TransactionMerkleContext(ctx context.Context, tx string, height int) (*TxMerkle, error) {
+	return v.client.TransactionMerkleContext(v.bind(ctx), tx, height)
+}
+
+func (v *tenantClient) TransactionIDFromPosContext(ctx context.Context, height, pos int, withMerkle bool) (string, []string, error) {
+	return v.client.TransactionIDFromPosContext(v.bind(ctx), height, pos, withMerkle)
+}
+
+func (v *tenantClient) TransactionMerkleByIDContext(ctx context.Context, txid string, hintAddresses ...string) (*TxMerkle, error) {
+	return v.client.TransactionMerkleByIDContext(v.bind(ctx), txid, hintAddresses...)
+}
+
+func (v *tenantClient) TxHeightContext(ctx context.Context, txid string, hintAddresses ...string) (int, error) {
+	return v.client.TxHeightContext(v.bind(ctx), txid, hintAddresses...)
+}
+
+func (v *tenantClient) FirstSeenHeightContext(ctx context.Context, address string) (int, bool, error) {
+	return v.client.FirstSeenHeightContext(v.bind(ctx), address)
+}
+
+func (v *tenantClient) ScriptHashFirstSeenHeightContext(ctx context.Context, scripthash string) (int, bool, error) {
+	return v.client.ScriptHashFirstSeenHeightContext(v.bind(ctx), scripthash)
+}
+
+func (v *tenantClient) SnapshotContext(ctx context.Context, addresses []string, proofs bool) (*UTXOSnapshot, error) {
+	return v.client.SnapshotContext(v.bind(ctx), addresses, proofs)
+}
+
+func (v *tenantClient) EstimateFeeContext(ctx context.Context, blocks int) (float64, error) {
+	return v.client.EstimateFeeContext(v.bind(ctx), blocks)
+}
+
+func (v *tenantClient) EstimateFeeRateContext(ctx context.Context, blocks int) (Amount, error) {
+	return v.client.EstimateFeeRateContext(v.bind(ctx), blocks)
+}
+
+func (v *tenantClient) RelayFeeContext(ctx context.Context) (Amount, error) {
+	return v.client.RelayFeeContext(v.bind(ctx))
+}
+
+func (v *tenantClient) FeeHistogramContext(ctx context.Context) ([]FeeHistogramEntry, error) {
+	return v.client.FeeHistogramContext(v.bind(ctx))
+}
+
+func (v *tenantClient) NotifyBlockHeaders(ctx context.Context) (<-chan *BlockHeader, *Subscription, error) {
+	return v.client.NotifyBlockHeaders(v.bind(ctx))
+}
+
+func (v *tenantClient) SubscribeBlockHeaders(ctx context.Context) (*BlockHeader, <-chan *BlockHeader, error) {
+	return v.client.SubscribeBlockHeaders(v.bind(ctx))
+}
+
+func (v *tenantClient) NotifyTipHeight(ctx context.Context) (<-chan int64, error) {
+	return v.client.NotifyTipHeight(v.bind(ctx))
+}
+
+func (v *tenantClient) NotifyPeers(ctx context.Context) (<-chan []*Peer, *Subscription, error) {
+	return v.client.NotifyPeers(v.bind(ctx))
+}
+
+func (v *tenantClient) NotifyAddressTransactions(ctx context.Context, address string) (<-chan *AddressStatus, *Subscription, error) {
+	return v.client.NotifyAddressTransactions(v.bind(ctx), address)
+}
+
+func (v *tenantClient) SubscribeAddressTransactions(ctx context.Context, address string) (string, <-chan *AddressStatus, error) {
+	return v.client.SubscribeAddressTransactions(v.bind(ctx), address)
+}
+
+func (v *tenantClient) NotifyAddressHistory(ctx context.Context, address string) (<-chan Tx, *Subscription, error) {
+	return v.client.NotifyAddressHistory(v.bind(ctx), address)
+}
+
+func (v *tenantClient) NotifyScriptHash(ctx context.Context, scripthash string) (<-chan *ScriptHashStatus, *Subscription, error) {
+	return v.client.NotifyScriptHash(v.bind(ctx), scripthash)
+}
+
+func (v *tenantClient) SubscribeScriptHash(ctx context.Context, scripthash string) (string, <-chan *ScriptHashStatus, error) {
+	return v.client.SubscribeScriptHash(v.bind(ctx), scripthash)
+}
+
+func (v *tenantClient) WatchAddresses(ctx context.Context, addresses ...string) (*SubscriptionSet, error) {
+	return v.client.WatchAddresses(v.bind(ctx), addresses...)
+}
+
+func (v *tenantClient) WatchScriptHashes(ctx context.Context, scripthashes ...string) (*SubscriptionSet, error) {
+	return v.client.WatchScriptHashes(v.bind(ctx), scripthashes...)
+}
+
+func (v *tenantClient) WatchConflicts(ctx context.Context, txid string, addresses []string) (<-chan *Conflict, error) {
+	return v.client.WatchConflicts(v.bind(ctx), txid, addresses)
+}
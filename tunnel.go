@@ -0,0 +1,156 @@
+package electrum
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// TunnelDialer is implemented by clients able to open network connections from a remote
+// host, e.g. an *ssh.Client from the 'golang.org/x/crypto/ssh' package
+type TunnelDialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// DialTunnel returns a function, suitable for the 'Dial' option, establishing connections
+// from the remote end of the tunnel; the server address is resolved by the remote host, so
+// servers only listening on its loopback interface can be reached, e.g.
+//
+//	sshClient, _ := ssh.Dial("tcp", "jump.example.com:22", sshConfig)
+//	client, _ := electrum.New(&electrum.Options{
+//		Address: "127.0.0.1:50001",
+//		Dial:    electrum.DialTunnel(sshClient),
+//	})
+//
+// The tunnel is not closed by the client
+func DialTunnel(tunnel TunnelDialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		type result struct {
+			conn net.Conn
+			err  error
+		}
+		ch := make(chan result, 1)
+		go func() {
+			conn, err := tunnel.Dial(network, addr)
+			ch <- result{conn, err}
+		}()
+		select {
+		case r := <-ch:
+			return r.conn, r.err
+		case <-ctx.Done():
+			// Release the connection if established after giving up
+			go func() {
+				if r := <-ch; r.conn != nil {
+					/* #nosec */
+					r.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SSHTunnel reaches the server through an SSH jump host, e.g. a personal server only
+// listening on the loopback interface of a remote box. The SSH connection is established
+// on first use, shared by every connection dialed, and established again if lost; the
+// tunnel can be shared among multiple clients and is safe for concurrent use
+//
+//	tunnel := electrum.NewSSHTunnel("jump.example.com:22", &ssh.ClientConfig{
+//		User:            "electrum",
+//		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+//		HostKeyCallback: ssh.FixedHostKey(hostKey),
+//	})
+//	defer tunnel.Close()
+//	client, _ := electrum.New(&electrum.Options{
+//		Address: "127.0.0.1:50001",
+//		Dial:    tunnel.DialContext,
+//	})
+type SSHTunnel struct {
+	address string
+	config  *ssh.ClientConfig
+	conn    *ssh.Client
+	closed  bool
+	mu      sync.Mutex
+}
+
+// NewSSHTunnel returns a tunnel using the SSH server at the provided address, 'host:port'
+func NewSSHTunnel(address string, config *ssh.ClientConfig) *SSHTunnel {
+	return &SSHTunnel{address: address, config: config}
+}
+
+// DialContext establishes a connection from the jump host to the provided address,
+// suitable for the 'Dial' option
+func (t *SSHTunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return DialTunnel(conn)(ctx, network, addr)
+}
+
+// Close terminates the SSH connection; connections dialed through the tunnel are
+// closed as well, and no new ones can be established
+func (t *SSHTunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// Get the current SSH connection, establishing a new one if required
+func (t *SSHTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, net.ErrClosed
+	}
+	if t.conn != nil {
+		return t.conn, nil
+	}
+
+	dialer := &net.Dialer{Timeout: t.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", t.address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abort the SSH handshake when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		/* #nosec */
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	sc, chans, reqs, err := ssh.NewClientConn(conn, t.address, t.config)
+	if !stop() {
+		if err == nil {
+			/* #nosec */
+			sc.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		/* #nosec */
+		conn.Close()
+		return nil, err
+	}
+	t.conn = ssh.NewClient(sc, chans, reqs)
+
+	// Discard the connection once lost so the next dial establishes a new one
+	go func(c *ssh.Client) {
+		/* #nosec */
+		c.Wait()
+		t.mu.Lock()
+		if t.conn == c {
+			t.conn = nil
+		}
+		t.mu.Unlock()
+	}(t.conn)
+	return t.conn, nil
+}
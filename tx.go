@@ -0,0 +1,153 @@
+package electrum
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrInvalidTx is returned when a transaction can't be decoded
+var ErrInvalidTx = errors.New("INVALID_TRANSACTION")
+
+// Outpoint identifies a transaction output
+type Outpoint struct {
+	Hash  string
+	Index uint32
+}
+
+// Decoded transaction output
+type txOutput struct {
+	value  Amount
+	script []byte
+}
+
+// Minimal decoded representation of a serialized transaction, including only the
+// details required by the library
+type rawTx struct {
+	id      string
+	version int32
+	inputs  []Outpoint
+	outputs []txOutput
+	size    int
+	vsize   int
+}
+
+// Decode a hex-encoded transaction, supporting both legacy and segwit serializations
+func parseTx(txHex string) (*rawTx, error) {
+	b, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, ErrInvalidTx
+	}
+	r := &txReader{b: b}
+	tx := &rawTx{version: int32(r.uint32()), size: len(b)}
+
+	// Segwit serializations use a zero marker byte, followed by a flag byte
+	segwit := false
+	if len(r.b) > r.pos+1 && r.b[r.pos] == 0 && r.b[r.pos+1] != 0 {
+		segwit = true
+		r.pos += 2
+	}
+
+	nIn := r.varInt()
+	for i := uint64(0); i < nIn && r.err == nil; i++ {
+		hash := r.bytes(32)
+		index := r.uint32()
+		r.bytes(int(r.varInt()))
+		r.uint32()
+		if r.err == nil {
+			tx.inputs = append(tx.inputs, Outpoint{Hash: reverseHex(hash), Index: index})
+		}
+	}
+
+	nOut := r.varInt()
+	for i := uint64(0); i < nOut && r.err == nil; i++ {
+		value := Amount(r.uint64())
+		script := r.bytes(int(r.varInt()))
+		tx.outputs = append(tx.outputs, txOutput{value: value, script: script})
+	}
+
+	// Witness data, including the marker and flag bytes, is discounted on
+	// the virtual size of the transaction
+	witness := 0
+	start := r.pos
+	if segwit {
+		for i := uint64(0); i < nIn && r.err == nil; i++ {
+			items := r.varInt()
+			for j := uint64(0); j < items && r.err == nil; j++ {
+				r.bytes(int(r.varInt()))
+			}
+		}
+		witness = r.pos - start + 2
+	}
+	r.uint32()
+	if r.err != nil || r.pos != len(r.b) || len(tx.inputs) == 0 || len(tx.outputs) == 0 {
+		return nil, ErrInvalidTx
+	}
+	tx.vsize = ((len(b)-witness)*4 + witness + 3) / 4
+
+	// The identifier is calculated over the legacy serialization, i.e. excluding the
+	// marker, flag and witness data; hashing everything produces the witness identifier
+	legacy := b
+	if segwit {
+		legacy = make([]byte, 0, len(b)-witness)
+		legacy = append(legacy, b[:4]...)
+		legacy = append(legacy, b[6:start]...)
+		legacy = append(legacy, b[len(b)-4:]...)
+	}
+	tx.id = reverseHex(doubleSHA256(legacy))
+	return tx, nil
+}
+
+// Sequential reader over serialized transaction data; any read past the end of
+// the data sets the error flag
+type txReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *txReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.b) {
+		r.err = ErrInvalidTx
+		return nil
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *txReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *txReader) uint64() uint64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (r *txReader) varInt() uint64 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	switch b[0] {
+	case 0xfd:
+		if b = r.bytes(2); b != nil {
+			return uint64(binary.LittleEndian.Uint16(b))
+		}
+	case 0xfe:
+		return uint64(r.uint32())
+	case 0xff:
+		return r.uint64()
+	default:
+		return uint64(b[0])
+	}
+	return 0
+}
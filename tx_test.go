@@ -0,0 +1,107 @@
+package electrum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Build a legacy transaction spending the provided output, with a single output
+// of the given value
+func mockTx(prevHash string, index uint32, value Amount) string {
+	return fmt.Sprintf("01000000%s%s%08x00ffffffff01%016x0151%s",
+		"01", prevHash, swap32(index), swap64(uint64(value)), "00000000")
+}
+
+func swap32(v uint32) uint32 {
+	return v>>24 | (v>>8)&0xff00 | (v<<8)&0xff0000 | v<<24
+}
+
+func swap64(v uint64) uint64 {
+	return uint64(swap32(uint32(v)))<<32 | uint64(swap32(uint32(v>>32)))
+}
+
+func TestParseTx(t *testing.T) {
+	tx, err := parseTx(genesisCoinbase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.version != 1 || len(tx.inputs) != 1 || len(tx.outputs) != 1 {
+		t.Fatalf("unexpected transaction: %+v", tx)
+	}
+	if tx.inputs[0].Hash != strings.Repeat("0", 64) || tx.inputs[0].Index != 0xffffffff {
+		t.Errorf("unexpected input: %+v", tx.inputs[0])
+	}
+	if tx.outputs[0].value != 50*SatoshisPerBTC {
+		t.Errorf("unexpected output value: %d", tx.outputs[0].value)
+	}
+
+	tx, err = parseTx(mockTx(strings.Repeat("ab", 32), 2, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.inputs[0].Index != 2 || tx.outputs[0].value != 1000 {
+		t.Errorf("unexpected transaction: %+v", tx)
+	}
+
+	// Segwit serialization, with a single witness item on the input
+	segwit := "01000000" + "0001" + "01" + strings.Repeat("cd", 32) + "00000000" + "00" + "ffffffff" +
+		"01" + "e803000000000000" + "0151" + "01" + "02" + "abcd" + "00000000"
+	if tx, err = parseTx(segwit); err != nil || tx.outputs[0].value != 1000 || tx.size != 67 || tx.vsize != 63 {
+		t.Errorf("unexpected result: %+v, %v", tx, err)
+	}
+
+	for _, invalid := range []string{"", "zz", genesisCoinbase[:100], genesisCoinbase + "00"} {
+		if _, err := parseTx(invalid); err != ErrInvalidTx {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestWatchConflicts(t *testing.T) {
+	prev := strings.Repeat("11", 32)
+	watched := mockTx(prev, 0, 1000)
+	conflicting := mockTx(prev, 0, 900)
+	unrelated := mockTx(prev, 1, 900)
+	txs := map[string]string{"watched": watched, "conflicting": conflicting, "unrelated": unrelated}
+
+	srv := newTestServer(t, map[string]string{
+		"blockchain.address.get_mempool": `[{"tx_hash":"watched"},{"tx_hash":"unrelated"},{"tx_hash":"conflicting"}]`,
+		"blockchain.address.get_history": `[]`,
+		"blockchain.address.subscribe":   `"status"`,
+	})
+	srv.HandleFunc("blockchain.transaction.get", func(params []json.RawMessage) (interface{}, error) {
+		var hash string
+		if err := json.Unmarshal(params[0], &hash); err != nil {
+			return nil, err
+		}
+		return txs[hash], nil
+	})
+	client, err := New(&Options{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conflicts, err := client.WatchConflicts(ctx, "watched", []string{"addr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-conflicts:
+		if c.TxID != "watched" || c.ConflictingTxID != "conflicting" || c.Outpoint.Hash != prev {
+			t.Errorf("unexpected conflict: %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("conflict not detected")
+	}
+
+	// The channel is closed once the context is done
+	cancel()
+	for range conflicts {
+	}
+}
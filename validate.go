@@ -0,0 +1,104 @@
+package electrum
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Options validation errors; ErrInvalidAddress is already used for wallet addresses,
+// server addresses are reported with ErrInvalidServer
+var (
+	ErrInvalidOptions      = errors.New("INVALID_OPTIONS")
+	ErrInvalidServer       = errors.New("INVALID_SERVER_ADDRESS")
+	ErrUnsupportedProtocol = errors.New("UNSUPPORTED_PROTOCOL")
+)
+
+// Range of protocol versions supported by the client, [min, max)
+var (
+	minProtocol = ProtocolVersion{1, 0}
+	maxProtocol = ProtocolVersion{1, 5}
+)
+
+// Check the provided options for misconfiguration before creating a client; the
+// returned errors wrap one of the validation errors with a description of the problem
+func validateOptions(options *Options) error {
+	if options == nil {
+		return fmt.Errorf("%w: options are required", ErrInvalidOptions)
+	}
+	if options.Address == "" && options.Transport == nil {
+		return fmt.Errorf("%w: address is required", ErrInvalidServer)
+	}
+
+	var protocol, protocolMin ProtocolVersion
+	var err error
+	if options.Protocol != "" {
+		if protocol, err = validateProtocol(options.Protocol); err != nil {
+			return err
+		}
+	}
+	if options.ProtocolMin != "" {
+		if protocolMin, err = validateProtocol(options.ProtocolMin); err != nil {
+			return err
+		}
+		if options.Protocol != "" && !protocol.AtLeast(protocolMin) {
+			return fmt.Errorf("%w: min version '%s' is greater than '%s'",
+				ErrUnsupportedProtocol, options.ProtocolMin, options.Protocol)
+		}
+	}
+
+	for _, o := range []struct {
+		name  string
+		value int64
+	}{
+		{"MaxInflight", int64(options.MaxInflight)},
+		{"MaxSubscriptions", int64(options.MaxSubscriptions)},
+		{"SubscriptionBuffer", int64(options.SubscriptionBuffer)},
+		{"BatchSize", int64(options.BatchSize)},
+		{"BatchConcurrency", int64(options.BatchConcurrency)},
+		{"EventHistory", int64(options.EventHistory)},
+		{"KeepAliveInterval", int64(options.KeepAliveInterval)},
+		{"KeepAliveJitter", int64(options.KeepAliveJitter)},
+		{"PollInterval", int64(options.PollInterval)},
+		{"FeeCacheTTL", int64(options.FeeCacheTTL)},
+	} {
+		if o.value < 0 {
+			return fmt.Errorf("%w: negative '%s' value", ErrInvalidOptions, o.name)
+		}
+	}
+	return nil
+}
+
+// Parse a protocol version tag, ensuring it's supported by the client
+func validateProtocol(tag string) (ProtocolVersion, error) {
+	v, err := ParseProtocolVersion(tag)
+	if err != nil {
+		return v, fmt.Errorf("%w: malformed version '%s'", ErrUnsupportedProtocol, tag)
+	}
+	if !v.AtLeast(minProtocol) || v.AtLeast(maxProtocol) {
+		return v, fmt.Errorf("%w: version '%s'", ErrUnsupportedProtocol, tag)
+	}
+	return v, nil
+}
+
+// Check the server address resulting from the parsed transport options
+func validateAddress(opts *transportOptions) error {
+	if opts.network == schemeUnix {
+		if opts.address == "" {
+			return fmt.Errorf("%w: socket path is required", ErrInvalidServer)
+		}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(opts.address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidServer, err)
+	}
+	if host == "" {
+		return fmt.Errorf("%w: host is required", ErrInvalidServer)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return fmt.Errorf("%w: invalid port '%s'", ErrInvalidServer, port)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package electrum
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateOptions(t *testing.T) {
+	cases := []struct {
+		options *Options
+		err     error
+	}{
+		{nil, ErrInvalidOptions},
+		{&Options{}, ErrInvalidServer},
+		{&Options{Address: "localhost"}, ErrInvalidServer},
+		{&Options{Address: ":50001"}, ErrInvalidServer},
+		{&Options{Address: "localhost:0"}, ErrInvalidServer},
+		{&Options{Address: "unix://"}, ErrInvalidServer},
+		{&Options{Address: "localhost:50001", Protocol: "one"}, ErrUnsupportedProtocol},
+		{&Options{Address: "localhost:50001", Protocol: "0.9"}, ErrUnsupportedProtocol},
+		{&Options{Address: "localhost:50001", Protocol: "1.2", ProtocolMin: "1.4"}, ErrUnsupportedProtocol},
+		{&Options{Address: "localhost:50001", MaxInflight: -1}, ErrInvalidOptions},
+		{&Options{Address: "localhost:50001", Protocol: "1.4", ProtocolMin: "1.2"}, nil},
+	}
+	for _, c := range cases {
+		_, err := NewClient(c.options)
+		if !errors.Is(err, c.err) {
+			t.Errorf("unexpected error for %+v: %v", c.options, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package electrum
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1" // #nosec, required by the WebSocket handshake
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// WebSocket frame opcodes
+// https://tools.ietf.org/html/rfc6455#section-5.2
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// GUID used to calculate the handshake accept key
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Max size in bytes of a message received from the server, also applied to each of its
+// frames; the frame header announces the payload size before it's read
+const maxMessageSize = 32 << 20
+
+var (
+	// ErrWebSocketHandshake is returned when the server doesn't accept the WebSocket upgrade
+	ErrWebSocketHandshake = errors.New("WEBSOCKET_HANDSHAKE")
+
+	// ErrMessageTooLarge is returned when the server sends a message exceeding the max
+	// supported size; the connection is dropped
+	ErrMessageTooLarge = errors.New("MESSAGE_TOO_LARGE")
+)
+
+// Minimal WebSocket client connection; each written buffer is sent as a single text
+// message and received messages are returned as delimiter-terminated lines, so the
+// connection can be used transparently by the transport
+type wsConn struct {
+	net.Conn
+	r   *bufio.Reader
+	buf bytes.Buffer
+	wmu sync.Mutex
+}
+
+// Perform the opening handshake over an established connection
+func wsHandshake(conn net.Conn, host, path string) (net.Conn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	if path == "" {
+		path = "/"
+	}
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", path, host, key)
+	if _, err := conn.Write([]byte(req)); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	/* #nosec */
+	h := sha1.Sum([]byte(key + wsGUID))
+	if res.StatusCode != http.StatusSwitchingProtocols ||
+		res.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(h[:]) {
+		return nil, ErrWebSocketHandshake
+	}
+	return &wsConn{Conn: conn, r: r}, nil
+}
+
+// Read returns the contents of received messages
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 {
+		if err := c.readMessage(); err != nil {
+			return 0, err
+		}
+	}
+	return c.buf.Read(p)
+}
+
+// Write sends the provided buffer as a single text message
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(wsText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close sends a close frame before terminating the underlying connection
+func (c *wsConn) Close() error {
+	/* #nosec */
+	c.writeFrame(wsClose, nil)
+	return c.Conn.Close()
+}
+
+// Read frames until a complete data message is available on the internal buffer,
+// control frames are handled transparently
+func (c *wsConn) readMessage() error {
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case wsText, wsBinary, wsContinuation:
+			if c.buf.Len()+len(payload) > maxMessageSize {
+				return ErrMessageTooLarge
+			}
+			c.buf.Write(payload)
+			if fin {
+				if n := c.buf.Len(); n > 0 && c.buf.Bytes()[n-1] != delimiter {
+					c.buf.WriteByte(delimiter)
+				}
+				return nil
+			}
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return err
+			}
+		case wsClose:
+			return io.EOF
+		}
+	}
+}
+
+// Read a single frame; server frames are never masked
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	op = head[0] & 0x0F
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > maxMessageSize {
+		err = ErrMessageTooLarge
+		return
+	}
+	var mask [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// Write a single masked frame, as required for client frames
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(n))
+	}
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.Conn.Write(frame)
+	return err
+}